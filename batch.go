@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// batchEntry is one operation of the batch command's input.
+type batchEntry struct {
+	Op    string  `yaml:"op"`
+	Key   string  `yaml:"key"`
+	Value *string `yaml:"value"`
+}
+
+var BatchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Apply several changes from stdin at once",
+	Long: `Reads a list of operations as YAML or JSON from stdin and applies them in one
+atomic step: either every operation succeeds or the store is left unchanged.
+
+Each operation has an op (create, update, upsert or delete), a key and, except
+for delete, a plaintext value:
+
+  - op: create
+    key: payments/db_user
+    value: payments
+  - op: upsert
+    key: payments/db_password
+    value: s3cr3t
+  - op: delete
+    key: payments/legacy_token
+
+Batches are supported by the sqlite, jsonfile and bolt backends.
+Deletes are permanent, so a batch with deletes is refused with soft delete
+enabled.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := parseBatch(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+
+		encryptionKey, err := key.LoadKeyFromEnv()
+		if err != nil {
+			return fmt.Errorf("failed to load encryption key: %w", err)
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		bs, err := store.AsBatchStore(s)
+		if err != nil {
+			return err
+		}
+
+		// Upserts become creates or updates depending on whether the key
+		// exists at that point of the batch. If another process changes a
+		// key in the meantime, the batch fails as a whole.
+		createEdit, err := metadataEdit(cmd, s, true)
+		if err != nil {
+			return fmt.Errorf("failed to record metadata: %w", err)
+		}
+		updateEdit, err := metadataEdit(cmd, s, false)
+		if err != nil {
+			return fmt.Errorf("failed to record metadata: %w", err)
+		}
+		cs := store.NewContextStore(s)
+		exists := make(map[string]bool)
+		ops := make([]store.BatchOp, 0, len(entries))
+		for _, entry := range entries {
+			op := store.BatchOp{Kind: store.BatchOpKind(entry.Op), Key: entry.Key}
+			if entry.Op == "upsert" {
+				found, known := exists[entry.Key]
+				if !known {
+					if found, err = cs.Exists(cmd.Context(), entry.Key); err != nil {
+						fmt.Fprintf(os.Stderr, "failed to read secret '%s': %v\n", entry.Key, err)
+						os.Exit(1)
+					}
+				}
+				op.Kind = store.BatchCreate
+				if found {
+					op.Kind = store.BatchUpdate
+				}
+			}
+			if op.Kind != store.BatchDelete {
+				op.Value, err = crypto.Encrypt([]byte(*entry.Value), encryptionKey)
+				if err != nil {
+					return fmt.Errorf("failed to encrypt value: %w", err)
+				}
+			}
+			// The creator, or the next expiry date, recorded in the same step
+			switch op.Kind {
+			case store.BatchCreate:
+				op.Metadata = createEdit
+			case store.BatchUpdate:
+				op.Metadata = updateEdit
+			}
+			exists[entry.Key] = op.Kind != store.BatchDelete
+			ops = append(ops, op)
+		}
+
+		err = store.RunContext(cmd.Context(), s, func() error { return bs.ApplyBatch(ops) })
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "batch not applied, the store is unchanged: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Applied %d operations using backend '%s'.\n", len(ops), store.BackendType)
+		return nil
+	},
+}
+
+// parseBatch reads and checks the operations of the batch command. JSON is
+// read as YAML, of which it is a subset.
+func parseBatch(r io.Reader) ([]batchEntry, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	var entries []batchEntry
+	if err := decoder.Decode(&entries); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse batch: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("batch contains no operations")
+	}
+
+	for i, entry := range entries {
+		if entry.Key == "" {
+			return nil, fmt.Errorf("batch operation %d: key is required", i+1)
+		}
+		switch entry.Op {
+		case "create", "update", "upsert":
+			if entry.Value == nil {
+				return nil, fmt.Errorf("batch operation %d (%s '%s'): value is required", i+1, entry.Op, entry.Key)
+			}
+		case "delete":
+			if store.SoftDelete {
+				return nil, fmt.Errorf("batch operation %d (delete '%s'): batch deletes are permanent and soft delete is enabled", i+1, entry.Key)
+			}
+		default:
+			return nil, fmt.Errorf("batch operation %d: unknown op '%s' (expected create, update, upsert or delete)", i+1, entry.Op)
+		}
+	}
+	return entries, nil
+}
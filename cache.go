@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var cacheClearAll bool
+
+var CacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the local cache of a remote backend",
+	Long: `With a cache TTL set by --cache-ttl or cache_ttl in the config file, the
+secrets, key lists and metadata read from the backend are kept in an encrypted
+cache file. Entries younger than the TTL are served without asking the backend;
+older ones are still served, with a warning, while the backend is unreachable.`,
+}
+
+var CacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove the cached secrets of the store",
+	Long: `Removes the cache file of the store selected by --backend, --namespace and the
+config file, or with --all every cache file. The backend is not contacted.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		removed, err := store.ClearCache(cacheClearAll)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to clear cache: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %d cache files.\n", removed)
+		return nil
+	},
+}
+
+func init() {
+	CacheClearCmd.Flags().BoolVar(&cacheClearAll, "all", false, "Remove the cache files of every store")
+	CacheCmd.AddCommand(CacheClearCmd)
+}
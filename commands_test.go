@@ -0,0 +1,611 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+	"secrets-cli/internal/pass"
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+// testMemoryStore backs the "memory" backend, registered for the tests only,
+// so that every store the commands open within a test sees the same secrets.
+var testMemoryStore = store.NewMemoryStore()
+
+func init() {
+	store.Register("memory", func(location string) (store.SecretStore, error) {
+		return testMemoryStore.Clone(), nil
+	})
+}
+
+// useMemoryStore points the commands at the shared in-memory backend and
+// provides an encryption key for the duration of the test.
+func useMemoryStore(t *testing.T) {
+	t.Helper()
+	encodedKey, err := key.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(key.EnvKeyName, encodedKey)
+
+	previous := store.BackendType
+	store.BackendType = "memory"
+	t.Cleanup(func() { store.BackendType = previous })
+}
+
+// runCommand executes cmd with args and returns what it printed to stdout.
+func runCommand(t *testing.T, cmd *cobra.Command, args ...string) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	if cmd.Context() == nil {
+		cmd.SetContext(context.Background()) // Set by Execute in main
+	}
+	runErr := cmd.RunE(cmd, args)
+	w.Close()
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runErr != nil {
+		t.Fatalf("%s %v failed: %v", cmd.Name(), args, runErr)
+	}
+	return string(output)
+}
+
+func TestCreateReadListDelete(t *testing.T) {
+	useMemoryStore(t)
+
+	runCommand(t, CreateCmd, "cmd-test/api_token", "s3cr3t")
+	if got := runCommand(t, ReadCmd, "cmd-test/api_token"); got != "s3cr3t\n" {
+		t.Fatalf("read printed %q, want %q", got, "s3cr3t\n")
+	}
+	if got := runCommand(t, ListCmd); !strings.Contains(got, "cmd-test/api_token\n") {
+		t.Fatalf("list output %q does not contain the created key", got)
+	}
+
+	runCommand(t, DeleteCmd, "cmd-test/api_token")
+	s, err := store.GetSecretStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("cmd-test/api_token"); !errors.Is(err, store.ErrSecretNotFound) {
+		t.Fatalf("secret still readable after delete: %v", err)
+	}
+}
+
+func TestListPrefixDepthAndTree(t *testing.T) {
+	useMemoryStore(t)
+	defer func() { listDepth, listTree = 0, false }()
+
+	for _, key := range []string{"cmd-list/prod/db/password", "cmd-list/prod/db/user", "cmd-list/prod/api", "cmd-list/production"} {
+		runCommand(t, CreateCmd, key, "s3cr3t")
+	}
+
+	want := "cmd-list/prod/api\ncmd-list/prod/db/password\ncmd-list/prod/db/user\n"
+	if got := runCommand(t, ListCmd, "cmd-list/prod/"); got != want {
+		t.Fatalf("list with prefix printed %q, want %q", got, want)
+	}
+
+	listDepth = 1
+	want = "cmd-list/prod/api\ncmd-list/prod/db/\n"
+	if got := runCommand(t, ListCmd, "cmd-list/prod"); got != want {
+		t.Fatalf("list --depth 1 printed %q, want %q", got, want)
+	}
+
+	listDepth, listTree = 0, true
+	want = "cmd-list/prod\n├── api\n└── db\n    ├── password\n    └── user\n"
+	if got := runCommand(t, ListCmd, "cmd-list/prod"); got != want {
+		t.Fatalf("list --tree printed %q, want %q", got, want)
+	}
+}
+
+func TestFilterKeys(t *testing.T) {
+	keys := []string{"prod", "prod/api", "prod/db/password", "prod_x", "staging/db/password"}
+	tests := []struct {
+		prefix, glob, regex string
+		want                []string
+	}{
+		{"", "", "", keys},
+		{"prod", "", "", []string{"prod", "prod/api", "prod/db/password"}},
+		{"", "*/db/*", "", []string{"prod/db/password", "staging/db/password"}},
+		{"", "", "^prod", []string{"prod", "prod/api", "prod/db/password", "prod_x"}},
+		{"prod", "", "pass", []string{"prod/db/password"}},
+	}
+	for _, tt := range tests {
+		var pattern *regexp.Regexp
+		if tt.regex != "" {
+			pattern = regexp.MustCompile(tt.regex)
+		}
+		if got := filterKeys(keys, tt.prefix, tt.glob, pattern); !slices.Equal(got, tt.want) {
+			t.Errorf("filterKeys(%q, %q, %q) = %q, want %q", tt.prefix, tt.glob, tt.regex, got, tt.want)
+		}
+	}
+}
+
+func TestCreateUpdate(t *testing.T) {
+	useMemoryStore(t)
+
+	runCommand(t, CreateCmd, "cmd-test/rotated", "old")
+	updateIfExists = true
+	defer func() { updateIfExists = false }()
+	runCommand(t, CreateCmd, "cmd-test/rotated", "new")
+
+	if got := runCommand(t, ReadCmd, "cmd-test/rotated"); got != "new\n" {
+		t.Fatalf("read printed %q, want %q", got, "new\n")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	useMemoryStore(t)
+
+	genNumbers = true
+	defer func() { genNumbers = false }()
+	runCommand(t, GenerateCmd, "cmd-test/pin", "6")
+
+	got := strings.TrimSuffix(runCommand(t, ReadCmd, "cmd-test/pin"), "\n")
+	if len(got) != 6 || strings.Trim(got, "0123456789") != "" {
+		t.Fatalf("generated value %q is not a 6 digit pin", got)
+	}
+}
+
+func TestCreateRecordsMetadata(t *testing.T) {
+	useMemoryStore(t)
+
+	CreateCmd.Flags().Set("desc", "Payment gateway token")
+	CreateCmd.Flags().Set("tag", "env=prod")
+	defer func() {
+		createDesc, createTags = "", nil
+		CreateCmd.Flags().Lookup("desc").Changed = false
+		CreateCmd.Flags().Lookup("tag").Changed = false
+	}()
+	runCommand(t, CreateCmd, "cmd-test/gateway", "tok")
+
+	infoOutput = "json"
+	defer func() { infoOutput = "text" }()
+	got := runCommand(t, InfoCmd, "cmd-test/gateway")
+	for _, want := range []string{`"description": "Payment gateway token"`, `"env": "prod"`, `"created_by": "` + currentUser() + `"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("info output %s does not contain %s", got, want)
+		}
+	}
+}
+
+func TestCreateIfRevision(t *testing.T) {
+	useMemoryStore(t)
+
+	runCommand(t, CreateCmd, "cmd-test/cas", "v1")
+	readOutput = "json"
+	defer func() { readOutput = "text" }()
+	if got := runCommand(t, ReadCmd, "cmd-test/cas"); !strings.Contains(got, `"revision": 1`) {
+		t.Fatalf("read --output json printed %s, want revision 1", got)
+	}
+
+	CreateCmd.Flags().Set("if-revision", "1")
+	defer func() {
+		ifRevision = 0
+		CreateCmd.Flags().Lookup("if-revision").Changed = false
+	}()
+	if err := CreateCmd.RunE(CreateCmd, []string{"cmd-test/cas", "v2"}); err == nil {
+		t.Fatal("create --if-revision without --update succeeded")
+	}
+	updateIfExists = true
+	defer func() { updateIfExists = false }()
+	runCommand(t, CreateCmd, "cmd-test/cas", "v2")
+
+	got := runCommand(t, ReadCmd, "cmd-test/cas")
+	if !strings.Contains(got, `"value": "v2"`) || !strings.Contains(got, `"revision": 2`) {
+		t.Fatalf("read --output json after compare-and-swap printed %s", got)
+	}
+
+	// A previous version has no revision to update from
+	ReadCmd.Flags().Set("version", "1")
+	defer func() {
+		readVersion = 0
+		ReadCmd.Flags().Lookup("version").Changed = false
+	}()
+	got = runCommand(t, ReadCmd, "cmd-test/cas")
+	if !strings.Contains(got, `"value": "v1"`) || strings.Contains(got, "revision") {
+		t.Fatalf("read --version 1 --output json printed %s, want v1 without a revision", got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	useMemoryStore(t)
+
+	runCommand(t, CreateCmd, "cmd-test/batch/legacy", "old")
+	runCommand(t, CreateCmd, "cmd-test/batch/password", "p1")
+	BatchCmd.SetIn(strings.NewReader(`
+- {op: create, key: cmd-test/batch/user, value: admin}
+- {op: upsert, key: cmd-test/batch/password, value: p2}
+- {op: upsert, key: cmd-test/batch/token, value: t1}
+- {op: delete, key: cmd-test/batch/legacy}
+`))
+	defer BatchCmd.SetIn(nil)
+	runCommand(t, BatchCmd)
+
+	for key, want := range map[string]string{"user": "admin", "password": "p2", "token": "t1"} {
+		if got := runCommand(t, ReadCmd, "cmd-test/batch/"+key); got != want+"\n" {
+			t.Errorf("read %s after batch printed %q, want %q", key, got, want+"\n")
+		}
+	}
+	if got := runCommand(t, ListCmd, "cmd-test/batch/"); strings.Contains(got, "legacy") {
+		t.Errorf("list output %q contains the key deleted by the batch", got)
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	entries, err := parseBatch(strings.NewReader(`[{"op": "create", "key": "a", "value": ""}, {"op": "delete", "key": "b"}]`))
+	if err != nil || len(entries) != 2 || entries[0].Op != "create" || entries[1].Key != "b" {
+		t.Fatalf("parseBatch of JSON = %+v, %v", entries, err)
+	}
+
+	for _, input := range []string{
+		"",
+		"- {op: create, key: a}",
+		"- {op: rename, key: a, value: b}",
+		"- {op: delete}",
+		"- {op: delete, key: a, comment: b}",
+	} {
+		if _, err := parseBatch(strings.NewReader(input)); err == nil {
+			t.Errorf("parseBatch(%q) succeeded", input)
+		}
+	}
+}
+
+func TestHistoryAndRollback(t *testing.T) {
+	useMemoryStore(t)
+
+	runCommand(t, CreateCmd, "cmd-test/rollback", "good")
+	updateIfExists = true
+	defer func() { updateIfExists = false }()
+	runCommand(t, CreateCmd, "cmd-test/rollback", "botched")
+
+	got := runCommand(t, HistoryCmd, "cmd-test/rollback")
+	if !strings.Contains(got, "2") || !strings.Contains(got, "(current)") || !strings.Contains(got, "\n1 ") {
+		t.Fatalf("history output %q does not list versions 2 (current) and 1", got)
+	}
+
+	ReadCmd.Flags().Set("version", "1")
+	got = runCommand(t, ReadCmd, "cmd-test/rollback")
+	readVersion = 0
+	ReadCmd.Flags().Lookup("version").Changed = false
+	if got != "good\n" {
+		t.Fatalf("read --version 1 printed %q, want %q", got, "good\n")
+	}
+
+	runCommand(t, RollbackCmd, "cmd-test/rollback")
+	if got := runCommand(t, ReadCmd, "cmd-test/rollback"); got != "good\n" {
+		t.Fatalf("read after rollback printed %q, want %q", got, "good\n")
+	}
+}
+
+func TestSoftDeleteRestore(t *testing.T) {
+	useMemoryStore(t)
+	store.SoftDelete = true
+	defer func() { store.SoftDelete = false }()
+
+	runCommand(t, CreateCmd, "cmd-test/trashed", "s3cr3t")
+	runCommand(t, DeleteCmd, "cmd-test/trashed")
+	if got := runCommand(t, TrashListCmd); !strings.Contains(got, "cmd-test/trashed") {
+		t.Fatalf("trash list output %q does not contain the deleted key", got)
+	}
+
+	runCommand(t, RestoreCmd, "cmd-test/trashed")
+	if got := runCommand(t, ReadCmd, "cmd-test/trashed"); got != "s3cr3t\n" {
+		t.Fatalf("read after restore printed %q, want %q", got, "s3cr3t\n")
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	useMemoryStore(t)
+	defer func() { store.Namespace = "" }()
+
+	store.Namespace = "cmd-test-payments"
+	runCommand(t, CreateCmd, "cmd-test/scoped", "payments")
+	if got := runCommand(t, ListCmd); !strings.Contains(got, "cmd-test/scoped\n") {
+		t.Fatalf("list output %q in namespace does not contain the created key", got)
+	}
+	if got := runCommand(t, NamespacesCmd); !strings.Contains(got, "* cmd-test-payments\n") {
+		t.Fatalf("namespaces output %q does not mark the selected namespace", got)
+	}
+
+	store.Namespace = ""
+	if got := runCommand(t, ListCmd); strings.Contains(got, "cmd-test/scoped") {
+		t.Fatalf("list output %q of default namespace contains a key of another namespace", got)
+	}
+	runCommand(t, CreateCmd, "cmd-test/scoped", "default")
+	if got := runCommand(t, ReadCmd, "cmd-test/scoped"); got != "default\n" {
+		t.Fatalf("read in default namespace printed %q, want %q", got, "default\n")
+	}
+}
+
+func TestCreateExpiresAndDue(t *testing.T) {
+	useMemoryStore(t)
+
+	CreateCmd.Flags().Set("expires", "10d")
+	defer func() {
+		createExpires = ""
+		CreateCmd.Flags().Lookup("expires").Changed = false
+	}()
+	runCommand(t, CreateCmd, "cmd-test/rotate-soon", "tok")
+
+	s, err := store.GetSecretStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	due, err := findDue(context.Background(), s, now, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].Key != "cmd-test/rotate-soon" || due[0].Expired {
+		t.Fatalf("findDue within 30 days = %+v, want only cmd-test/rotate-soon, not yet expired", due)
+	}
+	if due, _ := findDue(context.Background(), s, now, 24*time.Hour); len(due) != 0 {
+		t.Fatalf("findDue within 1 day = %+v, want none", due)
+	}
+	if due, _ := findDue(context.Background(), s, now.Add(11*24*time.Hour), 0); len(due) != 1 || !due[0].Expired {
+		t.Fatalf("findDue after expiry = %+v, want the secret marked expired", due)
+	}
+}
+
+func TestUpdateRenewsExpiry(t *testing.T) {
+	useMemoryStore(t)
+	s, err := store.GetSecretStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := func(key string) time.Time {
+		t.Helper()
+		md, err := s.(store.MetadataStore).ReadMetadata(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return md.ExpiresAt
+	}
+
+	defer func() {
+		createExpires, updateIfExists = "", false
+		CreateCmd.Flags().Lookup("expires").Changed = false
+		CreateCmd.Flags().Lookup("update").Changed = false
+	}()
+	CreateCmd.Flags().Set("expires", "10d")
+	runCommand(t, CreateCmd, "cmd-test/by-age", "v1")
+	CreateCmd.Flags().Set("expires", "2099-01-01")
+	runCommand(t, CreateCmd, "cmd-test/by-date", "v1")
+	createExpires = ""
+	CreateCmd.Flags().Lookup("expires").Changed = false
+
+	// Pretend the first one was created long ago
+	md, err := s.(store.MetadataStore).ReadMetadata("cmd-test/by-age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md.ExpiresAt = time.Now().Add(-24 * time.Hour)
+	if err := s.(store.MetadataStore).WriteMetadata("cmd-test/by-age", md); err != nil {
+		t.Fatal(err)
+	}
+
+	CreateCmd.Flags().Set("update", "true")
+	runCommand(t, CreateCmd, "cmd-test/by-age", "v2")
+	runCommand(t, CreateCmd, "cmd-test/by-date", "v2")
+	if got := expiresAt("cmd-test/by-age"); time.Until(got) < 9*24*time.Hour {
+		t.Fatalf("expiry after rotating a secret expiring in 10d = %v, want 10 days ahead", got)
+	}
+	if got := expiresAt("cmd-test/by-date"); !got.IsZero() {
+		t.Fatalf("expiry after rotating a secret with an expiry date = %v, want none", got)
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"90d", now.Add(90 * 24 * time.Hour)},
+		{"12h", now.Add(12 * time.Hour)},
+		{"2025-06-30T00:00:00Z", time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)},
+		{"never", time.Time{}},
+	}
+	for _, tt := range tests {
+		got, err := parseExpiry(tt.in, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseExpiry(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseExpiry("soon", now); err == nil {
+		t.Error("parseExpiry(\"soon\") succeeded, want an error")
+	}
+}
+
+func TestMigrateSecrets(t *testing.T) {
+	src, dst := store.NewMemoryStore(), store.NewMemoryStore()
+	for k, v := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		if err := src.Create(k, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.WriteMetadata("a", store.Metadata{Description: "copied"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Create("b", []byte("2")); err != nil { // Copied by an interrupted run
+		t.Fatal(err)
+	}
+	if err := dst.Create("c", []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var conflicts conflictError
+	if _, err := migrateSecrets(ctx, src, dst, migrateOptions{onConflict: "fail"}); !errors.As(err, &conflicts) || !slices.Equal(conflicts, []string{"c"}) {
+		t.Fatalf("migrate with conflict = %v, want conflict on c", err)
+	}
+	if _, err := dst.Read("a"); !errors.Is(err, store.ErrSecretNotFound) {
+		t.Fatalf("failed migration wrote secret a: %v", err)
+	}
+
+	result, err := migrateSecrets(ctx, src, dst, migrateOptions{onConflict: "skip"})
+	if err != nil {
+		t.Fatalf("migrate with skip failed: %v", err)
+	}
+	if result.copied != 1 || result.unchanged != 1 || result.skipped != 1 || result.verified != 2 {
+		t.Fatalf("migrate with skip = %+v, want 1 copied, 1 unchanged, 1 skipped", result)
+	}
+	if md, err := dst.ReadMetadata("a"); err != nil || md.Description != "copied" {
+		t.Fatalf("metadata of migrated secret = %+v, %v", md, err)
+	}
+
+	result, err = migrateSecrets(ctx, src, dst, migrateOptions{onConflict: "overwrite"})
+	if err != nil || result.overwritten != 1 || result.unchanged != 2 {
+		t.Fatalf("migrate with overwrite = %+v, %v", result, err)
+	}
+	if value, err := dst.Read("c"); err != nil || string(value) != "3" {
+		t.Fatalf("overwritten secret = %q, %v", value, err)
+	}
+}
+
+func TestMigrateSecretsReencrypt(t *testing.T) {
+	oldKey, newKey := make([]byte, key.SecretBoxKeySize), make([]byte, key.SecretBoxKeySize)
+	newKey[0] = 1
+	encrypted, err := crypto.Encrypt([]byte("s3cr3t"), oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, dst := store.NewMemoryStore(), store.NewMemoryStore()
+	if err := src.Create("k", encrypted); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := migrateOptions{onConflict: "fail", sourceKey: oldKey, targetKey: newKey}
+	for run := 1; run <= 2; run++ {
+		result, err := migrateSecrets(context.Background(), src, dst, opts)
+		if err != nil || result.verified != 1 {
+			t.Fatalf("run %d of re-encrypting migration = %+v, %v", run, result, err)
+		}
+	}
+	value, err := dst.Read("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := crypto.Decrypt(value, newKey); err != nil || string(plaintext) != "s3cr3t" {
+		t.Fatalf("re-encrypted secret decrypts to %q, %v", plaintext, err)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	useMemoryStore(t)
+	dir := t.TempDir()
+	t.Setenv("HOME", dir) // No config file
+	previousPath, previousCache, previousNoCache := store.JsonFilePath, store.CacheDir, store.NoCache
+	store.BackendType, store.JsonFilePath, store.CacheDir = "jsonfile", filepath.Join(dir, "secrets.json"), filepath.Join(dir, "cache")
+	t.Cleanup(func() {
+		store.JsonFilePath, store.CacheDir, store.NoCache = previousPath, previousCache, previousNoCache
+	})
+	runCommand(t, CreateCmd, "doctor/a", "1")
+	runCommand(t, CreateCmd, "doctor/b", "2")
+
+	statuses := func(report doctorReport) map[string]string {
+		m := make(map[string]string)
+		for _, c := range report.Checks {
+			m[c.Name] = c.Status
+		}
+		return m
+	}
+	report := runDoctor(context.Background(), nil, 5)
+	if got := statuses(report); !report.Healthy || got["key"] != checkOK || got["backend"] != checkOK || got["decryption"] != checkOK {
+		t.Fatalf("doctor of a healthy store = %+v", report)
+	}
+
+	otherKey, err := key.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(key.EnvKeyName, otherKey)
+	if report := runDoctor(context.Background(), nil, 5); report.Healthy || statuses(report)["decryption"] != checkFailed {
+		t.Fatalf("doctor with the wrong key = %+v", report)
+	}
+
+	t.Setenv(key.EnvKeyName, "")
+	report = runDoctor(context.Background(), nil, 5)
+	if got := statuses(report); report.Healthy || got["key"] != checkFailed || got["decryption"] != checkSkipped {
+		t.Fatalf("doctor without a key = %+v", report)
+	}
+}
+
+func TestImportPassEntries(t *testing.T) {
+	useMemoryStore(t)
+	runCommand(t, CreateCmd, "cmd-test/pass/existing", "kept")
+
+	s, err := store.GetSecretStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptionKey, err := key.LoadKeyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintexts := map[string]string{
+		"/store/cmd-test/pass/email.gpg":    "hunter2\nuser: alice\n",
+		"/store/cmd-test/pass/existing.gpg": "replaced\n",
+	}
+	decrypt := func(path string) ([]byte, error) {
+		plaintext, ok := plaintexts[path]
+		if !ok {
+			return nil, errors.New("no such file")
+		}
+		return []byte(plaintext), nil
+	}
+	entries := []pass.Entry{
+		{Key: "cmd-test/pass/email", Path: "/store/cmd-test/pass/email.gpg"},
+		{Key: "cmd-test/pass/existing", Path: "/store/cmd-test/pass/existing.gpg"},
+	}
+
+	passFirstLine = true
+	defer func() { passFirstLine = false }()
+	imported, skipped, err := importPassEntries(context.Background(), s, entries, decrypt, encryptionKey)
+	if err != nil || imported != 1 || skipped != 1 {
+		t.Fatalf("importPassEntries = %d imported, %d skipped, %v; want 1 and 1", imported, skipped, err)
+	}
+	if got := runCommand(t, ReadCmd, "cmd-test/pass/email"); got != "hunter2\n" {
+		t.Fatalf("imported entry reads %q, want its first line", got)
+	}
+	if got := runCommand(t, ReadCmd, "cmd-test/pass/existing"); got != "kept\n" {
+		t.Fatalf("existing secret reads %q after import, want it kept", got)
+	}
+
+	// With --update existing secrets are replaced, keeping the whole entry
+	passFirstLine, passUpdateIfExists = false, true
+	defer func() { passUpdateIfExists = false }()
+	if _, _, err := importPassEntries(context.Background(), s, entries, decrypt, encryptionKey); err != nil {
+		t.Fatal(err)
+	}
+	if got := runCommand(t, ReadCmd, "cmd-test/pass/existing"); got != "replaced\n" {
+		t.Fatalf("existing secret reads %q after import --update, want %q", got, "replaced\n")
+	}
+
+	// A failing decryption stops the import
+	entries = append(entries, pass.Entry{Key: "cmd-test/pass/broken", Path: "/store/broken.gpg"})
+	if _, _, err := importPassEntries(context.Background(), s, entries, decrypt, encryptionKey); err == nil {
+		t.Fatal("importPassEntries with an undecryptable entry succeeded")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var compactOutput string
+
+var CompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Compact the journal of the JSON file",
+	Long: `With --json-format journal every change of the jsonfile backend is appended
+to the file as one signed record, and the journal is compacted into one record
+per secret once it holds 1000 records more than it has secrets. compact does so
+right away, for example before committing the file to git.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if compactOutput != "text" && compactOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", compactOutput)
+		}
+		// Compact the file itself rather than the cache in front of it
+		store.NoCache = true
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		cs, err := store.AsCompactableStore(s)
+		if err != nil {
+			return err
+		}
+		stats, err := cs.Compact()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compact journal: %v\n", err)
+			os.Exit(1)
+		}
+
+		if compactOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(stats)
+		}
+		fmt.Printf("Compacted journal from %d to %d records.\n", stats.RecordsBefore, stats.RecordsAfter)
+		return nil
+	},
+}
+
+func init() {
+	CompactCmd.Flags().StringVarP(&compactOutput, "output", "o", "text", "Output format (text, json)")
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/user"
+	"time"
 
 	"secrets-cli/internal/crypto" // Adjust import path
 	"secrets-cli/internal/key"    // Adjust import path
@@ -11,13 +14,31 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var updateIfExists bool
+var (
+	updateIfExists bool
+	createDesc     string
+	createTags     map[string]string
+	createExpires  string
+	ifRevision     int64
+)
 
 var CreateCmd = &cobra.Command{
 	Use:     "create [key] [value]",
 	Short:   "Create a new secret",
 	Aliases: []string{"add", "new", "save", "set"},
-	Long:    `Creates a new encrypted secret with the given key and value.`,
+	Long: `Creates a new encrypted secret with the given key and value.
+
+The secret's metadata records who created it and when. Use --desc and --tag
+to describe it; with --update they replace the description and merge the tags
+(an empty tag value removes the tag). --expires sets the date by which the
+secret must be rotated, either as an age such as 90d or as a date such as
+2025-12-31; "never" clears it. An update without --expires counts as a
+rotation: an expiry given as an age moves that far ahead again, and one given
+as a date is cleared.
+
+With --update --if-revision N the secret is only updated if it is still at
+revision N (see 'info' or 'read --output json'); otherwise create exits with
+status 2 and leaves the secret unchanged.`,
 	Args:    cobra.ExactArgs(2), // Require exactly two arguments
 	RunE: func(cmd *cobra.Command, args []string) error {
 		createKey := args[0]
@@ -25,13 +46,19 @@ var CreateCmd = &cobra.Command{
 		if createKey == "" || createValue == "" {
 			return fmt.Errorf("both key and value arguments are required")
 		}
+		if err := checkExpiresFlag(cmd); err != nil {
+			return err
+		}
+		if err := checkIfRevisionFlag(cmd, updateIfExists); err != nil {
+			return err
+		}
 
 		encryptionKey, err := key.LoadKeyFromEnv()
 		if err != nil {
 			return fmt.Errorf("failed to load encryption key: %w", err)
 		}
 
-		s, err := store.GetSecretStore()
+		s, err := store.OpenStore(cmd.Context())
 		if err != nil {
 			return fmt.Errorf("failed to get store: %w", err)
 		}
@@ -41,9 +68,17 @@ var CreateCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to encrypt value: %w", err)
 		}
+		edit, err := metadataEdit(cmd, s, !updateIfExists)
+		if err != nil {
+			return fmt.Errorf("failed to record metadata: %w", err)
+		}
 
 		if updateIfExists {
-			err = s.Update(createKey, encryptedValue)
+			err = updateValue(cmd, s, createKey, encryptedValue, edit)
+			if errors.Is(err, store.ErrRevisionMismatch) {
+				fmt.Fprintf(os.Stderr, "secret not updated: %v\n", err)
+				os.Exit(2)
+			}
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "failed to update secret in store: %v\n", err)
 				os.Exit(1)
@@ -52,7 +87,7 @@ var CreateCmd = &cobra.Command{
 			return nil
 		}
 
-		err = s.Create(createKey, encryptedValue)
+		err = createSecret(cmd, s, createKey, encryptedValue, edit)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to create secret in store: %v\n", err)
 			os.Exit(1)
@@ -63,6 +98,156 @@ var CreateCmd = &cobra.Command{
 	},
 }
 
+// metadataEdit returns the change that records the creator and the
+// --desc/--tag/--expires values of cmd on a secret being written. An update
+// without --expires rotates the secret: an expiry set as an age moves that
+// far ahead again, and one set as a date is cleared. Backends without
+// metadata are skipped unless the user asked for a description, tags or an
+// expiry date, which fails before anything is written.
+func metadataEdit(cmd *cobra.Command, s store.SecretStore, created bool) (store.MetadataEdit, error) {
+	descChanged := cmd.Flags().Changed("desc")
+	tagsChanged := cmd.Flags().Changed("tag")
+	expiresChanged := cmd.Flags().Changed("expires")
+
+	var expiresAt time.Time
+	if expiresChanged {
+		var err error
+		if expiresAt, err = parseExpiry(createExpires, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := s.(store.MetadataStore); !ok {
+		if descChanged || tagsChanged || expiresChanged {
+			_, err := store.AsMetadataStore(s)
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	var createdBy string
+	if created {
+		createdBy = currentUser()
+	}
+	return func(md *store.Metadata) {
+		if created {
+			md.CreatedBy = createdBy
+		}
+		if descChanged {
+			md.Description = createDesc
+		}
+		if tagsChanged {
+			if md.Tags == nil {
+				md.Tags = make(map[string]string)
+			}
+			for k, v := range createTags {
+				if v == "" {
+					delete(md.Tags, k)
+				} else {
+					md.Tags[k] = v
+				}
+			}
+		}
+		if expiresChanged {
+			md.ExpiresAt, md.RotateEvery = expiresAt, rotationInterval(createExpires)
+		} else if !created {
+			md.ExpiresAt = nextExpiry(md.RotateEvery, time.Now())
+		}
+	}, nil
+}
+
+// rotationInterval returns the --expires value to record as the secret's
+// rotation interval: the value itself if it is an age, else "".
+func rotationInterval(expires string) string {
+	if _, err := parseAge(expires); err != nil {
+		return ""
+	}
+	return expires
+}
+
+// nextExpiry returns the expiry date of a secret rotated at now: one rotation
+// interval ahead, or none if the secret has no interval.
+func nextExpiry(rotateEvery string, now time.Time) time.Time {
+	age, err := parseAge(rotateEvery)
+	if rotateEvery == "" || err != nil {
+		return time.Time{}
+	}
+	return now.Add(age).UTC()
+}
+
+// createSecret creates a secret together with the metadata changes of edit.
+func createSecret(cmd *cobra.Command, s store.SecretStore, key string, encryptedValue []byte, edit store.MetadataEdit) error {
+	return store.RunContext(cmd.Context(), s, func() error {
+		return store.CreateWithMetadata(s, key, encryptedValue, edit)
+	})
+}
+
+// updateValue updates a secret together with the metadata changes of edit;
+// with --if-revision only if the secret is still at that revision.
+func updateValue(cmd *cobra.Command, s store.SecretStore, key string, encryptedValue []byte, edit store.MetadataEdit) error {
+	var expectedRevision int64 // Any revision
+	if cmd.Flags().Changed("if-revision") {
+		expectedRevision = ifRevision
+	}
+	return store.RunContext(cmd.Context(), s, func() error {
+		return store.UpdateWithMetadata(s, key, expectedRevision, encryptedValue, edit)
+	})
+}
+
+// checkIfRevisionFlag validates --if-revision before anything is written.
+func checkIfRevisionFlag(cmd *cobra.Command, update bool) error {
+	if !cmd.Flags().Changed("if-revision") {
+		return nil
+	}
+	if !update {
+		return fmt.Errorf("--if-revision requires --update")
+	}
+	if ifRevision < 1 {
+		return fmt.Errorf("invalid revision %d (revisions start at 1)", ifRevision)
+	}
+	return nil
+}
+
+// checkExpiresFlag validates --expires before anything is written.
+func checkExpiresFlag(cmd *cobra.Command) error {
+	if !cmd.Flags().Changed("expires") {
+		return nil
+	}
+	_, err := parseExpiry(createExpires, time.Now())
+	return err
+}
+
+// parseExpiry parses an --expires value: "never", a date (2006-01-02 or
+// RFC 3339) or an age relative to now such as 90d or 720h.
+func parseExpiry(s string, now time.Time) (time.Time, error) {
+	if s == "never" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	age, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry '%s' (expected an age such as 90d, a date such as 2025-12-31, or never)", s)
+	}
+	return now.Add(age).UTC(), nil
+}
+
+// currentUser returns the login name recorded as a secret's creator.
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
 func init() {
 	CreateCmd.Flags().BoolVar(&updateIfExists, "update", false, "Update the secret if it already exists")
+	CreateCmd.Flags().StringVar(&createDesc, "desc", "", "Description of the secret")
+	CreateCmd.Flags().StringToStringVar(&createTags, "tag", nil, "Tag the secret, as key=value (repeatable)")
+	CreateCmd.Flags().Int64Var(&ifRevision, "if-revision", 0, "With --update, only update if the secret is still at this revision")
+	CreateCmd.Flags().StringVar(&createExpires, "expires", "", "Rotate-by date, as an age (90d) or date (2025-12-31); never clears it")
 }
@@ -15,7 +15,8 @@ import (
 var DeleteCmd = &cobra.Command{
 	Use:   "delete [key]",
 	Short: "Delete a secret by its key",
-	Long:  `Deletes a secret and its encrypted value based on its key.`,
+	Long: `Deletes a secret and its encrypted value based on its key.
+With --soft-delete the secret is moved to the trash and can be restored.`,
 	Args:  cobra.ExactArgs(1), // Require exactly one argument
 	RunE: func(cmd *cobra.Command, args []string) error {
 		deleteKey := args[0]
@@ -31,7 +32,7 @@ var DeleteCmd = &cobra.Command{
 		}
 
 		// Get the selected store backend
-		s, err := store.GetSecretStore()
+		s, err := store.OpenStore(cmd.Context())
 		if err != nil {
 			return fmt.Errorf("failed to get store: %w", err)
 		}
@@ -42,7 +43,15 @@ var DeleteCmd = &cobra.Command{
 		}() // Ensure store is closed
 
 		// Use the store interface to delete the secret
-		err = s.Delete(deleteKey)
+		if store.SoftDelete {
+			ts, tsErr := store.AsTrashStore(s)
+			if tsErr != nil {
+				return tsErr
+			}
+			err = ts.Trash(deleteKey)
+		} else {
+			err = store.NewContextStore(s).Delete(cmd.Context(), deleteKey)
+		}
 		if errors.Is(err, store.ErrSecretNotFound) {
 			fmt.Fprintf(os.Stderr, "secret with key '%s' not found\n", deleteKey)
 			os.Exit(1)
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	doctorOutput string
+	doctorSample int
+)
+
+// Statuses of a doctor check.
+const (
+	checkOK      = "ok"
+	checkWarning = "warning"
+	checkFailed  = "failed"
+	checkSkipped = "skipped"
+)
+
+// doctorCheck is the result of one check of the doctor command.
+type doctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// doctorReport is the machine-readable output of the doctor command.
+type doctorReport struct {
+	Healthy bool          `json:"healthy"`
+	Checks  []doctorCheck `json:"checks"`
+}
+
+var DoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration, key and store for problems",
+	Long: `Checks that the config file is valid, the encryption key is set and has the
+right length, the files of the store are readable only by their owner, the
+backend can be opened, and the key decrypts a sample of the secrets. Prints
+how to fix each problem found. Exits with status 2 if a check failed;
+warnings don't change the exit status.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if doctorOutput != "text" && doctorOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", doctorOutput)
+		}
+		if doctorSample < 0 {
+			return fmt.Errorf("invalid sample size %d", doctorSample)
+		}
+
+		report := runDoctor(cmd.Context(), configErr, doctorSample)
+		if doctorOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				return err
+			}
+		} else {
+			for _, c := range report.Checks {
+				fmt.Printf("%-8s %s: %s\n", c.Status, c.Name, c.Message)
+				if c.Fix != "" {
+					fmt.Printf("%-8s fix: %s\n", "", c.Fix)
+				}
+			}
+		}
+
+		if !report.Healthy {
+			os.Exit(2)
+		}
+		return nil
+	},
+}
+
+// runDoctor runs every check in turn. loadErr is the error loading the
+// config file, if any; sample is the number of secrets to decrypt.
+func runDoctor(ctx context.Context, loadErr error, sample int) doctorReport {
+	report := doctorReport{Healthy: true}
+	add := func(c doctorCheck) {
+		report.Checks = append(report.Checks, c)
+		if c.Status == checkFailed {
+			report.Healthy = false
+		}
+	}
+
+	add(checkConfig(loadErr))
+	keyCheck, encryptionKey := checkKey()
+	add(keyCheck)
+	add(checkPermissions())
+	backendCheck, s := checkBackend(ctx)
+	add(backendCheck)
+	if s != nil {
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+	}
+	add(checkDecryption(ctx, s, encryptionKey, sample))
+	return report
+}
+
+// checkConfig checks that the config file, if there is one, is valid JSON
+// that only holds known fields.
+func checkConfig(loadErr error) doctorCheck {
+	c := doctorCheck{Name: "config"}
+	path, err := store.ConfigPath()
+	if err != nil {
+		c.Status, c.Message = checkSkipped, fmt.Sprintf("no home directory to find the config file in: %v", err)
+		return c
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.Status, c.Message = checkOK, fmt.Sprintf("no config file at %s, using flags and defaults", path)
+		return c
+	}
+	if err != nil {
+		c.Status, c.Message = checkFailed, fmt.Sprintf("can't read %s: %v", path, err)
+		c.Fix = fmt.Sprintf("Make %s readable by your user, or remove it to use the defaults", path)
+		return c
+	}
+	if loadErr != nil {
+		c.Status, c.Message = checkFailed, fmt.Sprintf("%s is invalid: %v", path, loadErr)
+		c.Fix = fmt.Sprintf("Correct %s as the error says, or move it aside to use the defaults", path)
+		return c
+	}
+
+	// Misspelled fields are ignored when loading the config
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	var cfg store.StoreConfig
+	if err := decoder.Decode(&cfg); err != nil {
+		c.Status, c.Message = checkWarning, fmt.Sprintf("%s has a field secrets-cli ignores: %v", path, err)
+		c.Fix = "Correct or remove the field; the Readme lists the fields of the config file"
+		return c
+	}
+	c.Status, c.Message = checkOK, fmt.Sprintf("%s is valid", path)
+	return c
+}
+
+// checkKey checks that the encryption key is set and decodes to a full key.
+// It returns the key as the commands use it, or nil if there is none.
+func checkKey() (doctorCheck, []byte) {
+	c := doctorCheck{Name: "key"}
+	encoded := os.Getenv(key.EnvKeyName)
+	if encoded == "" {
+		c.Status, c.Message = checkFailed, fmt.Sprintf("%s is not set", key.EnvKeyName)
+		c.Fix = fmt.Sprintf("Set %s to the base64 key the secrets were created with, or to a new one from: head -c 32 /dev/urandom | base64", key.EnvKeyName)
+		return c, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		c.Status, c.Message = checkFailed, fmt.Sprintf("%s is not valid base64: %v", key.EnvKeyName, err)
+		c.Fix = fmt.Sprintf("Set %s to the base64 encoding of the key, without line breaks", key.EnvKeyName)
+		return c, nil
+	}
+	encryptionKey, err := key.LoadKeyFromEnv()
+	if err != nil {
+		c.Status, c.Message = checkFailed, err.Error()
+		return c, nil
+	}
+
+	switch {
+	case len(decoded) < key.SecretBoxKeySize:
+		c.Status = checkWarning
+		c.Message = fmt.Sprintf("%s decodes to %d bytes, padded with zeros to %d, which weakens it",
+			key.EnvKeyName, len(decoded), key.SecretBoxKeySize)
+	case len(decoded) > key.SecretBoxKeySize:
+		c.Status = checkWarning
+		c.Message = fmt.Sprintf("%s decodes to %d bytes, only the first %d are used",
+			key.EnvKeyName, len(decoded), key.SecretBoxKeySize)
+	default:
+		c.Status, c.Message = checkOK, fmt.Sprintf("%s holds a %d-byte key", key.EnvKeyName, key.SecretBoxKeySize)
+		return c, encryptionKey
+	}
+	c.Fix = fmt.Sprintf("Move the secrets to a new store encrypted with a random %d-byte key with migrate --to --reencrypt-key-env", key.SecretBoxKeySize)
+	return c, encryptionKey
+}
+
+// checkPermissions checks that the config file and the files of the store
+// can't be read by other users.
+func checkPermissions() doctorCheck {
+	c := doctorCheck{Name: "permissions"}
+	if runtime.GOOS == "windows" {
+		c.Status, c.Message = checkSkipped, "file permissions are not checked on Windows"
+		return c
+	}
+
+	paths := store.StoreFiles()
+	if path, err := store.ConfigPath(); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			paths = append([]string{path}, paths...)
+		}
+	}
+	var open []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err == nil && info.Mode().Perm()&0077 != 0 {
+			open = append(open, path)
+		}
+	}
+
+	switch {
+	case len(paths) == 0:
+		c.Status, c.Message = checkOK, "no local files to check"
+	case len(open) == 0:
+		c.Status, c.Message = checkOK, fmt.Sprintf("all %d local files are only accessible by their owner", len(paths))
+	default:
+		c.Status = checkWarning
+		c.Message = "accessible by other users: " + strings.Join(open, ", ")
+		c.Fix = "chmod go-rwx " + strings.Join(open, " ")
+	}
+	return c
+}
+
+// checkBackend opens the configured store, bypassing the cache. It returns
+// the store if it could be opened.
+func checkBackend(ctx context.Context) (doctorCheck, store.SecretStore) {
+	c := doctorCheck{Name: "backend"}
+	if store.BackendType == "" && store.Overlay == "" {
+		c.Status, c.Message = checkFailed, "no backend selected"
+		c.Fix = "Select a backend with --backend or backend_type in the config file"
+		return c, nil
+	}
+	store.NoCache = true // Check the backend itself
+	s, err := store.OpenStore(ctx)
+	if err != nil {
+		c.Status, c.Message, c.Fix = checkFailed, err.Error(), backendFix(err)
+		return c, nil
+	}
+	c.Status = checkOK
+	c.Message = fmt.Sprintf("opened the %s store", store.BackendType)
+	if store.Overlay != "" {
+		c.Message = fmt.Sprintf("opened overlay %s", store.Overlay)
+	}
+	return c, s
+}
+
+// backendFix suggests how to fix err opening the store.
+func backendFix(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Check that the backend is reachable, or allow it more time with --timeout"
+	case errors.Is(err, store.ErrLockTimeout):
+		return "Another secrets-cli process holds the store lock; wait for it to finish or raise --lock-timeout"
+	case errors.Is(err, store.ErrUnsupportedFormat):
+		return "The store was written by a newer secrets-cli; upgrade secrets-cli"
+	case errors.Is(err, fs.ErrPermission):
+		return "Make the store files and their directory accessible by your user"
+	case errors.Is(err, store.ErrInvalidConfiguration), errors.Is(err, store.ErrNotSupported):
+		return "Check the backend flags and the config file, such as the path of the store"
+	case strings.Contains(err.Error(), "unknown backend type"):
+		return fmt.Sprintf("Select one of the backends %s, or install the plugin on PATH",
+			strings.Join(store.Backends(), ", "))
+	default:
+		return "Check that the flags and the config file select the intended store and that it is reachable"
+	}
+}
+
+// checkDecryption reads up to sample secrets of s, spread over its sorted
+// keys, and checks that encryptionKey decrypts them.
+func checkDecryption(ctx context.Context, s store.SecretStore, encryptionKey []byte, sample int) doctorCheck {
+	c := doctorCheck{Name: "decryption"}
+	switch {
+	case sample == 0:
+		c.Status, c.Message = checkSkipped, "no secrets sampled"
+		return c
+	case s == nil || encryptionKey == nil:
+		c.Status, c.Message = checkSkipped, "needs the key and the backend"
+		return c
+	}
+
+	var keys []string
+	err := store.RunContext(ctx, s, func() (err error) {
+		keys, err = s.ListKeys()
+		return err
+	})
+	if err != nil {
+		c.Status, c.Message, c.Fix = checkFailed, fmt.Sprintf("failed to list secrets: %v", err), backendFix(err)
+		return c
+	}
+	if len(keys) == 0 {
+		c.Status, c.Message = checkOK, "no secrets to decrypt"
+		return c
+	}
+	keys = slices.Clone(keys)
+	slices.Sort(keys)
+	sampled := keys
+	if len(keys) > sample {
+		sampled = make([]string, sample)
+		for i := range sampled {
+			sampled[i] = keys[i*len(keys)/sample]
+		}
+	}
+
+	var failed []string
+	for _, k := range sampled {
+		value, err := store.NewContextStore(s).Read(ctx, k)
+		if err == nil {
+			_, err = crypto.Decrypt(value, encryptionKey)
+		}
+		if err != nil {
+			failed = append(failed, k)
+		}
+	}
+
+	switch {
+	case len(failed) == 0:
+		c.Status, c.Message = checkOK, fmt.Sprintf("the key decrypts all %d sampled secrets", len(sampled))
+	case len(failed) == len(sampled):
+		c.Status = checkFailed
+		c.Message = fmt.Sprintf("the key decrypts none of %d sampled secrets", len(sampled))
+		c.Fix = fmt.Sprintf("%s is not the key the secrets were created with; set it to that key", key.EnvKeyName)
+	default:
+		c.Status = checkFailed
+		c.Message = fmt.Sprintf("the key fails to decrypt %d of %d sampled secrets: %s",
+			len(failed), len(sampled), strings.Join(failed, ", "))
+		c.Fix = "Those secrets were written with another key; read them with that key and update them, or recreate them"
+	}
+	return c
+}
+
+func init() {
+	DoctorCmd.Flags().StringVarP(&doctorOutput, "output", "o", "text", "Output format (text, json)")
+	DoctorCmd.Flags().IntVar(&doctorSample, "sample", 5, "Number of secrets to decrypt with the key (0 skips the check)")
+}
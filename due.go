@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	dueWithin string
+	dueOutput string
+)
+
+// dueSecret is the machine-readable form of a secret that is due for rotation.
+type dueSecret struct {
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Expired   bool      `json:"expired"`
+}
+
+var DueCmd = &cobra.Command{
+	Use:   "due [--within age]",
+	Short: "List secrets that are expired or due for rotation",
+	Long: `Lists the secrets whose expiry date has passed or falls within the given
+window (30 days by default), soonest first. Exits with status 2 if any secret is
+listed, so the command can drive alerts from cron.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if dueOutput != "text" && dueOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", dueOutput)
+		}
+		within, err := parseAge(dueWithin)
+		if err != nil {
+			return err
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		due, err := findDue(cmd.Context(), s, time.Now(), within)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to check expiry dates: %v\n", err)
+			os.Exit(1)
+		}
+
+		if dueOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(due); err != nil {
+				return err
+			}
+		} else if len(due) == 0 {
+			fmt.Printf("No secrets expire within %s.\n", dueWithin)
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tEXPIRES\tSTATUS")
+			for _, d := range due {
+				status := "expired"
+				if !d.Expired {
+					status = fmt.Sprintf("due in %d days", int(math.Ceil(time.Until(d.ExpiresAt).Hours()/24)))
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", d.Key, formatTime(d.ExpiresAt), status)
+			}
+			w.Flush()
+		}
+
+		if len(due) > 0 {
+			os.Exit(2)
+		}
+		return nil
+	},
+}
+
+// findDue returns the secrets that expire before now+within, soonest first.
+func findDue(ctx context.Context, s store.SecretStore, now time.Time, within time.Duration) ([]dueSecret, error) {
+	var all map[string]store.Metadata
+	err := store.RunContext(ctx, s, func() (err error) {
+		all, err = store.ListMetadata(s)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	due := []dueSecret{}
+	for key, md := range all {
+		if md.ExpiresAt.IsZero() || md.ExpiresAt.After(now.Add(within)) {
+			continue
+		}
+		due = append(due, dueSecret{Key: key, ExpiresAt: md.ExpiresAt, Expired: md.Expired(now)})
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].ExpiresAt.Equal(due[j].ExpiresAt) {
+			return due[i].ExpiresAt.Before(due[j].ExpiresAt)
+		}
+		return due[i].Key < due[j].Key
+	})
+	return due, nil
+}
+
+func init() {
+	DueCmd.Flags().StringVar(&dueWithin, "within", "30d", "Also list secrets expiring within this window (e.g. 30d, 12h)")
+	DueCmd.Flags().StringVarP(&dueOutput, "output", "o", "text", "Output format (text, json)")
+}
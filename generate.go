@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"os"
 
@@ -38,6 +39,12 @@ and stores it as a secret under the given key.`,
 		if length <= 0 {
 			return fmt.Errorf("password length must be positive")
 		}
+		if err := checkIfRevisionFlag(cmd, genUpdateIfExists); err != nil {
+			return err
+		}
+		if err := checkExpiresFlag(cmd); err != nil {
+			return err
+		}
 
 		charset := ""
 		if genUppercase {
@@ -63,7 +70,7 @@ and stores it as a secret under the given key.`,
 			return fmt.Errorf("failed to load encryption key: %w", err)
 		}
 
-		s, err := store.GetSecretStore()
+		s, err := store.OpenStore(cmd.Context())
 		if err != nil {
 			return fmt.Errorf("failed to get store: %w", err)
 		}
@@ -73,9 +80,17 @@ and stores it as a secret under the given key.`,
 		if err != nil {
 			return fmt.Errorf("failed to encrypt password: %w", err)
 		}
+		edit, err := metadataEdit(cmd, s, !genUpdateIfExists)
+		if err != nil {
+			return fmt.Errorf("failed to record metadata: %w", err)
+		}
 
 		if genUpdateIfExists {
-			err = s.Update(createKey, encryptedValue)
+			err = updateValue(cmd, s, createKey, encryptedValue, edit)
+			if errors.Is(err, store.ErrRevisionMismatch) {
+				fmt.Fprintf(os.Stderr, "secret not updated: %v\n", err)
+				os.Exit(2)
+			}
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "failed to update secret in store: %v\n", err)
 				os.Exit(1)
@@ -83,7 +98,7 @@ and stores it as a secret under the given key.`,
 			return nil
 		}
 
-		err = s.Create(createKey, encryptedValue)
+		err = createSecret(cmd, s, createKey, encryptedValue, edit)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to create secret in store: %v\n", err)
 			os.Exit(1)
@@ -119,4 +134,6 @@ func init() {
 	GenerateCmd.Flags().BoolVarP(&genLowercase, "lowercase", "l", false, "Include lowercase letters")
 	GenerateCmd.Flags().BoolVarP(&genNumbers, "numbers", "n", false, "Include numbers")
 	GenerateCmd.Flags().BoolVar(&genUpdateIfExists, "update", false, "Update the secret if it already exists")
+	GenerateCmd.Flags().Int64Var(&ifRevision, "if-revision", 0, "With --update, only update if the secret is still at this revision")
+	GenerateCmd.Flags().StringVar(&createExpires, "expires", "", "Rotate-by date, as an age (90d) or date (2025-12-31); never clears it")
 }
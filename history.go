@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var historyOutput string
+
+// versionInfo is the machine-readable form of one version of a secret.
+type versionInfo struct {
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history [key]",
+	Short: "List the versions of a secret",
+	Long: `Lists the current and the retained previous versions of a secret, newest
+first. Previous versions can be read with 'read --version' and restored with
+'rollback'. The values are not decrypted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		historyKey := args[0]
+		if historyKey == "" {
+			return fmt.Errorf("key argument is required")
+		}
+		if historyOutput != "text" && historyOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", historyOutput)
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		vs, err := store.AsVersionedStore(s)
+		if err != nil {
+			return err
+		}
+
+		md, err := vs.ReadMetadata(historyKey)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			fmt.Fprintf(os.Stderr, "secret with key '%s' not found\n", historyKey)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read metadata from store: %v\n", err)
+			os.Exit(1)
+		}
+		previous, err := vs.ListVersions(historyKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read history from store: %v\n", err)
+			os.Exit(1)
+		}
+
+		versions := []versionInfo{{Version: max(md.Version, 1), CreatedAt: md.UpdatedAt, Current: true}}
+		for _, v := range previous {
+			versions = append(versions, versionInfo{Version: v.Version, CreatedAt: v.CreatedAt})
+		}
+
+		if historyOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(versions)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tCREATED\t")
+		for _, v := range versions {
+			current := ""
+			if v.Current {
+				current = "(current)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", v.Version, formatTime(v.CreatedAt), current)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	HistoryCmd.Flags().StringVarP(&historyOutput, "output", "o", "text", "Output format (text, json)")
+}
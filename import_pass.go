@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+	"secrets-cli/internal/pass"
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	passGPGBinary      string
+	passFirstLine      bool
+	passUpdateIfExists bool
+)
+
+var ImportPassCmd = &cobra.Command{
+	Use:   "import-pass [password-store-dir]",
+	Short: "Import secrets from a pass password-store",
+	Long: `Decrypts every entry of a pass (password-store) tree with the local gpg binary
+and stores it as a secret in the selected backend. Entry paths such as
+email/work.gpg become keys such as email/work.
+
+The store directory defaults to $PASSWORD_STORE_DIR or ~/.password-store.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storeDir, err := pass.DefaultStoreDir()
+		if err != nil {
+			return fmt.Errorf("failed to locate password store: %w", err)
+		}
+		if len(args) == 1 {
+			storeDir = args[0]
+		}
+
+		encryptionKey, err := key.LoadKeyFromEnv()
+		if err != nil {
+			return fmt.Errorf("failed to load encryption key: %w", err)
+		}
+
+		entries, err := pass.ListEntries(storeDir)
+		if err != nil {
+			return err
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		decrypt := func(path string) ([]byte, error) { return pass.Decrypt(passGPGBinary, path) }
+		imported, skipped, err := importPassEntries(cmd.Context(), s, entries, decrypt, encryptionKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Imported %d secrets from '%s' (%d skipped).\n", imported, storeDir, skipped)
+		return nil
+	},
+}
+
+func init() {
+	ImportPassCmd.Flags().StringVar(&passGPGBinary, "gpg", "gpg", "Path to the gpg binary used for decryption")
+	ImportPassCmd.Flags().BoolVar(&passFirstLine, "first-line", false, "Import only the first line (the password) of each entry")
+	ImportPassCmd.Flags().BoolVar(&passUpdateIfExists, "update", false, "Update secrets that already exist in the store")
+}
+
+// importPassEntries decrypts entries with decrypt and stores them in s under
+// their keys. Existing secrets are skipped unless --update is set.
+func importPassEntries(ctx context.Context, s store.SecretStore, entries []pass.Entry,
+	decrypt func(path string) ([]byte, error), encryptionKey []byte) (imported, skipped int, err error) {
+	cs := store.NewContextStore(s)
+	for _, entry := range entries {
+		plaintext, err := decrypt(entry.Path)
+		if err != nil {
+			return imported, skipped, err
+		}
+		if passFirstLine {
+			plaintext, _, _ = bytes.Cut(plaintext, []byte("\n"))
+		} else {
+			plaintext = bytes.TrimSuffix(plaintext, []byte("\n"))
+		}
+
+		encryptedValue, err := crypto.Encrypt(plaintext, encryptionKey)
+		if err != nil {
+			return imported, skipped, fmt.Errorf("failed to encrypt value: %w", err)
+		}
+
+		if passUpdateIfExists {
+			_, err = cs.Upsert(ctx, entry.Key, encryptedValue)
+		} else {
+			err = cs.Create(ctx, entry.Key, encryptedValue)
+		}
+		if errors.Is(err, store.ErrSecretAlreadyExists) {
+			fmt.Fprintf(os.Stderr, "skipping '%s': secret already exists (use --update to overwrite)\n", entry.Key)
+			skipped++
+			continue
+		}
+		if err != nil {
+			return imported, skipped, fmt.Errorf("failed to import secret '%s': %w", entry.Key, err)
+		}
+		imported++
+	}
+	return imported, skipped, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var infoOutput string
+
+// secretInfo is the machine-readable form of a secret's metadata.
+type secretInfo struct {
+	Key string `json:"key"`
+	store.Metadata
+}
+
+var InfoCmd = &cobra.Command{
+	Use:   "info [key]",
+	Short: "Show the metadata of a secret",
+	Long: `Shows when a secret was created and last updated, who created it, its
+description and tags. The secret value is not decrypted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		infoKey := args[0]
+		if infoKey == "" {
+			return fmt.Errorf("key argument is required")
+		}
+		if infoOutput != "text" && infoOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", infoOutput)
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		ms, err := store.AsMetadataStore(s)
+		if err != nil {
+			return err
+		}
+
+		md, err := ms.ReadMetadata(infoKey)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			fmt.Fprintf(os.Stderr, "secret with key '%s' not found\n", infoKey)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read metadata from store: %v\n", err)
+			os.Exit(1)
+		}
+
+		if infoOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(secretInfo{Key: infoKey, Metadata: md})
+		}
+
+		fmt.Printf("Key:          %s\n", infoKey)
+		fmt.Printf("Created:      %s\n", formatTime(md.CreatedAt))
+		fmt.Printf("Updated:      %s\n", formatTime(md.UpdatedAt))
+		fmt.Printf("Version:      %d\n", max(md.Version, 1))
+		fmt.Printf("Expires:      %s\n", formatTime(md.ExpiresAt))
+		fmt.Printf("Rotate every: %s\n", orDash(md.RotateEvery))
+		fmt.Printf("Created by:   %s\n", orDash(md.CreatedBy))
+		fmt.Printf("Description:  %s\n", orDash(md.Description))
+		fmt.Printf("Tags:         %s\n", orDash(formatTags(md.Tags)))
+		return nil
+	},
+}
+
+// formatTime renders a metadata timestamp in local time, or "-" if unknown.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05 MST")
+}
+
+// formatTags renders tags as a sorted, comma separated key=value list.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// orDash returns s, or "-" for an empty value in tabular output.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	InfoCmd.Flags().StringVarP(&infoOutput, "output", "o", "text", "Output format (text, json)")
+}
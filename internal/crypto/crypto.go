@@ -14,6 +14,8 @@ const (
 	// The nacl/secretbox package uses a 16-byte authentication tag,
 	// though this isn't exposed as a public constant.
 	TagSize = 16
+	// Cipher names the encryption used by Encrypt and Decrypt.
+	Cipher = "nacl-secretbox"
 )
 
 // Encrypt encrypts plaintext using the provided secretbox key.
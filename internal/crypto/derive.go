@@ -0,0 +1,26 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyDerivation names how DeriveKey derives keys.
+const KeyDerivation = "hkdf-sha256"
+
+// DeriveKey derives a secretbox key for purpose from the master key, so that
+// keys used for different things are independent of each other and of the
+// master key.
+func DeriveKey(master []byte, purpose string) ([]byte, error) {
+	if len(master) == 0 {
+		return nil, fmt.Errorf("cannot derive a key from an empty master key")
+	}
+	derived := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, nil, []byte(purpose)), derived); err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return derived, nil
+}
@@ -0,0 +1,46 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDeriveKeyKnownAnswer(t *testing.T) {
+	// HKDF-SHA256 without salt, computed independently of this package
+	master := bytes.Repeat([]byte{1}, 32)
+	want := "28426b7b1964aec4cd599d1fd3ff2c9a8ee91c44a9ae573490143dd3d54228b4"
+
+	derived, err := DeriveKey(master, "secrets-cli file encryption")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(derived); got != want {
+		t.Fatalf("DeriveKey = %s, want %s", got, want)
+	}
+}
+
+func TestDeriveKeyPurposes(t *testing.T) {
+	master := bytes.Repeat([]byte{1}, 32)
+	seen := make(map[string]string)
+	for _, purpose := range []string{"secrets-cli file encryption", "secrets-cli cache", "secrets-cli journal mac", ""} {
+		derived, err := DeriveKey(master, purpose)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(derived) != 32 {
+			t.Fatalf("DeriveKey(%q) returned %d bytes, want 32", purpose, len(derived))
+		}
+		if bytes.Equal(derived, master) {
+			t.Fatalf("DeriveKey(%q) returned the master key", purpose)
+		}
+		if other, ok := seen[string(derived)]; ok {
+			t.Fatalf("purposes %q and %q derive the same key", other, purpose)
+		}
+		seen[string(derived)] = purpose
+	}
+
+	if _, err := DeriveKey(nil, "secrets-cli cache"); err == nil {
+		t.Fatal("DeriveKey of an empty master key succeeded")
+	}
+}
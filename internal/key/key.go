@@ -12,6 +12,9 @@ const (
 	EnvKeyName = "SECRETS_ENCRYPTION_KEY"
 	// SecretBoxKeySize is the required key size for nacl/secretbox (32 bytes).
 	SecretBoxKeySize = 32
+	// KDF names how LoadKeyFromEnvVar derives the key from the variable: it
+	// uses the decoded bytes as they are, padded or cut to SecretBoxKeySize.
+	KDF = "none"
 )
 
 // GenerateKey generates a new random 32-byte key suitable for nacl/secretbox.
@@ -28,9 +31,15 @@ func GenerateKey() (string, error) {
 // LoadKeyFromEnv loads the encryption key from the specified environment variable.
 // It expects the key to be base64 encoded and returns the raw byte key.
 func LoadKeyFromEnv() ([]byte, error) {
-	keyBase64 := os.Getenv(EnvKeyName)
+	return LoadKeyFromEnvVar(EnvKeyName)
+}
+
+// LoadKeyFromEnvVar loads a base64 encoded key from the environment variable
+// name, such as a new key to re-encrypt secrets with.
+func LoadKeyFromEnvVar(name string) ([]byte, error) {
+	keyBase64 := os.Getenv(name)
 	if keyBase64 == "" {
-		return nil, fmt.Errorf("encryption key environment variable '%s' is not set", EnvKeyName)
+		return nil, fmt.Errorf("encryption key environment variable '%s' is not set", name)
 	}
 
 	key, err := base64.StdEncoding.DecodeString(keyBase64)
@@ -0,0 +1,86 @@
+package pass
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// EnvStoreDir is the environment variable `pass` uses to locate its store.
+	EnvStoreDir = "PASSWORD_STORE_DIR"
+	// gpgExt is the extension of the encrypted files in a password-store tree.
+	gpgExt = ".gpg"
+)
+
+// Entry is a single secret found in a password-store tree.
+type Entry struct {
+	// Key is the secret name, e.g. "email/work" for email/work.gpg.
+	Key string
+	// Path is the absolute path of the encrypted file.
+	Path string
+}
+
+// DefaultStoreDir returns the password-store location used by `pass`,
+// honoring PASSWORD_STORE_DIR and falling back to ~/.password-store.
+func DefaultStoreDir() (string, error) {
+	if dir := os.Getenv(EnvStoreDir); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".password-store"), nil
+}
+
+// ListEntries walks a password-store tree and returns all encrypted entries.
+// Hidden files and directories (.git, .gpg-id, ...) are skipped.
+func ListEntries(root string) ([]Entry, error) {
+	var entries []Entry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), gpgExt) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{
+			Key:  filepath.ToSlash(strings.TrimSuffix(rel, gpgExt)),
+			Path: path,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk password store: %w", err)
+	}
+	return entries, nil
+}
+
+// Decrypt decrypts a single password-store file with the given gpg binary.
+// It relies on the user's gpg-agent for the private key passphrase.
+func Decrypt(gpgBinary, path string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(gpgBinary, "--quiet", "--yes", "--batch", "--decrypt", path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("gpg failed to decrypt '%s': %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,51 @@
+package pass
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestListEntries(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"email/work.gpg",
+		"email/personal.gpg",
+		"bank.gpg",
+		"notes.txt",          // Not encrypted
+		".gpg-id",            // pass metadata
+		".git/objects/x.gpg", // Hidden directories are skipped
+		"email/.hidden.gpg",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := ListEntries(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+		if want := filepath.Join(root, filepath.FromSlash(e.Key)+".gpg"); e.Path != want {
+			t.Errorf("entry %s has path %s, want %s", e.Key, e.Path, want)
+		}
+	}
+	slices.Sort(keys)
+	if want := []string{"bank", "email/personal", "email/work"}; !slices.Equal(keys, want) {
+		t.Fatalf("ListEntries keys = %q, want %q", keys, want)
+	}
+}
+
+func TestListEntriesMissingDir(t *testing.T) {
+	if _, err := ListEntries(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("ListEntries of a missing directory succeeded")
+	}
+}
@@ -0,0 +1,66 @@
+package store
+
+import "fmt"
+
+// BatchOpKind is the change a BatchOp makes.
+type BatchOpKind string
+
+// The changes a batch can make; they behave like the SecretStore method of
+// the same name.
+const (
+	BatchCreate BatchOpKind = "create"
+	BatchUpdate BatchOpKind = "update"
+	BatchDelete BatchOpKind = "delete"
+)
+
+// BatchOp is one change of a batch. Value and Metadata are ignored by
+// BatchDelete.
+type BatchOp struct {
+	Kind     BatchOpKind
+	Key      string
+	Value    []byte
+	Metadata MetadataEdit // Applied to the metadata of the created or updated secret; may be nil
+}
+
+// BatchStore is implemented by backends that can apply several changes
+// atomically: either all operations of a batch are applied or none is.
+type BatchStore interface {
+	SecretStore
+
+	// ApplyBatch applies ops in order. If an operation fails, for example
+	// because it creates a key that exists, nothing is changed and the error
+	// names the failing operation.
+	ApplyBatch(ops []BatchOp) error
+}
+
+// AsBatchStore returns s as a BatchStore, or an error wrapping
+// ErrNotSupported if the backend can't apply changes atomically.
+func AsBatchStore(s SecretStore) (BatchStore, error) {
+	bs, ok := s.(BatchStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s does not support atomic batches", ErrNotSupported, describeStore(s))
+	}
+	return bs, nil
+}
+
+// validateBatch checks the kinds and keys of ops before anything is applied.
+func validateBatch(ops []BatchOp) error {
+	for i, op := range ops {
+		switch op.Kind {
+		case BatchCreate:
+			if err := validateKey(op.Key); err != nil {
+				return batchOpError(i, op, err)
+			}
+		case BatchUpdate, BatchDelete:
+		default:
+			return batchOpError(i, op, fmt.Errorf("unknown batch operation '%s'", op.Kind))
+		}
+	}
+	return nil
+}
+
+// batchOpError wraps err with the position and target of the failing
+// operation.
+func batchOpError(i int, op BatchOp, err error) error {
+	return fmt.Errorf("batch operation %d (%s '%s'): %w", i+1, op.Kind, op.Key, err)
+}
@@ -0,0 +1,850 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// boltDefaultBucket holds the secrets of the default namespace.
+	boltDefaultBucket = "secrets"
+	// boltNamespacePrefix prefixes the secrets bucket of every other
+	// namespace.
+	boltNamespacePrefix = "ns:"
+	// boltMetaPrefix prefixes the bucket holding the metadata records of a
+	// secrets bucket.
+	boltMetaPrefix = "meta:"
+	// boltHistoryPrefix prefixes the bucket holding one nested bucket of
+	// previous versions per secret, keyed by big-endian version number.
+	boltHistoryPrefix = "history:"
+	// boltTrashPrefix prefixes the bucket holding soft-deleted secrets as
+	// JSON records.
+	boltTrashPrefix = "trash:"
+	// boltOpenTimeout bounds how long Init waits for the file lock held by
+	// another process using the same database.
+	boltOpenTimeout = 5 * time.Second
+)
+
+// BoltStore implements the SecretStore interface using an embedded bbolt
+// database. Secrets are kept in a single file, one bucket per namespace, with
+// their metadata as JSON in a companion "meta:<bucket>" bucket and their
+// previous versions in "history:<bucket>". Soft-deleted secrets are kept in
+// "trash:<bucket>". The stores of one process share the handle of a file,
+// since bbolt locks the file against every other handle.
+type BoltStore struct {
+	DBPath           string
+	Bucket           string   // Bucket holding the secrets
+	HistoryRetention int      // Number of previous versions kept per secret
+	db               *bolt.DB // Database handle, shared by path
+	dbKey            string   // Key of db in boltDBs, empty once released
+}
+
+// boltDB is a database handle shared by the stores of one file.
+type boltDB struct {
+	db   *bolt.DB
+	refs int // Stores using db
+}
+
+var (
+	boltDBsMu sync.Mutex
+	boltDBs   = make(map[string]*boltDB) // By absolute path
+)
+
+// openBoltDB returns the handle of the database at path, opening it unless
+// another store already did. Every call is paired with closeBoltDB.
+func openBoltDB(path string) (*bolt.DB, string, error) {
+	dbKey, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	boltDBsMu.Lock()
+	defer boltDBsMu.Unlock()
+	if shared, ok := boltDBs[dbKey]; ok {
+		shared.refs++
+		return shared.db, dbKey, nil
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open bolt database: %w", err)
+	}
+	boltDBs[dbKey] = &boltDB{db: db, refs: 1}
+	return db, dbKey, nil
+}
+
+// closeBoltDB releases the handle opened by openBoltDB, closing it with its
+// last store.
+func closeBoltDB(dbKey string) error {
+	boltDBsMu.Lock()
+	defer boltDBsMu.Unlock()
+	shared, ok := boltDBs[dbKey]
+	if !ok {
+		return nil
+	}
+	if shared.refs--; shared.refs > 0 {
+		return nil
+	}
+	delete(boltDBs, dbKey)
+	return shared.db.Close()
+}
+
+// NewBoltStore creates a new BoltStore instance.
+func NewBoltStore(dbPath string) (*BoltStore, error) {
+	if dbPath == "" {
+		return nil, fmt.Errorf("%w: bolt database path cannot be empty", ErrInvalidConfiguration)
+	}
+	return &BoltStore{DBPath: dbPath, Bucket: boltDefaultBucket, HistoryRetention: DefaultHistoryRetention}, nil
+}
+
+// setHistoryRetention sets the number of previous versions kept per secret.
+func (s *BoltStore) setHistoryRetention(n int) {
+	s.HistoryRetention = n
+}
+
+// setNamespace selects the bucket of the given namespace.
+func (s *BoltStore) setNamespace(ns string) {
+	if ns == DefaultNamespace {
+		s.Bucket = boltDefaultBucket
+		return
+	}
+	s.Bucket = boltNamespacePrefix + ns
+}
+
+// Init opens the database file and creates the bucket if it doesn't exist.
+func (s *BoltStore) Init() error {
+	db, dbKey, err := openBoltDB(s.DBPath)
+	if err != nil {
+		return err
+	}
+	s.db, s.dbKey = db, dbKey
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(s.Bucket)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(boltMetaPrefix + s.Bucket)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(boltHistoryPrefix + s.Bucket)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(boltTrashPrefix + s.Bucket))
+		return err
+	})
+	if err != nil {
+		s.Close() // Close database on error
+		return fmt.Errorf("failed to create bucket '%s': %w", s.Bucket, err)
+	}
+
+	return nil
+}
+
+// Close releases the database file, closing it unless another store of the
+// same file still uses it.
+func (s *BoltStore) Close() error {
+	if s.dbKey == "" {
+		return nil
+	}
+	dbKey := s.dbKey
+	s.dbKey = "" // Release the handle once
+	return closeBoltDB(dbKey)
+}
+
+// bucket returns the secrets bucket of the given transaction.
+func (s *BoltStore) bucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	b := tx.Bucket([]byte(s.Bucket))
+	if b == nil {
+		return nil, fmt.Errorf("bolt bucket '%s' does not exist", s.Bucket)
+	}
+	return b, nil
+}
+
+// metaBucket returns the metadata bucket of the given transaction.
+func (s *BoltStore) metaBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	b := tx.Bucket([]byte(boltMetaPrefix + s.Bucket))
+	if b == nil {
+		return nil, fmt.Errorf("bolt bucket '%s%s' does not exist", boltMetaPrefix, s.Bucket)
+	}
+	return b, nil
+}
+
+// historyBucket returns the bucket holding the per-secret history buckets.
+func (s *BoltStore) historyBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	b := tx.Bucket([]byte(boltHistoryPrefix + s.Bucket))
+	if b == nil {
+		return nil, fmt.Errorf("bolt bucket '%s%s' does not exist", boltHistoryPrefix, s.Bucket)
+	}
+	return b, nil
+}
+
+// trashBucket returns the bucket holding the trashed secrets.
+func (s *BoltStore) trashBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	b := tx.Bucket([]byte(boltTrashPrefix + s.Bucket))
+	if b == nil {
+		return nil, fmt.Errorf("bolt bucket '%s%s' does not exist", boltTrashPrefix, s.Bucket)
+	}
+	return b, nil
+}
+
+// boltVersionKey encodes a version number so that cursor order is version
+// order.
+func boltVersionKey(version int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(version))
+}
+
+// archiveVersion moves v into the history of key and drops the oldest
+// versions beyond the retention.
+func (s *BoltStore) archiveVersion(tx *bolt.Tx, key string, v SecretVersion) error {
+	hb, err := s.historyBucket(tx)
+	if err != nil {
+		return err
+	}
+	kb, err := hb.CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		return err
+	}
+	if s.HistoryRetention > 0 {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := kb.Put(boltVersionKey(v.Version), encoded); err != nil {
+			return err
+		}
+	}
+
+	// Keys sort oldest first, so everything before the newest versions goes
+	var versions [][]byte
+	c := kb.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		versions = append(versions, append([]byte(nil), k...))
+	}
+	for _, k := range versions[:max(len(versions)-max(s.HistoryRetention, 0), 0)] {
+		if err := kb.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// history decodes the previous versions of key, newest first.
+func (s *BoltStore) history(tx *bolt.Tx, key string) ([]SecretVersion, error) {
+	hb, err := s.historyBucket(tx)
+	if err != nil {
+		return nil, err
+	}
+	kb := hb.Bucket([]byte(key))
+	if kb == nil {
+		return nil, nil
+	}
+
+	var versions []SecretVersion
+	c := kb.Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		var version SecretVersion
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, fmt.Errorf("invalid history for key '%s': %w", key, err)
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// getMetadata decodes the metadata record of key, returning a zero Metadata
+// for secrets written without one.
+func (s *BoltStore) getMetadata(tx *bolt.Tx, key string) (Metadata, error) {
+	var md Metadata
+	mb, err := s.metaBucket(tx)
+	if err != nil {
+		return md, err
+	}
+	if v := mb.Get([]byte(key)); v != nil {
+		if err := json.Unmarshal(v, &md); err != nil {
+			return md, fmt.Errorf("invalid metadata for key '%s': %w", key, err)
+		}
+	}
+	return md, nil
+}
+
+// putMetadata encodes and stores the metadata record of key.
+func (s *BoltStore) putMetadata(tx *bolt.Tx, key string, md Metadata) error {
+	mb, err := s.metaBucket(tx)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	return mb.Put([]byte(key), encoded)
+}
+
+// Create stores a new encrypted value.
+func (s *BoltStore) Create(key string, encryptedValue []byte) error {
+	return s.CreateWithMetadata(key, encryptedValue, nil)
+}
+
+// CreateWithMetadata stores a new encrypted value and applies edit to its
+// metadata within one write transaction.
+func (s *BoltStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.insert(tx, key, encryptedValue, edit)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt create failed: %w", err)
+	}
+	return nil
+}
+
+// insert stores a new secret with fresh metadata, changed by edit.
+func (s *BoltStore) insert(tx *bolt.Tx, key string, encryptedValue []byte, edit MetadataEdit) error {
+	b, err := s.bucket(tx)
+	if err != nil {
+		return err
+	}
+	if b.Get([]byte(key)) != nil {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+	}
+	if err := b.Put([]byte(key), encryptedValue); err != nil {
+		return err
+	}
+	md := newMetadata()
+	edit.apply(&md)
+	return s.putMetadata(tx, key, md)
+}
+
+// Read retrieves an encrypted value.
+func (s *BoltStore) Read(key string) ([]byte, error) {
+	var encryptedValue []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+		}
+		// Values returned by bolt are only valid for the life of the transaction
+		encryptedValue = append([]byte(nil), v...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt read failed: %w", err)
+	}
+	return encryptedValue, nil
+}
+
+// ReadRevision retrieves an encrypted value and its revision from the same
+// transaction.
+func (s *BoltStore) ReadRevision(key string) ([]byte, int64, error) {
+	var (
+		encryptedValue []byte
+		revision       int64
+	)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+		}
+		md, err := s.getMetadata(tx, key)
+		if err != nil {
+			return err
+		}
+		encryptedValue = append([]byte(nil), v...)
+		revision = currentVersion(md)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("bolt read failed: %w", err)
+	}
+	return encryptedValue, revision, nil
+}
+
+// Update updates an existing encrypted value.
+func (s *BoltStore) Update(key string, encryptedValue []byte) error {
+	return s.UpdateWithMetadata(key, anyRevision, encryptedValue, nil)
+}
+
+// CompareAndSwap updates a secret if it is still at expectedRevision, within
+// a single write transaction.
+func (s *BoltStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	return s.UpdateWithMetadata(key, expectedRevision, encryptedValue, nil)
+}
+
+// UpdateWithMetadata replaces the value of a secret at the expected revision
+// and applies edit to its metadata within one write transaction.
+func (s *BoltStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.replace(tx, key, expectedRevision, encryptedValue, edit)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt update failed: %w", err)
+	}
+	return nil
+}
+
+// replace archives the current value of a secret at the expected revision
+// and stores the new one, applying edit to its metadata.
+func (s *BoltStore) replace(tx *bolt.Tx, key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	b, err := s.bucket(tx)
+	if err != nil {
+		return err
+	}
+	old := b.Get([]byte(key))
+	if old == nil {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	md, err := s.getMetadata(tx, key)
+	if err != nil {
+		return err
+	}
+	if err := checkRevision(key, md, expectedRevision); err != nil {
+		return err
+	}
+	if err := s.archiveVersion(tx, key, archiveVersion(old, md)); err != nil {
+		return err
+	}
+	if err := b.Put([]byte(key), encryptedValue); err != nil {
+		return err
+	}
+	md.Version = currentVersion(md) + 1
+	md.UpdatedAt = time.Now().UTC()
+	edit.apply(&md)
+	return s.putMetadata(tx, key, md)
+}
+
+// Delete removes a secret.
+func (s *BoltStore) Delete(key string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.removeExisting(tx, key)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt delete failed: %w", err)
+	}
+	return nil
+}
+
+// removeExisting removes a secret that must exist.
+func (s *BoltStore) removeExisting(tx *bolt.Tx, key string) error {
+	b, err := s.bucket(tx)
+	if err != nil {
+		return err
+	}
+	if b.Get([]byte(key)) == nil {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	return s.remove(tx, key)
+}
+
+// ApplyBatch applies ops within a single write transaction, which bolt rolls
+// back if an operation fails.
+func (s *BoltStore) ApplyBatch(ops []BatchOp) error {
+	if err := validateBatch(ops); err != nil {
+		return err
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for i, op := range ops {
+			var err error
+			switch op.Kind {
+			case BatchCreate:
+				err = s.insert(tx, op.Key, op.Value, op.Metadata)
+			case BatchUpdate:
+				err = s.replace(tx, op.Key, anyRevision, op.Value, op.Metadata)
+			case BatchDelete:
+				err = s.removeExisting(tx, op.Key)
+			}
+			if err != nil {
+				return batchOpError(i, op, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("bolt batch failed: %w", err)
+	}
+	return nil
+}
+
+// remove deletes the value, metadata and history of key.
+func (s *BoltStore) remove(tx *bolt.Tx, key string) error {
+	b, err := s.bucket(tx)
+	if err != nil {
+		return err
+	}
+	if err := b.Delete([]byte(key)); err != nil {
+		return err
+	}
+	mb, err := s.metaBucket(tx)
+	if err != nil {
+		return err
+	}
+	if err := mb.Delete([]byte(key)); err != nil {
+		return err
+	}
+	hb, err := s.historyBucket(tx)
+	if err != nil {
+		return err
+	}
+	if hb.Bucket([]byte(key)) == nil {
+		return nil
+	}
+	return hb.DeleteBucket([]byte(key))
+}
+
+// ListKeys lists all available keys.
+func (s *BoltStore) ListKeys() ([]string, error) {
+	return s.ListKeysWithPrefix("")
+}
+
+// ListKeysWithPrefix lists the keys starting with prefix by seeking the
+// cursor to it; keys are stored sorted.
+func (s *BoltStore) ListKeysWithPrefix(prefix string) ([]string, error) {
+	var keys []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		c := b.Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt list keys failed: %w", err)
+	}
+	return keys, nil
+}
+
+// ReadMetadata returns the metadata of a secret.
+func (s *BoltStore) ReadMetadata(key string) (Metadata, error) {
+	var md Metadata
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(key)) == nil {
+			return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+		}
+		md, err = s.getMetadata(tx, key)
+		return err
+	})
+	if err != nil {
+		return Metadata{}, fmt.Errorf("bolt read metadata failed: %w", err)
+	}
+	return md, nil
+}
+
+// ListMetadata returns the metadata of every secret from one read
+// transaction.
+func (s *BoltStore) ListMetadata() (map[string]Metadata, error) {
+	all := make(map[string]Metadata)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			md, err := s.getMetadata(tx, string(k))
+			if err != nil {
+				return err
+			}
+			all[string(k)] = md
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt list metadata failed: %w", err)
+	}
+	return all, nil
+}
+
+// WriteMetadata replaces the metadata of a secret.
+func (s *BoltStore) WriteMetadata(key string, md Metadata) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(key)) == nil {
+			return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+		}
+		current, err := s.getMetadata(tx, key)
+		if err != nil {
+			return err
+		}
+		md.Version = current.Version
+		return s.putMetadata(tx, key, md)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt write metadata failed: %w", err)
+	}
+	return nil
+}
+
+// ListVersions returns the retained previous versions of a secret.
+func (s *BoltStore) ListVersions(key string) ([]SecretVersion, error) {
+	var versions []SecretVersion
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(key)) == nil {
+			return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+		}
+		versions, err = s.history(tx, key)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt list versions failed: %w", err)
+	}
+	return versions, nil
+}
+
+// ReadVersion returns the value of the current or a previous version.
+func (s *BoltStore) ReadVersion(key string, version int64) ([]byte, error) {
+	var encryptedValue []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+		}
+		md, err := s.getMetadata(tx, key)
+		if err != nil {
+			return err
+		}
+		if version == currentVersion(md) {
+			encryptedValue = append([]byte(nil), v...)
+			return nil
+		}
+		hb, err := s.historyBucket(tx)
+		if err != nil {
+			return err
+		}
+		var encoded []byte
+		if kb := hb.Bucket([]byte(key)); kb != nil {
+			encoded = kb.Get(boltVersionKey(version))
+		}
+		if encoded == nil {
+			return versionNotFound(key, version)
+		}
+		var sv SecretVersion
+		if err := json.Unmarshal(encoded, &sv); err != nil {
+			return fmt.Errorf("invalid history for key '%s': %w", key, err)
+		}
+		encryptedValue = sv.Value
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt read version failed: %w", err)
+	}
+	return encryptedValue, nil
+}
+
+// Trash moves a secret with its metadata and history to the trash bucket.
+func (s *BoltStore) Trash(key string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+		}
+		record := trashRecord{Value: v, DeletedAt: time.Now().UTC()}
+		if record.Metadata, err = s.getMetadata(tx, key); err != nil {
+			return err
+		}
+		if record.History, err = s.history(tx, key); err != nil {
+			return err
+		}
+		// Encode before remove, which invalidates v
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		tb, err := s.trashBucket(tx)
+		if err != nil {
+			return err
+		}
+		if tb.Get([]byte(key)) != nil {
+			return alreadyInTrash(key)
+		}
+		if err := tb.Put([]byte(key), encoded); err != nil {
+			return err
+		}
+		return s.remove(tx, key)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt trash failed: %w", err)
+	}
+	return nil
+}
+
+// ListTrash returns the secrets in the trash bucket.
+func (s *BoltStore) ListTrash() ([]TrashedSecret, error) {
+	var trashed []TrashedSecret
+	err := s.db.View(func(tx *bolt.Tx) error {
+		tb, err := s.trashBucket(tx)
+		if err != nil {
+			return err
+		}
+		return tb.ForEach(func(k, v []byte) error {
+			var record trashRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("invalid trash record for key '%s': %w", k, err)
+			}
+			trashed = append(trashed, TrashedSecret{Key: string(k), DeletedAt: record.DeletedAt})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt list trash failed: %w", err)
+	}
+	return trashed, nil
+}
+
+// Restore moves a secret with its metadata and history out of the trash bucket.
+func (s *BoltStore) Restore(key string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		tb, err := s.trashBucket(tx)
+		if err != nil {
+			return err
+		}
+		encoded := tb.Get([]byte(key))
+		if encoded == nil {
+			return notInTrash(key)
+		}
+		var record trashRecord
+		if err := json.Unmarshal(encoded, &record); err != nil {
+			return fmt.Errorf("invalid trash record for key '%s': %w", key, err)
+		}
+
+		b, err := s.bucket(tx)
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(key)) != nil {
+			return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+		}
+		if err := b.Put([]byte(key), record.Value); err != nil {
+			return err
+		}
+		if err := s.putMetadata(tx, key, record.Metadata); err != nil {
+			return err
+		}
+		if len(record.History) > 0 {
+			hb, err := s.historyBucket(tx)
+			if err != nil {
+				return err
+			}
+			kb, err := hb.CreateBucketIfNotExists([]byte(key))
+			if err != nil {
+				return err
+			}
+			for _, v := range record.History {
+				encodedVersion, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				if err := kb.Put(boltVersionKey(v.Version), encodedVersion); err != nil {
+					return err
+				}
+			}
+		}
+		return tb.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("bolt restore failed: %w", err)
+	}
+	return nil
+}
+
+// Purge permanently removes the secrets trashed before the given time.
+func (s *BoltStore) Purge(before time.Time) ([]string, error) {
+	var purged []string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		tb, err := s.trashBucket(tx)
+		if err != nil {
+			return err
+		}
+		// Deleting while iterating with ForEach is not allowed
+		err = tb.ForEach(func(k, v []byte) error {
+			var record trashRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("invalid trash record for key '%s': %w", k, err)
+			}
+			if record.DeletedAt.Before(before) {
+				purged = append(purged, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range purged {
+			if err := tb.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt purge failed: %w", err)
+	}
+	return purged, nil
+}
+
+// ListNamespaces returns the namespaces that contain secrets.
+func (s *BoltStore) ListNamespaces() ([]string, error) {
+	var names []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			ns, ok := strings.CutPrefix(string(name), boltNamespacePrefix)
+			if !ok {
+				return nil
+			}
+			if k, _ := b.Cursor().First(); k != nil {
+				names = append(names, ns)
+				return nil
+			}
+			if tb := tx.Bucket([]byte(boltTrashPrefix + string(name))); tb != nil {
+				if k, _ := tb.Cursor().First(); k != nil {
+					names = append(names, ns)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt list namespaces failed: %w", err)
+	}
+	return namespaceList(names), nil
+}
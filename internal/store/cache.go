@@ -0,0 +1,627 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+)
+
+// cacheKeyPurpose is what cache keys are derived from the encryption key for.
+const cacheKeyPurpose = "secrets-cli cache"
+
+// CacheStore wraps a slow or remote SecretStore and keeps the encrypted
+// values, key lists and metadata read from it in a local cache file. Entries
+// younger than TTL are served without asking the wrapped store. Older entries
+// are refreshed, but still served, with a warning, when the wrapped store
+// can't be reached; if it can't even be initialized the cache is used for
+// reading alone. Changes are written through and update the cache.
+//
+// The cache file is encrypted with Key as a whole, so it reveals neither the
+// keys nor the number of secrets.
+type CacheStore struct {
+	Inner    SecretStore
+	Path     string        // Cache file
+	Key      []byte        // Encryption key of the cache file
+	TTL      time.Duration // How long entries are served without asking Inner
+	Warnings io.Writer     // Receives a warning when a stale entry is first served
+
+	mu      sync.Mutex
+	cache   cacheFile
+	dirty   bool  // The cache changed since it was loaded
+	offline error // Why Inner couldn't be initialized; nil if it could
+	warned  bool  // A stale entry was served
+}
+
+// cacheFile is the decrypted content of a cache file.
+type cacheFile struct {
+	Secrets  map[string]cacheEntry[[]byte]   `json:"secrets"`
+	Metadata map[string]cacheEntry[Metadata] `json:"metadata"`
+	KeyLists map[string]cacheEntry[[]string] `json:"key_lists"` // By prefix
+}
+
+// cacheEntry is a value read from the wrapped store.
+type cacheEntry[T any] struct {
+	Value     T         `json:"value"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// NewCacheStore wraps inner so that reads are cached in the file at path,
+// encrypted with key.
+func NewCacheStore(inner SecretStore, path string, key []byte, ttl time.Duration) (*CacheStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: cache file path cannot be empty", ErrInvalidConfiguration)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("%w: cache TTL must be positive", ErrInvalidConfiguration)
+	}
+	return &CacheStore{Inner: inner, Path: path, Key: key, TTL: ttl, Warnings: os.Stderr}, nil
+}
+
+// CacheFilePath returns the cache file of a store, named after its backend
+// and a hash of its location and namespace, so every store gets its own.
+func CacheFilePath(backend, location, namespace string) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(backend + "\x00" + location + "\x00" + namespace))
+	return filepath.Join(dir, fmt.Sprintf("%s-%s.cache", backend, hex.EncodeToString(sum[:8]))), nil
+}
+
+// cacheDir returns CacheDir, defaulting to secrets-cli in the user's cache
+// directory.
+func cacheDir() (string, error) {
+	if CacheDir != "" {
+		return CacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("%w: no cache directory: %v", ErrInvalidConfiguration, err)
+	}
+	return filepath.Join(dir, "secrets-cli"), nil
+}
+
+// cacheLocation returns what distinguishes the stores of a backend, for
+// naming their cache files: location if given, else the configured one.
+func cacheLocation(backend, location string) string {
+	if location != "" {
+		return location
+	}
+	switch backend {
+	case "sqlite":
+		return SqliteDBPath + "\x00" + SqliteTable
+	case "jsonfile":
+		return JsonFilePath
+	case "bolt":
+		return BoltDBPath
+	case "dir":
+		return DirRoot
+	case "remote":
+		return RemoteURL
+	case "mongodb-placeholder":
+		return MongoURI + "\x00" + MongoDatabase + "\x00" + MongoCollection
+	default:
+		return BackendLocation
+	}
+}
+
+// ClearCache removes the cache file of the configured store, or with all the
+// cache files of every store. It returns the number of files removed.
+func ClearCache(all bool) (int, error) {
+	if !all {
+		path, err := CacheFilePath(BackendType, cacheLocation(BackendType, ""), selectedNamespace())
+		if err != nil {
+			return 0, err
+		}
+		if err := os.Remove(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return 0, nil
+			}
+			return 0, fmt.Errorf("failed to remove cache file: %w", err)
+		}
+		return 1, nil
+	}
+
+	dir, err := cacheDir()
+	if err != nil {
+		return 0, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.cache"))
+	if err != nil {
+		return 0, err
+	}
+	for i, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return i, fmt.Errorf("failed to remove cache file: %w", err)
+		}
+	}
+	return len(paths), nil
+}
+
+// withCache wraps s in a CacheStore if a cache TTL is configured for
+// backend, with --cache-ttl taking precedence over the config file.
+func withCache(s SecretStore, backend, location, namespace string) (SecretStore, error) {
+	ttl := CacheTTL
+	if ttl == 0 {
+		ttl = CacheTTLs[backend]
+	}
+	if ttl == 0 {
+		return s, nil
+	}
+	path, err := CacheFilePath(backend, cacheLocation(backend, location), namespace)
+	if err != nil {
+		return nil, err
+	}
+	master, err := key.LoadKeyFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%w: cache needs the encryption key: %v", ErrInvalidConfiguration, err)
+	}
+	cacheKey, err := crypto.DeriveKey(master, cacheKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	return NewCacheStore(s, path, cacheKey, ttl)
+}
+
+// Init loads the cache and initializes the wrapped store. If that fails for
+// any reason but a configuration error and the cache has entries, the store
+// works offline: reads are served from the cache and changes fail.
+func (s *CacheStore) Init() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.load()
+	s.offline, s.warned = nil, false
+	if err := s.Inner.Init(); err != nil {
+		if errors.Is(err, ErrInvalidConfiguration) || s.empty() {
+			return err
+		}
+		s.offline = fmt.Errorf("backend unreachable, only cached secrets can be read: %w", err)
+	}
+	return nil
+}
+
+// Close saves the cache and closes the wrapped store.
+func (s *CacheStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.save()
+	if s.offline == nil {
+		if closeErr := s.Inner.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// load reads the cache file. A missing file, or one that can't be decrypted
+// because the key changed, is an empty cache. The caller must hold s.mu.
+func (s *CacheStore) load() {
+	s.cache = cacheFile{}
+	s.dirty = false
+	if content, err := os.ReadFile(s.Path); err == nil {
+		if plaintext, err := crypto.Decrypt(content, s.Key); err == nil {
+			if err := json.Unmarshal(plaintext, &s.cache); err != nil {
+				s.cache = cacheFile{}
+			}
+		}
+	}
+	if s.cache.Secrets == nil {
+		s.cache.Secrets = make(map[string]cacheEntry[[]byte])
+	}
+	if s.cache.Metadata == nil {
+		s.cache.Metadata = make(map[string]cacheEntry[Metadata])
+	}
+	if s.cache.KeyLists == nil {
+		s.cache.KeyLists = make(map[string]cacheEntry[[]string])
+	}
+}
+
+// empty reports whether the cache has no entries. The caller must hold s.mu.
+func (s *CacheStore) empty() bool {
+	return len(s.cache.Secrets) == 0 && len(s.cache.Metadata) == 0 && len(s.cache.KeyLists) == 0
+}
+
+// save writes the cache file if the cache changed. The caller must hold s.mu.
+func (s *CacheStore) save() error {
+	if !s.dirty {
+		return nil
+	}
+	plaintext, err := json.Marshal(s.cache)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache: %w", err)
+	}
+	content, err := crypto.Encrypt(plaintext, s.Key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.Path), ".secrets-cache-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp cache file: %w", err)
+	}
+	tmpFilePath := tmpFile.Name()
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Rename(tmpFilePath, s.Path); err != nil {
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to rename cache file: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
+
+// cachedRead returns the entry at name of the map that entries selects from
+// the cache if it is fresh, and otherwise fetches and caches it. The map is
+// selected under s.mu each time, since load replaces it. When fetching fails for another reason
+// than a definite answer such as ErrSecretNotFound, a stale entry is served
+// with a warning.
+func cachedRead[T any](s *CacheStore, entries func(*cacheFile) map[string]cacheEntry[T], name, what string, fetch func() (T, error)) (T, error) {
+	s.mu.Lock()
+	entry, ok := entries(&s.cache)[name]
+	offline := s.offline
+	s.mu.Unlock()
+
+	if ok && offline == nil && time.Since(entry.FetchedAt) < s.TTL {
+		return entry.Value, nil
+	}
+	var err error
+	if offline != nil {
+		err = offline
+	} else {
+		var value T
+		if value, err = fetch(); err == nil {
+			s.mu.Lock()
+			entries(&s.cache)[name] = cacheEntry[T]{Value: value, FetchedAt: time.Now()}
+			s.dirty = true
+			s.mu.Unlock()
+			return value, nil
+		}
+	}
+
+	if definiteError(err) {
+		if errors.Is(err, ErrSecretNotFound) {
+			s.mu.Lock()
+			delete(entries(&s.cache), name)
+			s.dirty = true
+			s.mu.Unlock()
+		}
+		return entry.Value, err
+	}
+	if !ok {
+		return entry.Value, err
+	}
+	s.mu.Lock()
+	if !s.warned {
+		fmt.Fprintf(s.Warnings, "warning: using cached %s from %s: %v\n",
+			what, entry.FetchedAt.Local().Format(time.DateTime), err)
+		s.warned = true
+	}
+	s.mu.Unlock()
+	return entry.Value, nil
+}
+
+// cachedSecrets, cachedKeyLists and cachedMetadata select a map of the cache
+// for cachedRead.
+func cachedSecrets(c *cacheFile) map[string]cacheEntry[[]byte]    { return c.Secrets }
+func cachedKeyLists(c *cacheFile) map[string]cacheEntry[[]string] { return c.KeyLists }
+func cachedMetadata(c *cacheFile) map[string]cacheEntry[Metadata] { return c.Metadata }
+
+// definiteError reports whether err is an answer of the wrapped store rather
+// than a failure to reach it.
+func definiteError(err error) bool {
+	return errors.Is(err, ErrSecretNotFound) || errors.Is(err, ErrInvalidKey) ||
+		errors.Is(err, ErrNotSupported) || errors.Is(err, ErrInvalidConfiguration)
+}
+
+// invalidate drops the cached value and metadata of keys and all key lists,
+// after they were changed.
+func (s *CacheStore) invalidate(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.cache.Secrets, key)
+		delete(s.cache.Metadata, key)
+	}
+	clear(s.cache.KeyLists)
+	s.dirty = true
+}
+
+// online returns the reason the wrapped store is unavailable, if it is.
+func (s *CacheStore) online() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offline
+}
+
+// Create stores a new encrypted value in the wrapped store and caches it.
+func (s *CacheStore) Create(key string, encryptedValue []byte) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	if err := s.Inner.Create(key, encryptedValue); err != nil {
+		return err
+	}
+	s.invalidate(key)
+	s.mu.Lock()
+	s.cache.Secrets[key] = cacheEntry[[]byte]{Value: slices.Clone(encryptedValue), FetchedAt: time.Now()}
+	s.mu.Unlock()
+	return nil
+}
+
+// CreateWithMetadata stores a new encrypted value with edited metadata in the
+// wrapped store and caches the value.
+func (s *CacheStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	if err := CreateWithMetadata(s.Inner, key, encryptedValue, edit); err != nil {
+		return err
+	}
+	s.invalidate(key)
+	s.mu.Lock()
+	s.cache.Secrets[key] = cacheEntry[[]byte]{Value: slices.Clone(encryptedValue), FetchedAt: time.Now()}
+	s.mu.Unlock()
+	return nil
+}
+
+// Read retrieves an encrypted value from the cache or the wrapped store.
+func (s *CacheStore) Read(key string) ([]byte, error) {
+	value, err := cachedRead(s, cachedSecrets, key, fmt.Sprintf("value of '%s'", key), func() ([]byte, error) {
+		return s.Inner.Read(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(value), nil
+}
+
+// Update updates an existing encrypted value in the wrapped store and caches
+// it.
+func (s *CacheStore) Update(key string, encryptedValue []byte) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	if err := s.Inner.Update(key, encryptedValue); err != nil {
+		return err
+	}
+	s.invalidate(key)
+	s.mu.Lock()
+	s.cache.Secrets[key] = cacheEntry[[]byte]{Value: slices.Clone(encryptedValue), FetchedAt: time.Now()}
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete removes a secret from the wrapped store and the cache.
+func (s *CacheStore) Delete(key string) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	if err := s.Inner.Delete(key); err != nil {
+		return err
+	}
+	s.invalidate(key)
+	return nil
+}
+
+// ListKeys lists all available keys from the cache or the wrapped store.
+func (s *CacheStore) ListKeys() ([]string, error) {
+	return s.ListKeysWithPrefix("")
+}
+
+// ListKeysWithPrefix lists the keys starting with prefix from the cache or
+// the wrapped store.
+func (s *CacheStore) ListKeysWithPrefix(prefix string) ([]string, error) {
+	what := "key list"
+	if prefix != "" {
+		what = fmt.Sprintf("keys under '%s'", strings.TrimSuffix(prefix, "/"))
+	}
+	return cachedRead(s, cachedKeyLists, prefix, what, func() ([]string, error) {
+		return ListKeysWithPrefix(s.Inner, prefix)
+	})
+}
+
+// ReadMetadata returns the metadata of a secret from the cache or the wrapped
+// store.
+func (s *CacheStore) ReadMetadata(key string) (Metadata, error) {
+	return cachedRead(s, cachedMetadata, key, fmt.Sprintf("metadata of '%s'", key), func() (Metadata, error) {
+		ms, err := AsMetadataStore(s.Inner)
+		if err != nil {
+			return Metadata{}, err
+		}
+		return ms.ReadMetadata(key)
+	})
+}
+
+// WriteMetadata replaces the metadata of a secret in the wrapped store.
+func (s *CacheStore) WriteMetadata(key string, md Metadata) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	ms, err := AsMetadataStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	if err := ms.WriteMetadata(key, md); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.cache.Metadata, key)
+	s.dirty = true
+	s.mu.Unlock()
+	return nil
+}
+
+// ReadRevision reads a secret and its revision from the wrapped store,
+// bypassing the cache: a revision is only useful if it is current.
+func (s *CacheStore) ReadRevision(key string) ([]byte, int64, error) {
+	if err := s.online(); err != nil {
+		return nil, 0, err
+	}
+	rs, err := AsRevisionStore(s.Inner)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rs.ReadRevision(key)
+}
+
+// CompareAndSwap updates a secret of the wrapped store at the expected
+// revision.
+func (s *CacheStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	rs, err := AsRevisionStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	err = rs.CompareAndSwap(key, expectedRevision, encryptedValue)
+	s.invalidate(key)
+	return err
+}
+
+// UpdateWithMetadata updates a secret of the wrapped store at the expected
+// revision, unless that is 0, with edited metadata.
+func (s *CacheStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	err := UpdateWithMetadata(s.Inner, key, expectedRevision, encryptedValue, edit)
+	s.invalidate(key)
+	return err
+}
+
+// ApplyBatch applies ops atomically to the wrapped store.
+func (s *CacheStore) ApplyBatch(ops []BatchOp) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	bs, err := AsBatchStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	err = bs.ApplyBatch(ops)
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = op.Key
+	}
+	s.invalidate(keys...)
+	return err
+}
+
+// ListVersions returns the previous versions of a secret from the wrapped
+// store.
+func (s *CacheStore) ListVersions(key string) ([]SecretVersion, error) {
+	if err := s.online(); err != nil {
+		return nil, err
+	}
+	vs, err := AsVersionedStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	return vs.ListVersions(key)
+}
+
+// ReadVersion returns one version of a secret from the wrapped store.
+func (s *CacheStore) ReadVersion(key string, version int64) ([]byte, error) {
+	if err := s.online(); err != nil {
+		return nil, err
+	}
+	vs, err := AsVersionedStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	return vs.ReadVersion(key, version)
+}
+
+// ListNamespaces returns the namespaces of the wrapped store.
+func (s *CacheStore) ListNamespaces() ([]string, error) {
+	if err := s.online(); err != nil {
+		return nil, err
+	}
+	ns, err := AsNamespacedStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	return ns.ListNamespaces()
+}
+
+// Trash moves a secret to the trash of the wrapped store.
+func (s *CacheStore) Trash(key string) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	ts, err := AsTrashStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	if err := ts.Trash(key); err != nil {
+		return err
+	}
+	s.invalidate(key)
+	return nil
+}
+
+// ListTrash returns the secrets in the trash of the wrapped store.
+func (s *CacheStore) ListTrash() ([]TrashedSecret, error) {
+	if err := s.online(); err != nil {
+		return nil, err
+	}
+	ts, err := AsTrashStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	return ts.ListTrash()
+}
+
+// Restore moves a secret out of the trash of the wrapped store.
+func (s *CacheStore) Restore(key string) error {
+	if err := s.online(); err != nil {
+		return err
+	}
+	ts, err := AsTrashStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	if err := ts.Restore(key); err != nil {
+		return err
+	}
+	s.invalidate(key)
+	return nil
+}
+
+// Purge permanently removes old secrets from the trash of the wrapped store.
+func (s *CacheStore) Purge(before time.Time) ([]string, error) {
+	if err := s.online(); err != nil {
+		return nil, err
+	}
+	ts, err := AsTrashStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	return ts.Purge(before)
+}
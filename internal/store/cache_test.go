@@ -0,0 +1,186 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+	"secrets-cli/internal/store"
+	"secrets-cli/internal/store/storetest"
+)
+
+// cacheTestKey encrypts the cache files of the tests.
+var cacheTestKey = bytes.Repeat([]byte{7}, 32)
+
+func TestCacheStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		s, err := store.NewCacheStore(store.NewMemoryStore(), filepath.Join(t.TempDir(), "test.cache"), cacheTestKey, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return initStore(t, s)
+	})
+}
+
+// flakyStore is a memory store whose Init and Read fail while down is set,
+// like a remote backend without network.
+type flakyStore struct {
+	*store.MemoryStore
+	down bool
+}
+
+var errUnreachable = fmt.Errorf("dial tcp: network is unreachable")
+
+func (s *flakyStore) Init() error {
+	if s.down {
+		return errUnreachable
+	}
+	return s.MemoryStore.Init()
+}
+
+func (s *flakyStore) Read(key string) ([]byte, error) {
+	if s.down {
+		return nil, errUnreachable
+	}
+	return s.MemoryStore.Read(key)
+}
+
+func TestCacheStoreOffline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cache")
+	inner := &flakyStore{MemoryStore: store.NewMemoryStore()}
+	open := func(ttl time.Duration) (*store.CacheStore, *bytes.Buffer) {
+		t.Helper()
+		s, err := store.NewCacheStore(inner, path, cacheTestKey, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var warnings bytes.Buffer
+		s.Warnings = &warnings
+		if err := s.Init(); err != nil {
+			t.Fatalf("Init failed: %v", err)
+		}
+		return s, &warnings
+	}
+
+	s, _ := open(time.Hour)
+	if err := s.Create("db_password", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// A fresh entry is served without asking the backend
+	inner.down = true
+	s, warnings := open(time.Hour)
+	if value, err := s.Read("db_password"); err != nil || string(value) != "v1" {
+		t.Fatalf("Read while offline = %q, %v; want cached v1", value, err)
+	}
+	if !strings.Contains(warnings.String(), "using cached value of 'db_password'") {
+		t.Errorf("offline read printed %q, want a stale warning", warnings.String())
+	}
+	if _, err := s.Read("api_token"); !errors.Is(err, errUnreachable) {
+		t.Errorf("Read of uncached key while offline = %v, want the Init error", err)
+	}
+	if err := s.Update("db_password", []byte("v2")); !errors.Is(err, errUnreachable) {
+		t.Errorf("Update while offline = %v, want the Init error", err)
+	}
+	s.Close()
+
+	// A stale entry is refreshed once the backend is back
+	inner.down = false
+	if err := inner.Update("db_password", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = open(time.Nanosecond)
+	if value, err := s.Read("db_password"); err != nil || string(value) != "v2" {
+		t.Fatalf("Read of stale entry = %q, %v; want v2 from the backend", value, err)
+	}
+	s.Close()
+
+	// and served with a warning when the backend fails to answer
+	inner.down = true
+	s, warnings = open(time.Nanosecond)
+	if value, err := s.Read("db_password"); err != nil || string(value) != "v2" {
+		t.Fatalf("Read of stale entry while down = %q, %v; want cached v2", value, err)
+	}
+	if warnings.Len() == 0 {
+		t.Error("stale read printed no warning")
+	}
+	s.Close()
+}
+
+func TestCacheStoreWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cache")
+	inner := &flakyStore{MemoryStore: store.NewMemoryStore()}
+	s, _ := store.NewCacheStore(inner, path, cacheTestKey, time.Hour)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("db_password", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// A cache encrypted with another key is ignored, not an error
+	inner.down = true
+	other, _ := store.NewCacheStore(inner, path, bytes.Repeat([]byte{8}, 32), time.Hour)
+	if err := other.Init(); !errors.Is(err, errUnreachable) {
+		t.Fatalf("Init with unreadable cache and unreachable backend = %v, want the backend error", err)
+	}
+}
+
+func TestCacheKeyDerivedFromEncryptionKey(t *testing.T) {
+	dir := t.TempDir()
+	previous := []string{store.BackendType, store.DirRoot, store.CacheDir}
+	previousTTL := store.CacheTTL
+	t.Cleanup(func() {
+		store.BackendType, store.DirRoot, store.CacheDir = previous[0], previous[1], previous[2]
+		store.CacheTTL = previousTTL
+	})
+	store.BackendType, store.DirRoot, store.CacheDir = "dir", filepath.Join(dir, "secrets"), filepath.Join(dir, "cache")
+	store.CacheTTL = time.Hour
+	master := bytes.Repeat([]byte{9}, 32)
+	t.Setenv(key.EnvKeyName, base64.StdEncoding.EncodeToString(master))
+
+	s, err := store.GetSecretStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("db", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(store.CacheDir, "*.cache"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("cache files = %v, %v, want one", paths, err)
+	}
+	content, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crypto.Decrypt(content, master); err == nil {
+		t.Fatal("cache file decrypts with the encryption key itself")
+	}
+	cacheKey, err := crypto.DeriveKey(master, "secrets-cli cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crypto.Decrypt(content, cacheKey); err != nil {
+		t.Fatalf("cache file doesn't decrypt with the derived key: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"slices"
+)
+
+// ContextStore is the context-aware version of SecretStore. Every operation
+// gives up with the context's error once the context is canceled or its
+// deadline passes, so a hung backend can be timed out or interrupted.
+//
+// The backends implement SecretStore; NewContextStore adapts them. Backends
+// opened by OpenStore that honor a context natively, such as sqlite, run
+// under it; the others run in a goroutine that is abandoned when the context
+// is done.
+type ContextStore interface {
+	// Init initializes the storage backend.
+	Init(ctx context.Context) error
+	// Close closes the storage backend resources.
+	Close() error
+
+	// Create stores a new encrypted value associated with a key.
+	// Returns an error wrapping ErrSecretAlreadyExists if the key exists.
+	Create(ctx context.Context, key string, encryptedValue []byte) error
+	// Read retrieves the encrypted value for a given key.
+	// Returns an error wrapping ErrSecretNotFound if the key doesn't exist.
+	Read(ctx context.Context, key string) ([]byte, error)
+	// Update updates the encrypted value for an existing key.
+	// Returns an error wrapping ErrSecretNotFound if the key doesn't exist.
+	Update(ctx context.Context, key string, encryptedValue []byte) error
+	// Delete removes a secret by its key.
+	// Returns an error wrapping ErrSecretNotFound if the key doesn't exist.
+	Delete(ctx context.Context, key string) error
+
+	// Exists reports whether a secret with the given key exists.
+	Exists(ctx context.Context, key string) (bool, error)
+	// Upsert creates the secret or updates it if it exists, and reports
+	// whether it was created.
+	Upsert(ctx context.Context, key string, encryptedValue []byte) (bool, error)
+	// BatchGet reads several secrets. Keys that don't exist are missing from
+	// the returned map.
+	BatchGet(ctx context.Context, keys []string) (map[string][]byte, error)
+	// List iterates over the keys selected by opts in ascending order. An
+	// error ends the iteration.
+	List(ctx context.Context, opts ListOptions) iter.Seq2[string, error]
+}
+
+// ListOptions select the keys returned by ContextStore.List. Pages are read
+// by passing the last key of the previous page as After.
+type ListOptions struct {
+	Prefix string // Only keys starting with Prefix
+	After  string // Only keys sorting after After
+	Limit  int    // At most Limit keys, 0 for all
+}
+
+// NewContextStore adapts a SecretStore to ContextStore.
+func NewContextStore(s SecretStore) ContextStore {
+	return &contextAdapter{s: s}
+}
+
+// contextAdapter implements ContextStore on top of a SecretStore.
+type contextAdapter struct {
+	s SecretStore
+}
+
+// contextBinder is implemented by stores that honor a context natively.
+// OpenStore binds the context of the command before Init, and every
+// operation afterwards runs under it.
+type contextBinder interface {
+	bindContext(ctx context.Context)
+	boundContext() context.Context
+}
+
+// contextBinding implements contextBinder for the backends embedding it.
+type contextBinding struct {
+	bound context.Context
+}
+
+// bindContext makes the operations of the store run under ctx.
+func (b *contextBinding) bindContext(ctx context.Context) {
+	b.bound = ctx
+}
+
+// boundContext returns the context bound to the store, nil if none is.
+func (b *contextBinding) boundContext() context.Context {
+	return b.bound
+}
+
+// ctx returns the context the operations run under.
+func (b *contextBinding) ctx() context.Context {
+	if b.bound == nil {
+		return context.Background()
+	}
+	return b.bound
+}
+
+// keyPager is implemented by stores that read a page of keys in one query.
+type keyPager interface {
+	// listPage returns up to limit keys starting with prefix and sorting
+	// after after, in ascending order; all of them if limit is 0.
+	listPage(prefix, after string, limit int) ([]string, error)
+}
+
+// RunContext runs fn, an operation of s, bounded by ctx. If s runs under ctx
+// natively, fn is called directly and gives up by itself. Otherwise it runs
+// until it returns or ctx is done, whichever comes first; fn can't be
+// interrupted then: when ctx wins, fn keeps running in the background and a
+// write it makes may still be applied.
+func RunContext(ctx context.Context, s SecretStore, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if boundTo(s, ctx) {
+		return fn()
+	}
+	done := make(chan error, 1) // Buffered so an abandoned fn can finish
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// boundTo reports whether s runs under ctx natively.
+func boundTo(s SecretStore, ctx context.Context) bool {
+	cb, ok := s.(contextBinder)
+	return ok && cb.boundContext() == ctx
+}
+
+// Init initializes the wrapped store.
+func (a *contextAdapter) Init(ctx context.Context) error {
+	return RunContext(ctx, a.s, a.s.Init)
+}
+
+// Close closes the wrapped store.
+func (a *contextAdapter) Close() error {
+	return a.s.Close()
+}
+
+// Create stores a new encrypted value in the wrapped store.
+func (a *contextAdapter) Create(ctx context.Context, key string, encryptedValue []byte) error {
+	return RunContext(ctx, a.s, func() error { return a.s.Create(key, encryptedValue) })
+}
+
+// Read retrieves an encrypted value from the wrapped store.
+func (a *contextAdapter) Read(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := RunContext(ctx, a.s, func() (err error) {
+		value, err = a.s.Read(key)
+		return err
+	})
+	return value, err
+}
+
+// Update updates an encrypted value in the wrapped store.
+func (a *contextAdapter) Update(ctx context.Context, key string, encryptedValue []byte) error {
+	return RunContext(ctx, a.s, func() error { return a.s.Update(key, encryptedValue) })
+}
+
+// Delete removes a secret from the wrapped store.
+func (a *contextAdapter) Delete(ctx context.Context, key string) error {
+	return RunContext(ctx, a.s, func() error { return a.s.Delete(key) })
+}
+
+// Exists reads the secret to find out whether it exists.
+func (a *contextAdapter) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := a.Read(ctx, key)
+	if errors.Is(err, ErrSecretNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Upsert creates the secret and falls back to updating it if it exists.
+func (a *contextAdapter) Upsert(ctx context.Context, key string, encryptedValue []byte) (bool, error) {
+	err := a.Create(ctx, key, encryptedValue)
+	if !errors.Is(err, ErrSecretAlreadyExists) {
+		return err == nil, err
+	}
+	return false, a.Update(ctx, key, encryptedValue)
+}
+
+// BatchGet reads the secrets one by one.
+func (a *contextAdapter) BatchGet(ctx context.Context, keys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, err := a.Read(ctx, key)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// List reads the requested page of keys in one query if the wrapped store
+// can, and otherwise reads the matching keys at once and iterates over the
+// page.
+func (a *contextAdapter) List(ctx context.Context, opts ListOptions) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var keys []string
+		err := RunContext(ctx, a.s, func() (err error) {
+			keys, err = a.listPage(opts)
+			return err
+		})
+		if err != nil {
+			yield("", err)
+			return
+		}
+
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				yield("", err)
+				return
+			}
+			if !yield(key, nil) {
+				return
+			}
+		}
+	}
+}
+
+// listPage returns the keys selected by opts in ascending order.
+func (a *contextAdapter) listPage(opts ListOptions) ([]string, error) {
+	if p, ok := a.s.(keyPager); ok {
+		return p.listPage(opts.Prefix, opts.After, opts.Limit)
+	}
+	keys, err := ListKeysWithPrefix(a.s, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys = slices.Clone(keys)
+	slices.Sort(keys)
+	start, found := slices.BinarySearch(keys, opts.After)
+	if found {
+		start++
+	}
+	keys = keys[start:]
+	if opts.Limit > 0 && len(keys) > opts.Limit {
+		keys = keys[:opts.Limit]
+	}
+	return keys, nil
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreHonorsContext(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "secrets.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := initContext(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Create("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A bound store runs fn directly rather than abandoning it
+	finished := false
+	err = RunContext(ctx, s, func() error {
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		finished = true
+		return nil
+	})
+	if err != nil || !finished {
+		t.Fatalf("RunContext = %v, finished %v; want fn run to its end", err, finished)
+	}
+
+	if _, err := s.Read("a"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Read after cancel = %v, want context.Canceled", err)
+	}
+	if err := s.Update("a", []byte("2")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Update after cancel = %v, want context.Canceled", err)
+	}
+}
+
+func TestPluginStoreKilledOnDeadline(t *testing.T) {
+	// TestMain in plugin_test.go serves a store whose reads hang
+	t.Setenv("SECRETS_CLI_TEST_PLUGIN", "1")
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewPluginStore(executable, "hang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := initContext(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Read("a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Read of a hung plugin = %v, want context.DeadlineExceeded", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close of a killed plugin = %v", err)
+	}
+}
@@ -0,0 +1,723 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dirSecretExt is the file extension of a secret inside the store root.
+	dirSecretExt = ".sec"
+	// dirMetaExt is the file extension of the JSON metadata sidecar of a secret.
+	dirMetaExt = ".meta"
+	// dirHistoryDir is the hidden directory below the root holding previous
+	// versions, one <key>.versions/<version>.json file each.
+	dirHistoryDir = ".history"
+	// dirVersionsExt is the extension of the history directory of a secret.
+	dirVersionsExt = ".versions"
+	// dirTrashDir is the hidden directory below the root holding soft-deleted
+	// secrets, one <key>.json record each.
+	dirTrashDir = ".trash"
+	// dirNamespacesDir is the hidden directory below the root holding one
+	// store tree per namespace other than the default one.
+	dirNamespacesDir = ".namespaces"
+	// dirLockFile is the lock file below the root taken by updates.
+	dirLockFile = ".lock"
+)
+
+// DirStore implements the SecretStore interface using a directory tree with
+// one file per secret. A key such as "prod/db/password" is stored in
+// <root>/prod/db/password.sec, similar to the layout used by `pass`, with its
+// metadata in <root>/prod/db/password.meta and its previous versions below
+// <root>/.history/prod/db/password.versions. Soft-deleted secrets are moved to
+// <root>/.trash. Other namespaces than the default one use the same layout
+// below <root>/.namespaces/<namespace>. Updates hold an advisory lock on
+// <root>/.lock.
+type DirStore struct {
+	Root             string
+	Namespace        string        // Namespace the store operates on
+	HistoryRetention int           // Number of previous versions kept per secret
+	LockTimeout      time.Duration // How long updates wait for another process's lock
+}
+
+// NewDirStore creates a new DirStore instance.
+func NewDirStore(root string) (*DirStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("%w: directory store root cannot be empty", ErrInvalidConfiguration)
+	}
+	return &DirStore{
+		Root:             root,
+		Namespace:        DefaultNamespace,
+		HistoryRetention: DefaultHistoryRetention,
+		LockTimeout:      DefaultLockTimeout,
+	}, nil
+}
+
+// setHistoryRetention sets the number of previous versions kept per secret.
+func (s *DirStore) setHistoryRetention(n int) {
+	s.HistoryRetention = n
+}
+
+// setNamespace selects the namespace the store operates on.
+func (s *DirStore) setNamespace(ns string) {
+	s.Namespace = ns
+}
+
+// dir returns the directory holding the tree of the selected namespace.
+func (s *DirStore) dir() string {
+	if s.Namespace == "" || s.Namespace == DefaultNamespace {
+		return s.Root
+	}
+	return filepath.Join(s.Root, dirNamespacesDir, s.Namespace)
+}
+
+// Init ensures the root directory exists.
+func (s *DirStore) Init() error {
+	if err := os.MkdirAll(s.Root, 0700); err != nil {
+		return fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return nil
+}
+
+// Close does nothing for a directory-based store.
+func (s *DirStore) Close() error {
+	return nil // No resources to close
+}
+
+// secretPath maps a key to the path of its file, rejecting keys that would
+// escape the root directory or be hidden from ListKeys.
+func (s *DirStore) secretPath(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("%w: secret key cannot be empty", ErrInvalidKey)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || strings.HasPrefix(part, ".") || strings.ContainsRune(part, '\\') {
+			return "", fmt.Errorf("%w: '%s' is not a valid path for the directory store", ErrInvalidKey, key)
+		}
+	}
+	return filepath.Join(s.dir(), filepath.FromSlash(key)+dirSecretExt), nil
+}
+
+// metaPath returns the metadata sidecar path of a secret file.
+func metaPath(secretPath string) string {
+	return strings.TrimSuffix(secretPath, dirSecretExt) + dirMetaExt
+}
+
+// encodeSecret returns the file content for an encrypted value. Values are
+// stored base64 encoded so that files diff cleanly as text.
+func encodeSecret(encryptedValue []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(encryptedValue) + "\n")
+}
+
+// writeTemp writes content to a temporary file next to path and returns the
+// temp file name. The caller is responsible for moving it in place.
+func (s *DirStore) writeTemp(path string, content []byte) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create secret directory: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".secrets-dir-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpFilePath := tmpFile.Name()
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFilePath)
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFilePath)
+		return "", fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFilePath)
+		return "", fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Chmod(tmpFilePath, 0600); err != nil {
+		os.Remove(tmpFilePath)
+		return "", fmt.Errorf("failed to set permissions on temp file: %w", err)
+	}
+	return tmpFilePath, nil
+}
+
+// Create stores a new encrypted value.
+func (s *DirStore) Create(key string, encryptedValue []byte) error {
+	return s.CreateWithMetadata(key, encryptedValue, nil)
+}
+
+// CreateWithMetadata stores a new encrypted value and writes its metadata
+// file with edit applied.
+func (s *DirStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	path, err := s.secretPath(key)
+	if err != nil {
+		return err
+	}
+
+	tmpFilePath, err := s.writeTemp(path, encodeSecret(encryptedValue))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFilePath)
+
+	// Link fails if the target exists, which makes the create atomic
+	if err := os.Link(tmpFilePath, path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+		}
+		return fmt.Errorf("failed to create secret file: %w", err)
+	}
+	md := newMetadata()
+	edit.apply(&md)
+	return s.writeMetadata(path, md)
+}
+
+// replaceFile atomically replaces path with content.
+func (s *DirStore) replaceFile(path string, content []byte) error {
+	tmpFilePath, err := s.writeTemp(path, content)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFilePath, path); err != nil {
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
+
+// readMetadata reads the metadata sidecar of a secret file, returning a zero
+// Metadata if there is none.
+func (s *DirStore) readMetadata(secretPath string) (Metadata, error) {
+	var md Metadata
+	content, err := os.ReadFile(metaPath(secretPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return md, nil
+	}
+	if err != nil {
+		return md, fmt.Errorf("failed to read metadata file: %w", err)
+	}
+	if err := json.Unmarshal(content, &md); err != nil {
+		return md, fmt.Errorf("failed to decode metadata file '%s': %w", metaPath(secretPath), err)
+	}
+	return md, nil
+}
+
+// writeMetadata atomically replaces the metadata sidecar of a secret file.
+func (s *DirStore) writeMetadata(secretPath string, md Metadata) error {
+	content, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return s.replaceFile(metaPath(secretPath), append(content, '\n'))
+}
+
+// Read retrieves an encrypted value.
+func (s *DirStore) Read(key string) ([]byte, error) {
+	path, err := s.secretPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 value for key '%s': %w", key, err)
+	}
+	return value, nil
+}
+
+// ReadRevision retrieves an encrypted value and the revision recorded in its
+// metadata file.
+func (s *DirStore) ReadRevision(key string) ([]byte, int64, error) {
+	value, err := s.Read(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	md, err := s.ReadMetadata(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, currentVersion(md), nil
+}
+
+// Update updates an existing encrypted value.
+func (s *DirStore) Update(key string, encryptedValue []byte) error {
+	return s.UpdateWithMetadata(key, anyRevision, encryptedValue, nil)
+}
+
+// CompareAndSwap updates a secret if it is still at expectedRevision.
+func (s *DirStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	return s.UpdateWithMetadata(key, expectedRevision, encryptedValue, nil)
+}
+
+// UpdateWithMetadata replaces the value of a secret at the expected revision
+// and writes its metadata file once, with edit applied. The lock on
+// <root>/.lock keeps other updates from slipping in between the revision
+// check and the write.
+func (s *DirStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	path, err := s.secretPath(key)
+	if err != nil {
+		return err
+	}
+	fl, err := acquireFileLock(filepath.Join(s.Root, dirLockFile), s.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer fl.Unlock()
+
+	old, err := s.Read(key)
+	if err != nil {
+		return err
+	}
+	md, err := s.readMetadata(path)
+	if err != nil {
+		return err
+	}
+	if err := checkRevision(key, md, expectedRevision); err != nil {
+		return err
+	}
+	if err := s.archiveVersion(key, archiveVersion(old, md)); err != nil {
+		return err
+	}
+
+	if err := s.replaceFile(path, encodeSecret(encryptedValue)); err != nil {
+		return err
+	}
+
+	md.Version = currentVersion(md) + 1
+	md.UpdatedAt = time.Now().UTC()
+	edit.apply(&md)
+	return s.writeMetadata(path, md)
+}
+
+// Delete removes a secret and any directories left empty by its removal.
+func (s *DirStore) Delete(key string) error {
+	path, err := s.secretPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	} else if err != nil {
+		return fmt.Errorf("failed to delete secret file: %w", err)
+	}
+	if err := os.Remove(metaPath(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete metadata file: %w", err)
+	}
+	s.pruneEmptyDirs(filepath.Dir(path))
+
+	versions, err := s.versionNumbers(key)
+	if err != nil {
+		return err
+	}
+	historyDir := s.historyDir(key)
+	for _, version := range versions {
+		if err := os.Remove(s.versionPath(key, version)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete history file: %w", err)
+		}
+	}
+	s.pruneEmptyDirs(historyDir)
+	return nil
+}
+
+// historyDir returns the directory holding the previous versions of a key,
+// which must already have been validated by secretPath.
+func (s *DirStore) historyDir(key string) string {
+	return filepath.Join(s.dir(), dirHistoryDir, filepath.FromSlash(key)+dirVersionsExt)
+}
+
+// versionPath returns the history file of one version of a key.
+func (s *DirStore) versionPath(key string, version int64) string {
+	return filepath.Join(s.historyDir(key), strconv.FormatInt(version, 10)+".json")
+}
+
+// versionNumbers returns the versions kept in the history of a key, newest
+// first. Files that aren't named after a version are ignored.
+func (s *DirStore) versionNumbers(key string) ([]int64, error) {
+	entries, err := os.ReadDir(s.historyDir(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+
+	var versions []int64
+	for _, entry := range entries {
+		version, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), ".json"), 10, 64)
+		if err != nil || entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+	slices.Reverse(versions)
+	return versions, nil
+}
+
+// archiveVersion writes v to the history of key and removes the oldest
+// versions beyond the retention.
+func (s *DirStore) archiveVersion(key string, v SecretVersion) error {
+	if s.HistoryRetention > 0 {
+		if err := s.writeVersion(key, v); err != nil {
+			return err
+		}
+	}
+
+	versions, err := s.versionNumbers(key)
+	if err != nil {
+		return err
+	}
+	for _, version := range versions[min(len(versions), max(s.HistoryRetention, 0)):] {
+		if err := os.Remove(s.versionPath(key, version)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete history file: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeVersion writes one history file of a key.
+func (s *DirStore) writeVersion(key string, v SecretVersion) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+	return s.replaceFile(s.versionPath(key, v.Version), append(content, '\n'))
+}
+
+// readVersion decodes one history file of a key.
+func (s *DirStore) readVersion(key string, version int64) (SecretVersion, error) {
+	var v SecretVersion
+	content, err := os.ReadFile(s.versionPath(key, version))
+	if errors.Is(err, fs.ErrNotExist) {
+		return v, versionNotFound(key, version)
+	}
+	if err != nil {
+		return v, fmt.Errorf("failed to read history file: %w", err)
+	}
+	if err := json.Unmarshal(content, &v); err != nil {
+		return v, fmt.Errorf("failed to decode history file '%s': %w", s.versionPath(key, version), err)
+	}
+	return v, nil
+}
+
+// pruneEmptyDirs removes empty directories from dir up to (excluding) the root.
+func (s *DirStore) pruneEmptyDirs(dir string) {
+	for {
+		rel, err := filepath.Rel(s.Root, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		}
+		// Remove fails on non-empty directories, which ends the walk
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// ListKeys lists all available keys by walking the directory tree.
+func (s *DirStore) ListKeys() ([]string, error) {
+	return s.ListKeysWithPrefix("")
+}
+
+// ListKeysWithPrefix lists the keys starting with prefix, walking only the
+// directory named by the prefix's path components.
+func (s *DirStore) ListKeysWithPrefix(prefix string) ([]string, error) {
+	root := s.dir()
+	start := root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		for _, part := range strings.Split(prefix[:i], "/") {
+			if part == "" || strings.HasPrefix(part, ".") || strings.ContainsRune(part, '\\') {
+				return nil, nil // No valid key lives below such a path
+			}
+		}
+		start = filepath.Join(root, filepath.FromSlash(prefix[:i]))
+	}
+
+	var keys []string
+	err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == start {
+			return filepath.SkipAll // Namespace or directory without secrets
+		}
+		if err != nil {
+			return err
+		}
+		// Skip hidden entries such as .git or leftover temp files
+		if path != start && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), dirSecretExt) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(strings.TrimSuffix(rel, dirSecretExt)); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secret files: %w", err)
+	}
+	return keys, nil
+}
+
+// ReadMetadata returns the metadata of a secret.
+func (s *DirStore) ReadMetadata(key string) (Metadata, error) {
+	path, err := s.secretPath(key)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return Metadata{}, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	} else if err != nil {
+		return Metadata{}, fmt.Errorf("failed to stat secret file: %w", err)
+	}
+	return s.readMetadata(path)
+}
+
+// WriteMetadata replaces the metadata of a secret.
+func (s *DirStore) WriteMetadata(key string, md Metadata) error {
+	path, err := s.secretPath(key)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	} else if err != nil {
+		return fmt.Errorf("failed to stat secret file: %w", err)
+	}
+	current, err := s.readMetadata(path)
+	if err != nil {
+		return err
+	}
+	md.Version = current.Version
+	return s.writeMetadata(path, md)
+}
+
+// ListVersions returns the retained previous versions of a secret.
+func (s *DirStore) ListVersions(key string) ([]SecretVersion, error) {
+	if _, err := s.ReadMetadata(key); err != nil {
+		return nil, err
+	}
+
+	versionNumbers, err := s.versionNumbers(key)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]SecretVersion, 0, len(versionNumbers))
+	for _, version := range versionNumbers {
+		v, err := s.readVersion(key, version)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// ReadVersion returns the value of the current or a previous version.
+func (s *DirStore) ReadVersion(key string, version int64) ([]byte, error) {
+	md, err := s.ReadMetadata(key)
+	if err != nil {
+		return nil, err
+	}
+	if version == currentVersion(md) {
+		return s.Read(key)
+	}
+
+	v, err := s.readVersion(key, version)
+	if err != nil {
+		return nil, err
+	}
+	return v.Value, nil
+}
+
+// trashPath returns the trash record file of a key, which must already have
+// been validated by secretPath.
+func (s *DirStore) trashPath(key string) string {
+	return filepath.Join(s.dir(), dirTrashDir, filepath.FromSlash(key)+".json")
+}
+
+// readTrashRecord decodes the trash record of a key.
+func (s *DirStore) readTrashRecord(key string) (trashRecord, error) {
+	var record trashRecord
+	content, err := os.ReadFile(s.trashPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return record, notInTrash(key)
+	}
+	if err != nil {
+		return record, fmt.Errorf("failed to read trash file: %w", err)
+	}
+	if err := json.Unmarshal(content, &record); err != nil {
+		return record, fmt.Errorf("failed to decode trash file '%s': %w", s.trashPath(key), err)
+	}
+	return record, nil
+}
+
+// removeTrashRecord deletes the trash record of a key and any directories
+// left empty by its removal.
+func (s *DirStore) removeTrashRecord(key string) error {
+	path := s.trashPath(key)
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete trash file: %w", err)
+	}
+	s.pruneEmptyDirs(filepath.Dir(path))
+	return nil
+}
+
+// Trash moves a secret with its metadata and history into a record below
+// <root>/.trash, which must not exist yet.
+func (s *DirStore) Trash(key string) error {
+	value, err := s.Read(key)
+	if err != nil {
+		return err
+	}
+	record := trashRecord{Value: value, DeletedAt: time.Now().UTC()}
+	if record.Metadata, err = s.ReadMetadata(key); err != nil {
+		return err
+	}
+	if record.History, err = s.ListVersions(key); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trash record: %w", err)
+	}
+	tmpFilePath, err := s.writeTemp(s.trashPath(key), append(content, '\n'))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFilePath)
+
+	// Link fails if the key is already in the trash
+	if err := os.Link(tmpFilePath, s.trashPath(key)); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return alreadyInTrash(key)
+		}
+		return fmt.Errorf("failed to create trash record: %w", err)
+	}
+	return s.Delete(key)
+}
+
+// ListTrash returns the secrets below <root>/.trash.
+func (s *DirStore) ListTrash() ([]TrashedSecret, error) {
+	trashRoot := filepath.Join(s.dir(), dirTrashDir)
+	var trashed []TrashedSecret
+	err := filepath.WalkDir(trashRoot, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == trashRoot {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		// Skip leftover temp files
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(trashRoot, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(strings.TrimSuffix(rel, ".json"))
+		record, err := s.readTrashRecord(key)
+		if err != nil {
+			return err
+		}
+		trashed = append(trashed, TrashedSecret{Key: key, DeletedAt: record.DeletedAt})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash files: %w", err)
+	}
+	return trashed, nil
+}
+
+// Restore moves a secret with its metadata and history out of the trash.
+func (s *DirStore) Restore(key string) error {
+	path, err := s.secretPath(key)
+	if err != nil {
+		return err
+	}
+	record, err := s.readTrashRecord(key)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Create(key, record.Value); err != nil {
+		return err
+	}
+	if err := s.writeMetadata(path, record.Metadata); err != nil {
+		return err
+	}
+	for _, v := range record.History {
+		if err := s.writeVersion(key, v); err != nil {
+			return err
+		}
+	}
+	return s.removeTrashRecord(key)
+}
+
+// Purge permanently removes the secrets trashed before the given time.
+func (s *DirStore) Purge(before time.Time) ([]string, error) {
+	trashed, err := s.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []string
+	for _, t := range trashed {
+		if !t.DeletedAt.Before(before) {
+			continue
+		}
+		if err := s.removeTrashRecord(t.Key); err != nil {
+			return purged, err
+		}
+		purged = append(purged, t.Key)
+	}
+	return purged, nil
+}
+
+// ListNamespaces returns the namespaces that contain secrets.
+func (s *DirStore) ListNamespaces() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Root, dirNamespacesDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && namespacePattern.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return namespaceList(names), nil
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultLockTimeout is how long a store waits for the lock held by
+	// another process before giving up.
+	DefaultLockTimeout = 10 * time.Second
+	// lockRetryInterval is the delay between attempts to take a busy lock.
+	lockRetryInterval = 20 * time.Millisecond
+)
+
+// ErrLockTimeout is returned when a store lock could not be acquired in time.
+var ErrLockTimeout = fmt.Errorf("timed out waiting for store lock")
+
+// fileLock is an exclusive advisory lock on a lock file. It is shared with
+// other processes (flock on unix, LockFileEx on windows) so that
+// read-modify-write cycles of different secrets-cli invocations don't interleave.
+type fileLock struct {
+	f *os.File
+}
+
+// acquireFileLock takes an exclusive lock on path, creating the file if
+// needed, and retries until timeout has elapsed.
+func acquireFileLock(path string, timeout time.Duration) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock '%s': %w", path, err)
+		}
+		if locked {
+			return &fileLock{f: f}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%w: '%s' is held by another process (waited %s)", ErrLockTimeout, path, timeout)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Unlock releases the lock. The lock file itself is left in place, removing
+// it would race with processes waiting on the old inode.
+func (l *fileLock) Unlock() error {
+	if err := unlockFile(l.f); err != nil {
+		l.f.Close()
+		return fmt.Errorf("failed to unlock '%s': %w", l.f.Name(), err)
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// StoreFiles returns the existing files and directories that hold secrets
+// of the configured backend, such as the database with its write-ahead log,
+// followed by the cache directory and its files.
+func StoreFiles() []string {
+	var candidates []string
+	switch BackendType {
+	case "sqlite":
+		candidates = []string{SqliteDBPath, SqliteDBPath + "-wal", SqliteDBPath + "-shm", SqliteDBPath + "-journal"}
+	case "jsonfile":
+		candidates = []string{JsonFilePath}
+	case "bolt":
+		candidates = []string{BoltDBPath}
+	case "dir":
+		// Every secret is a file of its own
+		candidates = walkFiles(DirRoot)
+	}
+	if dir, err := cacheDir(); err == nil {
+		candidates = append(candidates, walkFiles(dir)...)
+	}
+
+	var files []string
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// walkFiles returns root and everything below it.
+func walkFiles(root string) []string {
+	if root == "" {
+		return nil
+	}
+	var paths []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths
+}
@@ -0,0 +1,778 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// gitDefaultRemote is the remote used by Sync when none is configured.
+	gitDefaultRemote = "origin"
+	// gitFallbackName and gitFallbackEmail are used as commit identity when
+	// the user has not configured one, so commits never fail on fresh machines.
+	gitFallbackName  = "secrets-cli"
+	gitFallbackEmail = "secrets-cli@localhost"
+)
+
+// ErrSyncConflict is returned by Sync when local and remote changes cannot be
+// merged automatically.
+var ErrSyncConflict = errors.New("sync conflict")
+
+// GitStore wraps a file-based SecretStore and records every change as a
+// commit in a local git repository. Sync exchanges those commits with a remote.
+type GitStore struct {
+	Inner      SecretStore
+	RepoDir    string     // Directory inside the git repository holding the store files
+	Paths      []string   // Store files or directories, relative to RepoDir
+	Ignore     []string   // Files next to the store files never to commit, such as lock files
+	Attributes []string   // Lines of .gitattributes for the store files, such as merge drivers
+	Remote     string     // Remote used by Sync, a configured remote or a URL
+	mu         sync.Mutex // Serializes changes so each one gets its own commit
+}
+
+// NewGitStore wraps inner so that changes to paths (relative to repoDir) are
+// committed to git.
+func NewGitStore(inner SecretStore, repoDir string, paths []string, remote string) (*GitStore, error) {
+	if repoDir == "" || len(paths) == 0 {
+		return nil, fmt.Errorf("%w: git store needs a repository directory and store paths", ErrInvalidConfiguration)
+	}
+	if remote == "" {
+		remote = gitDefaultRemote
+	}
+	return &GitStore{Inner: inner, RepoDir: repoDir, Paths: paths, Remote: remote}, nil
+}
+
+// newGitStore wraps inner, the file-based backend selected by BackendType, so
+// that its changes are committed to the git repository containing it.
+func newGitStore(inner SecretStore) (*GitStore, error) {
+	var (
+		path   string
+		ignore []string
+	)
+	switch BackendType {
+	case "jsonfile":
+		path = JsonFilePath
+		ignore = []string{".lock", "secrets-json-*", "secrets-sealed-*"}
+	case "bolt":
+		path = BoltDBPath
+	case "sqlite":
+		path = SqliteDBPath
+		ignore = []string{"-wal", "-shm", "-journal", ".lock", "secrets-sealed-*"}
+		if err := useRollbackJournal(inner); err != nil {
+			return nil, err
+		}
+	case "dir":
+		s, err := NewGitStore(inner, DirRoot, []string{"."}, GitRemote)
+		if err != nil {
+			return nil, err
+		}
+		// Hidden files are temp files of interrupted writes
+		s.Ignore = []string{".secrets-dir-*"}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%w: git tracking is not supported for backend '%s'", ErrInvalidConfiguration, BackendType)
+	}
+
+	name := filepath.Base(path)
+	s, err := NewGitStore(inner, filepath.Dir(path), []string{name}, GitRemote)
+	if err != nil {
+		return nil, err
+	}
+	for _, suffix := range ignore {
+		if strings.Contains(suffix, "*") {
+			s.Ignore = append(s.Ignore, "/"+suffix)
+		} else {
+			s.Ignore = append(s.Ignore, "/"+gitPattern(name+suffix))
+		}
+	}
+	// Records appended by both sides of a merge are kept in turn, and
+	// replaying them leaves the last change to a secret in effect
+	if BackendType == "jsonfile" && JsonFormat == JSONFormatJournal {
+		s.Attributes = []string{"/" + gitPattern(name) + " merge=union"}
+	}
+	return s, nil
+}
+
+// useRollbackJournal switches a SQLite store to the delete journal mode. In
+// WAL mode committed transactions stay in the -wal file until a checkpoint,
+// so git would commit a database file without the latest changes.
+func useRollbackJournal(inner SecretStore) error {
+	var s *SQLiteStore
+	switch inner := inner.(type) {
+	case *SQLiteStore:
+		s = inner
+	case *SealedSQLiteStore:
+		s = inner.Inner
+	default:
+		return nil
+	}
+	if SqliteJournalMode == "wal" {
+		return fmt.Errorf("%w: the sqlite journal mode 'wal' can't be used with git tracking; use 'delete', 'truncate' or 'persist'",
+			ErrInvalidConfiguration)
+	}
+	if SqliteJournalMode == "" {
+		s.JournalMode = "delete"
+	}
+	return nil
+}
+
+// gitPattern escapes the wildcards of a file name for .gitignore and
+// .gitattributes.
+func gitPattern(name string) string {
+	return gitPatternEscaper.Replace(name)
+}
+
+var gitPatternEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, " ", `\ `)
+
+// git runs a git command inside the repository directory and returns its
+// trimmed standard output. git never waits for an editor.
+func (s *GitStore) git(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", s.RepoDir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_EDITOR=true")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitCommitting runs a git command that creates commits, with a fallback
+// identity if the user has not configured one.
+func (s *GitStore) gitCommitting(args ...string) (string, error) {
+	if email, _ := s.git("config", "user.email"); email == "" {
+		args = append([]string{"-c", "user.name=" + gitFallbackName, "-c", "user.email=" + gitFallbackEmail}, args...)
+	}
+	return s.git(args...)
+}
+
+// Init initializes the wrapped store inside an existing git repository,
+// keeps lock and temp files out of it and commits any pending changes to the
+// store files. The repository isn't created implicitly, since the store
+// files may live in a directory such as the home directory.
+func (s *GitStore) Init() error {
+	if _, err := s.git("rev-parse", "--git-dir"); err != nil {
+		return fmt.Errorf("%w: '%s' is not in a git repository; run 'git init' or clone the store's repository there first (%v)",
+			ErrInvalidConfiguration, s.RepoDir, err)
+	}
+	if err := s.Inner.Init(); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name  string
+		lines []string
+	}{{".gitignore", s.Ignore}, {".gitattributes", s.Attributes}} {
+		if len(f.lines) == 0 {
+			continue
+		}
+		if err := appendMissingLines(filepath.Join(s.RepoDir, f.name), f.lines); err != nil {
+			s.Inner.Close()
+			return fmt.Errorf("failed to update %s: %w", f.name, err)
+		}
+		if !slices.Contains(s.Paths, f.name) {
+			s.Paths = append(s.Paths, f.name)
+		}
+	}
+	return s.commit("Initialize secrets store")
+}
+
+// appendMissingLines appends the lines path doesn't contain yet, creating the
+// file if needed.
+func appendMissingLines(path string, lines []string) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	existing := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	var missing []byte
+	for _, line := range lines {
+		if !slices.Contains(existing, line) {
+			missing = append(append(missing, line...), '\n')
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		missing = append([]byte{'\n'}, missing...)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(missing); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close closes the wrapped store.
+func (s *GitStore) Close() error {
+	return s.Inner.Close()
+}
+
+// commit records the current state of the store files, doing nothing when
+// they are unchanged.
+func (s *GitStore) commit(message string) error {
+	if _, err := s.git(append([]string{"add", "--all", "--"}, s.Paths...)...); err != nil {
+		return err
+	}
+	// diff --quiet exits non-zero when there are staged changes
+	if _, err := s.git(append([]string{"diff", "--cached", "--quiet", "--"}, s.Paths...)...); err == nil {
+		return nil
+	}
+
+	args := append([]string{"commit", "--quiet", "-m", message, "--"}, s.Paths...)
+	if _, err := s.gitCommitting(args...); err != nil {
+		return fmt.Errorf("failed to commit store change: %w", err)
+	}
+	return nil
+}
+
+// Create stores a new encrypted value and commits the change.
+func (s *GitStore) Create(key string, encryptedValue []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.Inner.Create(key, encryptedValue); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Create secret '%s'", key))
+}
+
+// CreateWithMetadata stores a new encrypted value with edited metadata and
+// commits both in one commit.
+func (s *GitStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := CreateWithMetadata(s.Inner, key, encryptedValue, edit); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Create secret '%s'", key))
+}
+
+// Read retrieves an encrypted value from the wrapped store.
+func (s *GitStore) Read(key string) ([]byte, error) {
+	return s.Inner.Read(key)
+}
+
+// Update updates an existing encrypted value and commits the change.
+func (s *GitStore) Update(key string, encryptedValue []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.Inner.Update(key, encryptedValue); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Update secret '%s'", key))
+}
+
+// ReadRevision reads a secret and its revision from the wrapped store.
+func (s *GitStore) ReadRevision(key string) ([]byte, int64, error) {
+	rs, err := AsRevisionStore(s.Inner)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rs.ReadRevision(key)
+}
+
+// CompareAndSwap updates a secret of the wrapped store at the expected
+// revision and commits the change.
+func (s *GitStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs, err := AsRevisionStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	if err := rs.CompareAndSwap(key, expectedRevision, encryptedValue); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Update secret '%s'", key))
+}
+
+// UpdateWithMetadata updates a secret of the wrapped store at the expected
+// revision, unless that is 0, with edited metadata and commits both in one
+// commit.
+func (s *GitStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := UpdateWithMetadata(s.Inner, key, expectedRevision, encryptedValue, edit); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Update secret '%s'", key))
+}
+
+// Delete removes a secret and commits the change.
+func (s *GitStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.Inner.Delete(key); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Delete secret '%s'", key))
+}
+
+// ApplyBatch applies ops atomically to the wrapped store and records them in
+// a single commit.
+func (s *GitStore) ApplyBatch(ops []BatchOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bs, err := AsBatchStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	if err := bs.ApplyBatch(ops); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Apply batch of %d changes", len(ops)))
+}
+
+// ListKeys lists all available keys of the wrapped store.
+func (s *GitStore) ListKeys() ([]string, error) {
+	return s.Inner.ListKeys()
+}
+
+// ListKeysWithPrefix lists the keys of the wrapped store starting with
+// prefix.
+func (s *GitStore) ListKeysWithPrefix(prefix string) ([]string, error) {
+	return ListKeysWithPrefix(s.Inner, prefix)
+}
+
+// ReadMetadata returns the metadata of a secret from the wrapped store.
+func (s *GitStore) ReadMetadata(key string) (Metadata, error) {
+	ms, err := AsMetadataStore(s.Inner)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return ms.ReadMetadata(key)
+}
+
+// ListMetadata returns the metadata of every secret of the wrapped store.
+func (s *GitStore) ListMetadata() (map[string]Metadata, error) {
+	return ListMetadata(s.Inner)
+}
+
+// WriteMetadata replaces the metadata of a secret and commits the change.
+func (s *GitStore) WriteMetadata(key string, md Metadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms, err := AsMetadataStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	if err := ms.WriteMetadata(key, md); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Update metadata of secret '%s'", key))
+}
+
+// ListVersions returns the previous versions of a secret from the wrapped
+// store.
+func (s *GitStore) ListVersions(key string) ([]SecretVersion, error) {
+	vs, err := AsVersionedStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	return vs.ListVersions(key)
+}
+
+// ReadVersion returns one version of a secret from the wrapped store.
+func (s *GitStore) ReadVersion(key string, version int64) ([]byte, error) {
+	vs, err := AsVersionedStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	return vs.ReadVersion(key, version)
+}
+
+// setHistoryRetention configures the history retention of the wrapped store.
+func (s *GitStore) setHistoryRetention(n int) {
+	if hr, ok := s.Inner.(historyRetainer); ok {
+		hr.setHistoryRetention(n)
+	}
+}
+
+// setNamespace selects the namespace of the wrapped store.
+func (s *GitStore) setNamespace(ns string) {
+	if nsel, ok := s.Inner.(namespaceSelector); ok {
+		nsel.setNamespace(ns)
+	}
+}
+
+// ListNamespaces returns the namespaces of the wrapped store.
+func (s *GitStore) ListNamespaces() ([]string, error) {
+	ns, err := AsNamespacedStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	return ns.ListNamespaces()
+}
+
+// Trash moves a secret to the trash of the wrapped store and commits the
+// change.
+func (s *GitStore) Trash(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, err := AsTrashStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	if err := ts.Trash(key); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Move secret '%s' to trash", key))
+}
+
+// ListTrash returns the secrets in the trash of the wrapped store.
+func (s *GitStore) ListTrash() ([]TrashedSecret, error) {
+	ts, err := AsTrashStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	return ts.ListTrash()
+}
+
+// Restore moves a secret out of the trash of the wrapped store and commits
+// the change.
+func (s *GitStore) Restore(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, err := AsTrashStore(s.Inner)
+	if err != nil {
+		return err
+	}
+	if err := ts.Restore(key); err != nil {
+		return err
+	}
+	return s.commit(fmt.Sprintf("Restore secret '%s' from trash", key))
+}
+
+// Purge permanently removes old secrets from the trash of the wrapped store
+// and commits the change.
+func (s *GitStore) Purge(before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, err := AsTrashStore(s.Inner)
+	if err != nil {
+		return nil, err
+	}
+	purged, err := ts.Purge(before)
+	if err != nil {
+		return purged, err
+	}
+	return purged, s.commit(fmt.Sprintf("Purge %d secrets from trash", len(purged)))
+}
+
+// Compact compacts the journal of the inner store and commits the result.
+func (s *GitStore) Compact() (JournalStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cs, err := AsCompactableStore(s.Inner)
+	if err != nil {
+		return JournalStats{}, err
+	}
+	stats, err := cs.Compact()
+	if err != nil {
+		return stats, err
+	}
+	return stats, s.commit(fmt.Sprintf("Compact journal from %d to %d records", stats.RecordsBefore, stats.RecordsAfter))
+}
+
+// Upgrade upgrades the format of the inner store and commits the result.
+func (s *GitStore) Upgrade() (FormatUpgrade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	us, err := AsUpgradableStore(s.Inner)
+	if err != nil {
+		return FormatUpgrade{}, err
+	}
+	result, err := us.Upgrade()
+	if err != nil {
+		return result, err
+	}
+	return result, s.commit(fmt.Sprintf("Upgrade store format from version %d to %d", result.From, result.To))
+}
+
+// Sync rebases local commits onto the remote branch and pushes the result.
+// Conflicting changes to files holding a JSON object, such as a JSON store
+// in document format, are merged member by member. When the histories still
+// cannot be combined, or the combined store no longer loads, the repository
+// is left as it was and ErrSyncConflict is returned.
+func (s *GitStore) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.commit("Record uncommitted store changes"); err != nil {
+		return err
+	}
+
+	branch, err := s.git("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return fmt.Errorf("failed to determine current branch: %w", err)
+	}
+	// Fetch the branch explicitly: the remote may be a URL or path without
+	// remote-tracking branches, and a new remote has no branch at all
+	remoteBranch, err := s.git("ls-remote", "--heads", s.Remote, "refs/heads/"+branch)
+	if err != nil {
+		return fmt.Errorf("failed to reach remote '%s': %w", s.Remote, err)
+	}
+	var upstream string
+	if remoteBranch != "" {
+		if _, err := s.git("fetch", "--quiet", s.Remote, "refs/heads/"+branch); err != nil {
+			return fmt.Errorf("failed to fetch from remote '%s': %w", s.Remote, err)
+		}
+		if upstream, err = s.git("rev-parse", "FETCH_HEAD"); err != nil {
+			return err
+		}
+	}
+
+	// Database backends keep their file open; release it while git rewrites it
+	if err := s.Inner.Close(); err != nil {
+		return fmt.Errorf("failed to close store before sync: %w", err)
+	}
+
+	if upstream != "" {
+		before, err := s.git("rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+		if conflicts, err := s.rebase(upstream); err != nil {
+			s.git("rebase", "--abort")
+			if err := s.Inner.Init(); err != nil {
+				return fmt.Errorf("failed to reopen store after sync: %w", err)
+			}
+			if len(conflicts) == 0 {
+				return fmt.Errorf("failed to rebase onto remote '%s': %w", s.Remote, err)
+			}
+			return fmt.Errorf("%w: local and remote changes overlap in %s; resolve manually in '%s'",
+				ErrSyncConflict, strings.Join(conflicts, ", "), s.RepoDir)
+		}
+
+		// A clean textual merge can still produce a store that doesn't load
+		if err := s.verify(); err != nil {
+			s.git("reset", "--quiet", "--keep", before)
+			if err := s.Inner.Init(); err != nil {
+				return fmt.Errorf("failed to reopen store after sync: %w", err)
+			}
+			return fmt.Errorf("%w: merged store is unreadable (%v); local state restored", ErrSyncConflict, err)
+		}
+	} else if err := s.Inner.Init(); err != nil {
+		return fmt.Errorf("failed to reopen store after sync: %w", err)
+	}
+
+	if _, err := s.git("push", "--quiet", s.Remote, "HEAD:refs/heads/"+branch); err != nil {
+		return fmt.Errorf("failed to push to remote '%s': %w", s.Remote, err)
+	}
+	return nil
+}
+
+// rebase replays the local commits onto upstream, resolving the conflicts of
+// each commit with mergeJSONFile. It returns the conflicting files if a
+// conflict couldn't be resolved; the caller aborts the rebase on error.
+func (s *GitStore) rebase(upstream string) ([]string, error) {
+	_, err := s.gitCommitting("rebase", "--quiet", upstream)
+	for err != nil {
+		output, diffErr := s.git("diff", "--name-only", "-z", "--diff-filter=U")
+		if diffErr != nil {
+			return nil, err
+		}
+		conflicts := strings.FieldsFunc(output, func(r rune) bool { return r == 0 })
+		if len(conflicts) == 0 {
+			return nil, err
+		}
+		for _, file := range conflicts {
+			if mergeErr := s.mergeJSONFile(file); mergeErr != nil {
+				return conflicts, mergeErr
+			}
+		}
+		// A commit whose changes the remote already has is dropped
+		if _, diffErr := s.git("diff", "--cached", "--quiet"); diffErr == nil {
+			_, err = s.gitCommitting("rebase", "--skip")
+		} else {
+			_, err = s.gitCommitting("rebase", "--continue")
+		}
+	}
+	return nil, nil
+}
+
+// mergeJSONFile resolves a conflicting file, given relative to the top of
+// the repository, by merging its versions with mergeJSON and staging the
+// result. A file added on both sides is merged as if it was empty before.
+func (s *GitStore) mergeJSONFile(file string) error {
+	stage := func(n int) (json.RawMessage, error) {
+		content, err := s.git("show", fmt.Sprintf(":%d:%s", n, file))
+		return json.RawMessage(content), err
+	}
+	base, err := stage(1)
+	if err != nil {
+		base = nil
+	}
+	ours, err := stage(2)
+	if err != nil {
+		return fmt.Errorf("'%s' was deleted on one side", file)
+	}
+	theirs, err := stage(3)
+	if err != nil {
+		return fmt.Errorf("'%s' was deleted on one side", file)
+	}
+	merged, err := mergeJSON(base, ours, theirs)
+	if err != nil {
+		return fmt.Errorf("'%s': %w", file, err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, merged, "", "  "); err != nil {
+		return err
+	}
+
+	top, err := s.git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(top, filepath.FromSlash(file))
+	if err := os.WriteFile(path, indented.Bytes(), 0600); err != nil {
+		return err
+	}
+	_, err = s.git("add", "--", path)
+	return err
+}
+
+// jsonMember is a member of a JSON object.
+type jsonMember struct {
+	name  string
+	value json.RawMessage
+}
+
+// mergeJSON merges the changes ours and theirs made to base, with nil
+// standing for a missing value. Objects are merged member by member, keeping
+// the order of ours; any other value changed differently on both sides is a
+// conflict.
+func mergeJSON(base, ours, theirs json.RawMessage) (json.RawMessage, error) {
+	switch {
+	case jsonEqual(ours, theirs):
+		return ours, nil
+	case jsonEqual(base, ours):
+		return theirs, nil
+	case jsonEqual(base, theirs):
+		return ours, nil
+	}
+	baseMembers, baseOK := jsonObject(base)
+	ourMembers, oursOK := jsonObject(ours)
+	theirMembers, theirsOK := jsonObject(theirs)
+	if (base != nil && !baseOK) || ours == nil || !oursOK || theirs == nil || !theirsOK {
+		return nil, fmt.Errorf("both sides changed the same value")
+	}
+
+	lookup := func(members []jsonMember, name string) json.RawMessage {
+		for _, m := range members {
+			if m.name == name {
+				return m.value
+			}
+		}
+		return nil
+	}
+	var names []string
+	for _, m := range slices.Concat(ourMembers, theirMembers, baseMembers) {
+		if !slices.Contains(names, m.name) {
+			names = append(names, m.name)
+		}
+	}
+
+	merged := []byte{'{'}
+	for _, name := range names {
+		value, err := mergeJSON(lookup(baseMembers, name), lookup(ourMembers, name), lookup(theirMembers, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if value == nil {
+			continue // Removed
+		}
+		if len(merged) > 1 {
+			merged = append(merged, ',')
+		}
+		encodedName, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(append(append(merged, encodedName...), ':'), value...)
+	}
+	return append(merged, '}'), nil
+}
+
+// jsonObject returns the members of a JSON object in order, and false if raw
+// isn't an object.
+func jsonObject(raw json.RawMessage) ([]jsonMember, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, false
+	}
+	var members []jsonMember
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, false
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, false
+		}
+		members = append(members, jsonMember{name: token.(string), value: value})
+	}
+	// The closing brace must end the input
+	if _, err := decoder.Token(); err != nil {
+		return nil, false
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, false
+	}
+	return members, true
+}
+
+// jsonEqual reports whether two JSON values are equal but for whitespace, nil
+// being equal only to nil.
+func jsonEqual(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, a) != nil || json.Compact(&compactB, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
+
+// verify reopens the wrapped store and checks that its keys can be listed.
+func (s *GitStore) verify() error {
+	if err := s.Inner.Init(); err != nil {
+		return err
+	}
+	if _, err := s.Inner.ListKeys(); err != nil {
+		s.Inner.Close()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// runGit runs git in dir with a fixed identity and returns its trimmed
+// output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@localhost"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// runGitRaw runs git in dir and returns its untrimmed standard output.
+func runGitRaw(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		t.Fatalf("git %v failed: %v", args, err)
+	}
+	return string(output)
+}
+
+// requireGit skips the test if git is not installed.
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+}
+
+// openGitJSONStore opens a JSON store in document format in the repository
+// at dir as configured by --git, syncing with remote.
+func openGitJSONStore(t *testing.T, dir, remote string) *GitStore {
+	t.Helper()
+	return openGitJSONFormat(t, dir, remote, "")
+}
+
+// openGitJSONFormat is openGitJSONStore for a JSON file in format.
+func openGitJSONFormat(t *testing.T, dir, remote, format string) *GitStore {
+	t.Helper()
+	previous := []string{BackendType, JsonFilePath, JsonFormat, GitRemote}
+	t.Cleanup(func() {
+		BackendType, JsonFilePath, JsonFormat, GitRemote = previous[0], previous[1], previous[2], previous[3]
+	})
+	BackendType, JsonFilePath, JsonFormat, GitRemote = "jsonfile", filepath.Join(dir, "secrets.json"), format, remote
+
+	inner, err := NewJSONFileStore(JsonFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format == JSONFormatJournal {
+		inner.Format, inner.JournalKey = format, []byte("journal-test-key")
+	}
+	s, err := newGitStore(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// requireKeys fails unless s holds exactly keys.
+func requireKeys(t *testing.T, s SecretStore, keys ...string) {
+	t.Helper()
+	got, err := s.ListKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, keys) {
+		t.Fatalf("keys = %q, want %q", got, keys)
+	}
+}
+
+// requireClean fails if the repository at dir has uncommitted or untracked
+// files.
+func requireClean(t *testing.T, dir string) {
+	t.Helper()
+	if status := runGit(t, dir, "status", "--porcelain"); status != "" {
+		t.Fatalf("repository not clean after the store's commits:\n%s", status)
+	}
+}
+
+func TestGitStoreRequiresRepository(t *testing.T) {
+	requireGit(t)
+	dir := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+
+	inner, err := NewJSONFileStore(filepath.Join(dir, "secrets.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewGitStore(inner, dir, []string{"secrets.json"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("Init outside a repository = %v, want ErrInvalidConfiguration", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Init created a repository: %v", err)
+	}
+}
+
+func TestGitStoreSync(t *testing.T) {
+	requireGit(t)
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	runGit(t, root, "init", "--quiet", "--bare", remote)
+
+	// The first clone syncs with the empty remote by path
+	dirA := filepath.Join(root, "a")
+	runGit(t, root, "init", "--quiet", dirA)
+	a := openGitJSONStore(t, dirA, remote)
+	if err := a.Create("a1", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Sync(); err != nil {
+		t.Fatalf("Sync to an empty remote failed: %v", err)
+	}
+
+	// The second one through its origin remote
+	dirB := filepath.Join(root, "b")
+	runGit(t, root, "clone", "--quiet", remote, dirB)
+	b := openGitJSONStore(t, dirB, "")
+	requireKeys(t, b, "a1")
+
+	// Entries added next to each other in both documents
+	if err := b.Create("b1", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Create("a2", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Sync(); err != nil {
+		t.Fatalf("Sync of changes to different secrets failed: %v", err)
+	}
+	requireKeys(t, b, "a1", "a2", "b1")
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	requireKeys(t, a, "a1", "a2", "b1")
+	if value, err := a.Read("b1"); err != nil || string(value) != "2" {
+		t.Fatalf("Read(b1) after sync = %q, %v", value, err)
+	}
+	requireClean(t, dirA)
+	requireClean(t, dirB)
+}
+
+func TestGitStoreSyncConflict(t *testing.T) {
+	requireGit(t)
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	runGit(t, root, "init", "--quiet", "--bare", remote)
+	dirA := filepath.Join(root, "a")
+	runGit(t, root, "init", "--quiet", dirA)
+	a := openGitJSONStore(t, dirA, remote)
+	if err := a.Create("shared", []byte("0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	dirB := filepath.Join(root, "b")
+	runGit(t, root, "clone", "--quiet", remote, dirB)
+	b := openGitJSONStore(t, dirB, "")
+
+	if err := a.Update("shared", []byte("from a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Update("shared", []byte("from b")); err != nil {
+		t.Fatal(err)
+	}
+	before := runGit(t, dirB, "rev-parse", "HEAD")
+	if err := b.Sync(); !errors.Is(err, ErrSyncConflict) {
+		t.Fatalf("Sync of two updates of a secret = %v, want ErrSyncConflict", err)
+	}
+	if after := runGit(t, dirB, "rev-parse", "HEAD"); after != before {
+		t.Fatalf("HEAD moved from %s to %s by a conflicting sync", before, after)
+	}
+	if value, err := b.Read("shared"); err != nil || string(value) != "from b" {
+		t.Fatalf("Read after a conflicting sync = %q, %v", value, err)
+	}
+	requireClean(t, dirB)
+}
+
+func TestGitStoreSyncRollback(t *testing.T) {
+	requireGit(t)
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	runGit(t, root, "init", "--quiet", "--bare", remote)
+	dirA := filepath.Join(root, "a")
+	runGit(t, root, "init", "--quiet", dirA)
+	a := openGitJSONStore(t, dirA, remote)
+	if err := a.Create("kept", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	dirB := filepath.Join(root, "b")
+	runGit(t, root, "clone", "--quiet", remote, dirB)
+	b := openGitJSONStore(t, dirB, "")
+
+	// Someone pushes a store that no longer loads
+	if err := os.WriteFile(filepath.Join(dirA, "secrets.json"), []byte("{ not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dirA, "commit", "--quiet", "-am", "Break the store")
+	runGit(t, dirA, "push", "--quiet", remote, "HEAD")
+
+	before := runGit(t, dirB, "rev-parse", "HEAD")
+	if err := b.Sync(); !errors.Is(err, ErrSyncConflict) {
+		t.Fatalf("Sync of an unreadable store = %v, want ErrSyncConflict", err)
+	}
+	if after := runGit(t, dirB, "rev-parse", "HEAD"); after != before {
+		t.Fatalf("HEAD moved from %s to %s by a failed sync", before, after)
+	}
+	requireKeys(t, b, "kept")
+}
+
+func TestMergeJSON(t *testing.T) {
+	base := `{"version": 2, "entries": {"a": {"value": "1"}, "c": {"value": "3"}}}`
+	ours := `{"version": 2, "entries": {"a": {"value": "1"}, "b": {"value": "2"}, "c": {"value": "3"}}}`
+	theirs := `{"version": 2, "entries": {"a": {"value": "1", "description": "d"}, "c": {"value": "3"}, "d": {"value": "4"}}}`
+	merged, err := mergeJSON([]byte(base), []byte(ours), []byte(theirs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"version":2,"entries":{"a":{"value":"1","description":"d"},"b":{"value":"2"},"c":{"value":"3"},"d":{"value":"4"}}}`
+	if !jsonEqual(merged, []byte(want)) {
+		t.Fatalf("mergeJSON = %s, want %s", merged, want)
+	}
+
+	// Removing a secret on one side
+	theirs = `{"version": 2, "entries": {"a": {"value": "1"}}}`
+	if merged, err = mergeJSON([]byte(base), []byte(base), []byte(theirs)); err != nil || !jsonEqual(merged, []byte(theirs)) {
+		t.Fatalf("mergeJSON of a removal = %s, %v", merged, err)
+	}
+
+	// Changing the same value on both sides
+	ours = `{"version": 2, "entries": {"a": {"value": "x"}, "c": {"value": "3"}}}`
+	theirs = `{"version": 2, "entries": {"a": {"value": "y"}, "c": {"value": "3"}}}`
+	if _, err := mergeJSON([]byte(base), []byte(ours), []byte(theirs)); err == nil {
+		t.Fatal("mergeJSON merged two changes of the same value")
+	}
+	// Journals and other files that aren't a single object
+	if _, err := mergeJSON(nil, []byte("{}\n{}"), []byte("{}\n{\"a\":1}")); err == nil {
+		t.Fatal("mergeJSON merged files that aren't a single object")
+	}
+}
+
+func TestGitStoreCommitsMetadataWithValue(t *testing.T) {
+	requireGit(t)
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet")
+	s := openGitJSONStore(t, dir, "")
+	describe := func(md *Metadata) { md.Description = "database" }
+
+	before := runGit(t, dir, "rev-list", "--count", "HEAD")
+	if err := CreateWithMetadata(s, "db", []byte("v1"), describe); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateWithMetadata(s, "db", 1, []byte("v2"), describe); err != nil {
+		t.Fatal(err)
+	}
+	after := runGit(t, dir, "rev-list", "--count", "HEAD")
+	if before != "1" || after != "3" {
+		t.Fatalf("commits went from %s to %s, want one commit per change", before, after)
+	}
+}
+
+func TestGitStoreSQLite(t *testing.T) {
+	requireGit(t)
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet")
+	previous := []string{BackendType, SqliteDBPath, SqliteJournalMode}
+	t.Cleanup(func() {
+		BackendType, SqliteDBPath, SqliteJournalMode = previous[0], previous[1], previous[2]
+	})
+	BackendType, SqliteDBPath, SqliteJournalMode = "sqlite", filepath.Join(dir, "secrets.db"), "wal"
+
+	inner, err := NewSQLiteStore(SqliteDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newGitStore(inner); !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("git tracking in WAL mode = %v, want ErrInvalidConfiguration", err)
+	}
+
+	SqliteJournalMode = ""
+	s, err := newGitStore(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := s.Create("db", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	requireClean(t, dir)
+
+	// The committed database holds the change on its own
+	committed := filepath.Join(t.TempDir(), "committed.db")
+	if err := os.WriteFile(committed, []byte(runGitRaw(t, dir, "show", "HEAD:secrets.db")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewSQLiteStore(committed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if value, err := c.Read("db"); err != nil || string(value) != "v1" {
+		t.Fatalf("Read from the committed database = %q, %v", value, err)
+	}
+}
+
+func TestGitStoreSyncJournal(t *testing.T) {
+	requireGit(t)
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	runGit(t, root, "init", "--quiet", "--bare", remote)
+	dirA := filepath.Join(root, "a")
+	runGit(t, root, "init", "--quiet", dirA)
+	a := openGitJSONFormat(t, dirA, remote, JSONFormatJournal)
+	if err := a.Create("shared", []byte("0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	dirB := filepath.Join(root, "b")
+	runGit(t, root, "clone", "--quiet", remote, dirB)
+	b := openGitJSONFormat(t, dirB, "", JSONFormatJournal)
+
+	// Both append a record at the end of the journal
+	if err := a.Create("a1", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Update("shared", []byte("from b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Sync(); err != nil {
+		t.Fatalf("Sync of records appended on both sides failed: %v", err)
+	}
+	requireKeys(t, b, "a1", "shared")
+	if value, err := b.Read("shared"); err != nil || string(value) != "from b" {
+		t.Fatalf("Read after sync = %q, %v", value, err)
+	}
+	requireClean(t, dirB)
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultHistoryRetention is the number of previous versions kept per secret
+// unless configured otherwise.
+const DefaultHistoryRetention = 5
+
+// ErrVersionNotFound is returned when a requested version of a secret is not
+// (or no longer) kept.
+var ErrVersionNotFound = fmt.Errorf("secret version not found")
+
+// SecretVersion is a previous encrypted value of a secret.
+type SecretVersion struct {
+	Version   int64     `json:"version"`
+	Value     []byte    `json:"value"`
+	CreatedAt time.Time `json:"created_at"` // When this version was written
+}
+
+// VersionedStore is implemented by backends that keep previous values of a
+// secret. Every Update moves the replaced value into the history, which is
+// pruned to the configured retention; Delete removes the history too.
+// The current version number is Metadata.Version.
+type VersionedStore interface {
+	MetadataStore
+
+	// ListVersions returns the retained previous versions of a secret,
+	// newest first. The current value is not included.
+	// Returns an error wrapping ErrSecretNotFound if the key doesn't exist.
+	ListVersions(key string) ([]SecretVersion, error)
+	// ReadVersion returns the encrypted value of the current or a retained
+	// previous version. Returns an error wrapping ErrVersionNotFound if the
+	// version isn't kept.
+	ReadVersion(key string, version int64) ([]byte, error)
+}
+
+// historyRetainer is implemented by backends whose history retention can be
+// configured by GetSecretStore.
+type historyRetainer interface {
+	setHistoryRetention(n int)
+}
+
+// AsVersionedStore returns s as a VersionedStore, or an error wrapping
+// ErrNotSupported if the backend doesn't keep history.
+func AsVersionedStore(s SecretStore) (VersionedStore, error) {
+	vs, ok := s.(VersionedStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s does not keep secret history", ErrNotSupported, describeStore(s))
+	}
+	return vs, nil
+}
+
+// Rollback makes a previous version the current value again. Like any other
+// update, the value being replaced is kept in the history. On backends with
+// revisions the rollback fails with ErrRevisionMismatch instead of replacing
+// a change made while the old version was read.
+func Rollback(s VersionedStore, key string, version int64) error {
+	rs, ok := s.(RevisionStore)
+	if !ok {
+		value, err := s.ReadVersion(key, version)
+		if err != nil {
+			return err
+		}
+		return s.Update(key, value)
+	}
+
+	// The revision is read first, so any later change makes the swap fail
+	_, revision, err := rs.ReadRevision(key)
+	if err != nil {
+		return err
+	}
+	value, err := s.ReadVersion(key, version)
+	if err != nil {
+		return err
+	}
+	return rs.CompareAndSwap(key, revision, value)
+}
+
+// currentVersion returns the version number of a secret's current value.
+// Secrets written before versions were tracked count as version 1.
+func currentVersion(md Metadata) int64 {
+	return max(md.Version, 1)
+}
+
+// archiveVersion returns the history record for the value being replaced.
+func archiveVersion(value []byte, md Metadata) SecretVersion {
+	return SecretVersion{Version: currentVersion(md), Value: value, CreatedAt: md.UpdatedAt}
+}
+
+// prependVersion adds v to a newest-first history and drops the versions
+// beyond the retention.
+func prependVersion(history []SecretVersion, v SecretVersion, retention int) []SecretVersion {
+	history = append([]SecretVersion{v}, history...)
+	return history[:min(len(history), max(retention, 0))]
+}
+
+// versionNotFound returns the error for a version that isn't kept.
+func versionNotFound(key string, version int64) error {
+	return fmt.Errorf("%w: version %d of secret '%s'", ErrVersionNotFound, version, key)
+}
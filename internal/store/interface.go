@@ -30,4 +30,5 @@ var (
 	ErrSecretNotFound       = fmt.Errorf("secret not found")
 	ErrSecretAlreadyExists  = fmt.Errorf("secret already exists")
 	ErrInvalidConfiguration = fmt.Errorf("invalid store configuration")
+	ErrInvalidKey           = fmt.Errorf("invalid secret key")
 )
@@ -0,0 +1,475 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"secrets-cli/internal/crypto"
+)
+
+// Formats of the JSON file, see JSONFileStore.Format.
+const (
+	JSONFormatDocument = "document" // One JSON document, rewritten by every change
+	JSONFormatJournal  = "journal"  // One signed record per change, appended
+)
+
+// DefaultJournalCompactRecords is the number of superseded journal records,
+// those beyond one per secret, after which a change compacts the journal into
+// a snapshot.
+const DefaultJournalCompactRecords = 1000
+
+// journalKeyPurpose is what the key signing journal records is derived from
+// the encryption key for.
+const journalKeyPurpose = "secrets-cli journal mac"
+
+// journalRecordPrefix starts every line of a journal, which tells journals
+// and documents apart.
+var journalRecordPrefix = []byte(`{"changes":`)
+
+// journalRecord is one line of a journal: the entries changed by one
+// operation, signed with an HMAC-SHA256 of the raw changes and header so that
+// torn and tampered records are detected. Each record is signed on its own,
+// so that git can merge journals line by line; deleted, repeated or reordered
+// records are not detected. Snapshots of version 2 files start
+// with a record holding no changes but the header of the document. In sealed
+// journals the changes are encrypted, and the header is not.
+type journalRecord struct {
+	Changes json.RawMessage `json:"changes"` // []journalChange, or a sealed one as a base64 string
+	Header  json.RawMessage `json:"header,omitempty"`
+	MAC     []byte          `json:"mac"`
+}
+
+// journalChange sets or, with a null entry, removes one entry.
+type journalChange struct {
+	Namespace string          `json:"ns"`
+	Trash     bool            `json:"trash,omitempty"`
+	Key       string          `json:"key"`
+	Entry     json.RawMessage `json:"entry"` // jsonEntry, or jsonTrashEntry in the trash
+}
+
+// journalRef identifies an entry of a document.
+type journalRef struct {
+	Namespace string
+	Trash     bool
+	Key       string
+}
+
+// journalState is what a JSONFileStore in journal format remembers from
+// loading the file, for appending the next change. It is guarded by the
+// store's mutex.
+type journalState struct {
+	base    map[journalRef]string // Serialized entries as loaded
+	end     int64                 // Size of the valid records; anything after is a torn tail
+	records int                   // Number of valid records, not counting the header
+	convert bool                  // The file isn't a journal, or isn't sealed throughout, yet
+	sealed  bool                  // Some records are sealed
+}
+
+// JournalStats describes a journal before and after compaction.
+type JournalStats struct {
+	RecordsBefore int `json:"records_before"`
+	RecordsAfter  int `json:"records_after"`
+}
+
+// CompactableStore is implemented by backends whose storage can be compacted.
+type CompactableStore interface {
+	SecretStore
+
+	// Compact rewrites the storage with only the current state.
+	Compact() (JournalStats, error)
+}
+
+// AsCompactableStore returns s as a CompactableStore, or an error wrapping
+// ErrNotSupported if there is nothing to compact.
+func AsCompactableStore(s SecretStore) (CompactableStore, error) {
+	cs, ok := s.(CompactableStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no journal to compact", ErrNotSupported, describeStore(s))
+	}
+	return cs, nil
+}
+
+// isJournal reports whether content is a journal rather than a document.
+func isJournal(content []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(content), journalRecordPrefix)
+}
+
+// journalMAC signs the raw changes and header of a record.
+func (s *JSONFileStore) journalMAC(changes, header []byte) []byte {
+	mac := hmac.New(sha256.New, s.JournalKey)
+	mac.Write(changes)
+	mac.Write(header)
+	return mac.Sum(nil)
+}
+
+// checkJournalKey fails if journal records can't be signed.
+func (s *JSONFileStore) checkJournalKey() error {
+	if len(s.JournalKey) == 0 {
+		return fmt.Errorf("%w: the journal format needs the encryption key", ErrInvalidConfiguration)
+	}
+	return nil
+}
+
+// parseJournal replays the records of a journal into a document. A last
+// record without its newline is a write torn by a crash and is ignored; the
+// next change truncates it. Any complete record that fails verification means
+// the journal was damaged or changed by hand, which is an error.
+func (s *JSONFileStore) parseJournal(content []byte) (*jsonDocument, journalState, error) {
+	doc := newJSONDocument()
+	state := journalState{}
+	if err := s.checkJournalKey(); err != nil {
+		return nil, state, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	var offset int64
+	plain := false // Some records aren't sealed
+	for line := 1; scanner.Scan(); line++ {
+		raw := scanner.Bytes()
+		next := offset + int64(len(raw)) + 1
+		complete := next <= int64(len(content)) // The line ends with a newline
+
+		record, changes, err := s.verifyJournalRecord(raw)
+		if err == nil && !complete {
+			err = fmt.Errorf("record is incomplete")
+		}
+		if err == nil && len(record.Header) > 0 {
+			err = json.Unmarshal(record.Header, &doc.jsonHeader)
+		}
+		if err == nil {
+			if isSealedJournalRecord(record) {
+				state.sealed = true
+			} else {
+				plain = true
+			}
+		}
+		if err == nil {
+			err = doc.applyJournal(changes)
+		}
+		if err != nil {
+			if !complete {
+				break // Torn tail
+			}
+			return nil, state, fmt.Errorf("journal record %d is invalid: %w", line, err)
+		}
+		offset = next
+		state.end = offset
+		if len(record.Header) == 0 {
+			state.records++
+		}
+	}
+	// Seal the records written before sealing was turned on
+	state.convert = plain && (s.Seal || state.sealed)
+	return doc, state, nil
+}
+
+// verifyJournalRecord parses and verifies one line of a journal.
+func (s *JSONFileStore) verifyJournalRecord(line []byte) (journalRecord, []journalChange, error) {
+	var record journalRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return record, nil, err
+	}
+	if !hmac.Equal(record.MAC, s.journalMAC(record.Changes, record.Header)) {
+		return record, nil, fmt.Errorf("signature mismatch")
+	}
+	raw := []byte(record.Changes)
+	if isSealedJournalRecord(record) {
+		var sealed []byte
+		if err := json.Unmarshal(raw, &sealed); err != nil {
+			return record, nil, err
+		}
+		if err := checkFileKey(s.FileKey); err != nil {
+			return record, nil, err
+		}
+		var err error
+		if raw, err = crypto.Decrypt(sealed, s.FileKey); err != nil {
+			return record, nil, err
+		}
+	}
+	var changes []journalChange
+	if err := json.Unmarshal(raw, &changes); err != nil {
+		return record, nil, err
+	}
+	return record, changes, nil
+}
+
+// isSealedJournalRecord reports whether the changes of record are encrypted.
+func isSealedJournalRecord(record journalRecord) bool {
+	return bytes.HasPrefix(record.Changes, []byte(`"`))
+}
+
+// applyJournal applies the changes of one record to the document.
+func (doc *jsonDocument) applyJournal(changes []journalChange) error {
+	for _, c := range changes {
+		sp := doc.space(c.Namespace)
+		removed := len(c.Entry) == 0 || bytes.Equal(c.Entry, []byte("null"))
+		switch {
+		case c.Trash && removed:
+			delete(sp.Trash, c.Key)
+		case c.Trash:
+			var entry jsonTrashEntry
+			if err := json.Unmarshal(c.Entry, &entry); err != nil {
+				return err
+			}
+			if sp.Trash == nil {
+				sp.Trash = make(map[string]*jsonTrashEntry)
+			}
+			sp.Trash[c.Key] = &entry
+		case removed:
+			delete(sp.Entries, c.Key)
+		default:
+			var entry jsonEntry
+			if err := json.Unmarshal(c.Entry, &entry); err != nil {
+				return err
+			}
+			sp.Entries[c.Key] = &entry
+		}
+	}
+	return nil
+}
+
+// journalEntries serializes every entry of the document.
+func journalEntries(doc *jsonDocument) (map[journalRef]string, error) {
+	entries := make(map[journalRef]string)
+	add := func(ns string, sp *jsonNamespace) error {
+		for key, entry := range sp.Entries {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			entries[journalRef{Namespace: ns, Key: key}] = string(data)
+		}
+		for key, entry := range sp.Trash {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			entries[journalRef{Namespace: ns, Trash: true, Key: key}] = string(data)
+		}
+		return nil
+	}
+	if err := add(DefaultNamespace, &doc.jsonNamespace); err != nil {
+		return nil, err
+	}
+	for ns, sp := range doc.Namespaces {
+		if sp != nil {
+			if err := add(ns, sp); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// compareJournalRefs orders entries for snapshots and records.
+func compareJournalRefs(a, b journalRef) int {
+	if c := cmp.Compare(a.Namespace, b.Namespace); c != 0 {
+		return c
+	}
+	if a.Trash != b.Trash {
+		if a.Trash {
+			return 1
+		}
+		return -1
+	}
+	return cmp.Compare(a.Key, b.Key)
+}
+
+// marshalJournalRecord returns the signed line of a record with changes and,
+// if it isn't nil, header.
+func (s *JSONFileStore) marshalJournalRecord(changes []journalChange, header *jsonHeader) ([]byte, error) {
+	if changes == nil {
+		changes = []journalChange{} // Encode as [] rather than null
+	}
+	raw, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	if s.sealing() {
+		if err := checkFileKey(s.FileKey); err != nil {
+			return nil, err
+		}
+		sealed, err := crypto.Encrypt(raw, s.FileKey)
+		if err != nil {
+			return nil, err
+		}
+		if raw, err = json.Marshal(sealed); err != nil {
+			return nil, err
+		}
+	}
+	var rawHeader []byte
+	if header != nil {
+		if rawHeader, err = json.Marshal(header); err != nil {
+			return nil, err
+		}
+	}
+	line, err := json.Marshal(journalRecord{Changes: raw, Header: rawHeader, MAC: s.journalMAC(raw, rawHeader)})
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// saveJournal appends the changes between the loaded and the given document
+// as one record, compacting the journal instead when it has grown long or
+// isn't a journal yet. The caller must hold s.mu.
+func (s *JSONFileStore) saveJournal(doc *jsonDocument) error {
+	if err := s.checkJournalKey(); err != nil {
+		return err
+	}
+	current, err := journalEntries(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entries: %w", err)
+	}
+	if s.journal.convert || s.journal.base == nil || s.journal.records-len(s.journal.base) >= s.compactRecords() {
+		return s.writeJournalSnapshot(doc.jsonHeader, current)
+	}
+
+	var changed []journalRef
+	for ref, data := range current {
+		if s.journal.base[ref] != data {
+			changed = append(changed, ref)
+		}
+	}
+	for ref := range s.journal.base {
+		if _, exists := current[ref]; !exists {
+			changed = append(changed, ref)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	slices.SortFunc(changed, compareJournalRefs)
+	changes := make([]journalChange, len(changed))
+	for i, ref := range changed {
+		changes[i] = journalChange{Namespace: ref.Namespace, Trash: ref.Trash, Key: ref.Key}
+		if data, exists := current[ref]; exists {
+			changes[i].Entry = json.RawMessage(data)
+		}
+	}
+	line, err := s.marshalJournalRecord(changes, nil)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal record: %w", err)
+	}
+
+	file, err := os.OpenFile(s.FilePath, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+	// Drop a torn tail left by a crash before appending
+	if err := file.Truncate(s.journal.end); err != nil {
+		return fmt.Errorf("failed to truncate journal: %w", err)
+	}
+	if _, err := file.WriteAt(line, s.journal.end); err != nil {
+		return fmt.Errorf("failed to append to journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+
+	s.journal.base = current
+	s.journal.end += int64(len(line))
+	s.journal.records++
+	return nil
+}
+
+// compactRecords returns the configured compaction threshold.
+func (s *JSONFileStore) compactRecords() int {
+	if s.CompactRecords > 0 {
+		return s.CompactRecords
+	}
+	return DefaultJournalCompactRecords
+}
+
+// writeJournalSnapshot replaces the file with a journal holding the header,
+// unless it is empty, and one record per entry. The caller must hold s.mu.
+func (s *JSONFileStore) writeJournalSnapshot(header jsonHeader, entries map[journalRef]string) error {
+	refs := make([]journalRef, 0, len(entries))
+	for ref := range entries {
+		refs = append(refs, ref)
+	}
+	slices.SortFunc(refs, compareJournalRefs)
+
+	var content bytes.Buffer
+	if header != (jsonHeader{}) {
+		line, err := s.marshalJournalRecord(nil, &header)
+		if err != nil {
+			return fmt.Errorf("failed to marshal journal header: %w", err)
+		}
+		content.Write(line)
+	}
+	for _, ref := range refs {
+		line, err := s.marshalJournalRecord([]journalChange{{
+			Namespace: ref.Namespace, Trash: ref.Trash, Key: ref.Key, Entry: json.RawMessage(entries[ref]),
+		}}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to marshal journal record: %w", err)
+		}
+		content.Write(line)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.FilePath), "secrets-json-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for journal snapshot: %w", err)
+	}
+	tmpFilePath := tmpFile.Name()
+	if _, err := tmpFile.Write(content.Bytes()); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to write journal snapshot: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to sync journal snapshot: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to close journal snapshot: %w", err)
+	}
+	if err := os.Rename(tmpFilePath, s.FilePath); err != nil {
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to rename journal snapshot: %w", err)
+	}
+
+	s.journal = journalState{base: entries, end: int64(content.Len()), records: len(refs)}
+	return nil
+}
+
+// Compact rewrites the journal with one record per secret, dropping the
+// records of replaced and deleted values.
+func (s *JSONFileStore) Compact() (JournalStats, error) {
+	if s.Format != JSONFormatJournal {
+		return JournalStats{}, fmt.Errorf("%w: the JSON file is not in journal format", ErrNotSupported)
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return JournalStats{}, err
+	}
+	defer unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return JournalStats{}, err
+	}
+	stats := JournalStats{RecordsBefore: s.journal.records}
+	entries, err := journalEntries(doc)
+	if err != nil {
+		return stats, fmt.Errorf("failed to marshal journal entries: %w", err)
+	}
+	if err := s.writeJournalSnapshot(doc.jsonHeader, entries); err != nil {
+		return stats, err
+	}
+	stats.RecordsAfter = s.journal.records
+	return stats, nil
+}
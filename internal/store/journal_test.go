@@ -0,0 +1,292 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+)
+
+// newTestJournal returns an initialized journal store on path.
+func newTestJournal(t *testing.T, path string) *JSONFileStore {
+	t.Helper()
+	s, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Format = JSONFormatJournal
+	s.JournalKey = []byte("journal-test-key")
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// journalLines returns the records of the journal at path.
+func journalLines(t *testing.T, path string) [][]byte {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	return lines[:len(lines)-1] // Drop the empty rest after the last newline
+}
+
+func TestJournalAppendsOneRecordPerChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s := newTestJournal(t, path)
+
+	if err := s.Create("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	before := journalLines(t, path)
+	if err := s.Update("a", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	after := journalLines(t, path)
+	if len(after) != len(before)+1 || !bytes.Equal(bytes.Join(after[:len(before)], nil), bytes.Join(before, nil)) {
+		t.Fatalf("update didn't append a single record:\n%s", bytes.Join(after, nil))
+	}
+
+	// A reread from another instance replays the journal
+	value, err := newTestJournal(t, path).Read("a")
+	if err != nil || string(value) != "3" {
+		t.Fatalf("Read after replay = %q, %v", value, err)
+	}
+}
+
+func TestJournalTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s := newTestJournal(t, path)
+	if err := s.Create("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash halfway through writing the last record
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content[:len(content)-10], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestJournal(t, path)
+	if _, err := s.Read("b"); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("Read of torn record = %v, want ErrSecretNotFound", err)
+	}
+	if value, err := s.Read("a"); err != nil || string(value) != "1" {
+		t.Fatalf("Read before torn record = %q, %v", value, err)
+	}
+
+	// The next change replaces the torn tail
+	if err := s.Create("c", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if lines := journalLines(t, path); len(lines) != 3 {
+		t.Fatalf("journal has %d lines after recovery, want the header and 2 records", len(lines))
+	}
+	keys, err := newTestJournal(t, path).ListKeys()
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("ListKeys after recovery = %v, %v", keys, err)
+	}
+}
+
+func TestJournalTamperedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s := newTestJournal(t, path)
+	for _, key := range []string{"a", "b"} {
+		if err := s.Create(key, []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := journalLines(t, path) // The header, a and b
+	lines[1] = bytes.Replace(lines[1], []byte(`"key":"a"`), []byte(`"key":"x"`), 1)
+	if err := os.WriteFile(path, bytes.Join(lines, nil), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("b"); err == nil {
+		t.Fatal("Read of a journal with a tampered record succeeded")
+	}
+
+	// A journal signed with another key doesn't verify either
+	lines[1] = bytes.Replace(lines[1], []byte(`"key":"x"`), []byte(`"key":"a"`), 1)
+	if err := os.WriteFile(path, bytes.Join(lines, nil), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s.JournalKey = []byte("another-key")
+	if _, err := s.Read("b"); err == nil {
+		t.Fatal("Read of a journal signed with another key succeeded")
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s := newTestJournal(t, path)
+	for range 5 {
+		if err := s.Create("a", []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete("a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Create("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RecordsBefore != 11 || stats.RecordsAfter != 1 {
+		t.Fatalf("Compact = %+v, want 11 records before and 1 after", stats)
+	}
+	if value, err := newTestJournal(t, path).Read("b"); err != nil || string(value) != "2" {
+		t.Fatalf("Read after compaction = %q, %v", value, err)
+	}
+
+	// Compaction also happens on its own once enough records are superseded,
+	// however many secrets there are
+	s.CompactRecords = 3
+	for _, key := range []string{"c", "d", "e"} {
+		if err := s.Create(key, []byte("3")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 4 { // The fourth finds 3 superseded records
+		if err := s.Update("b", []byte("4")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lines := journalLines(t, path); len(lines) != 5 {
+		t.Fatalf("journal has %d lines, want the header and 4 records after automatic compaction", len(lines))
+	}
+}
+
+func TestJournalConvertsDocument(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	doc, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Create("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next change converts the document into a journal
+	s := newTestJournal(t, path)
+	if err := s.Create("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isJournal(content) || len(journalLines(t, path)) != 3 {
+		t.Fatalf("file after change is not a journal with the header and 2 records:\n%s", content)
+	}
+
+	// And back: the document format reads journals and rewrites them
+	doc.JournalKey = s.JournalKey
+	if err := doc.Create("c", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := doc.ListKeys()
+	if err != nil || len(keys) != 3 {
+		t.Fatalf("ListKeys after converting back = %v, %v", keys, err)
+	}
+	if content, _ := os.ReadFile(path); isJournal(content) {
+		t.Fatalf("file is still a journal:\n%s", content)
+	}
+}
+
+func TestJournalUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s := newTestJournal(t, path)
+	if err := s.Create("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the header, as in journals written before format versions
+	lines := journalLines(t, path)
+	if err := os.WriteFile(path, bytes.Join(lines[1:], nil), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestJournal(t, path)
+	if err := s.Create("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if lines := journalLines(t, path); len(lines) != 2 {
+		t.Fatalf("change of version 1 journal wrote %d lines, want 2 records", len(lines))
+	}
+
+	upgrade, err := s.Upgrade()
+	if err != nil || upgrade.From != 1 || upgrade.To != JSONFileVersion {
+		t.Fatalf("Upgrade = %+v, %v", upgrade, err)
+	}
+	s = newTestJournal(t, path)
+	keys, err := s.ListKeys()
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("ListKeys after upgrade = %v, %v", keys, err)
+	}
+	if again, err := s.Upgrade(); err != nil || again.From != JSONFileVersion || again.StoreID != upgrade.StoreID {
+		t.Fatalf("Upgrade after replay = %+v, %v", again, err)
+	}
+}
+
+func TestJournalInvalidLastRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s := newTestJournal(t, path)
+	for _, key := range []string{"a", "b"} {
+		if err := s.Create(key, []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A complete last record is no torn write, so a bad one is an error
+	lines := journalLines(t, path)
+	lines[2] = bytes.Replace(lines[2], []byte(`"key":"b"`), []byte(`"key":"x"`), 1)
+	if err := os.WriteFile(path, bytes.Join(lines, nil), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("a"); err == nil {
+		t.Fatal("Read of a journal with a tampered last record succeeded")
+	}
+}
+
+func TestJournalKeyDerivedFromEncryptionKey(t *testing.T) {
+	previous := JsonFormat
+	t.Cleanup(func() { JsonFormat = previous })
+	JsonFormat = JSONFormatJournal
+	master := bytes.Repeat([]byte{5}, 32)
+	t.Setenv(key.EnvKeyName, base64.StdEncoding.EncodeToString(master))
+
+	s, err := newStore("jsonfile", filepath.Join(t.TempDir(), "secrets.json"), DefaultNamespace, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := crypto.DeriveKey(master, journalKeyPurpose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.(*JSONFileStore).JournalKey; !bytes.Equal(got, want) || bytes.Equal(got, master) {
+		t.Fatalf("journal key = %x, want %x derived from the encryption key", got, want)
+	}
+}
@@ -1,23 +1,39 @@
 package store
 
 import (
+	"bytes"
+	"crypto/rand"
 	"encoding/base64" // <--- Add this line
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync" // For potential future concurrency needs
+	"time"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
 )
 
 // JSONFileStore implements the SecretStore interface using a simple JSON file.
 type JSONFileStore struct {
-	FilePath string
-	mu       sync.Mutex // Protects file access
-	// Store secrets as map[plaintext_key] -> encrypted_value_base64
+	FilePath         string
+	Namespace        string        // Namespace the store operates on
+	LockTimeout      time.Duration // How long writers wait for another process's lock
+	HistoryRetention int           // Number of previous versions kept per secret
+	Format           string        // JSONFormatDocument (the default) or JSONFormatJournal
+	JournalKey       []byte        // Signs journal records
+	Seal             bool          // Encrypt the whole file, or every journal record, with FileKey
+	FileKey          []byte        // Reads and writes sealed files, derived from the encryption key
+	CompactRecords   int           // Superseded journal records before compaction; DefaultJournalCompactRecords if 0
+	mu               sync.Mutex    // Serializes read-modify-write cycles on the file
+	journal          journalState  // Guarded by mu
+	sealed           bool          // The file was sealed when last loaded; guarded by mu
+	// Store secrets as {"entries": {plaintext_key: {"value": encrypted_value_base64, ...metadata}}},
+	// other namespaces as {"namespaces": {name: {"entries": {...}}}}
 	// Storing as base64 in JSON makes it more readable,
 	// but requires base64 encoding/decoding during save/load.
-	// Alternatively, could store raw bytes if JSON supports it well (less standard).
-	// Let's stick to base64 for JSON compatibility.
 }
 
 // NewJSONFileStore creates a new JSONFileStore instance.
@@ -25,18 +41,67 @@ func NewJSONFileStore(filePath string) (*JSONFileStore, error) {
 	if filePath == "" {
 		return nil, fmt.Errorf("%w: JSON file path cannot be empty", ErrInvalidConfiguration)
 	}
-	return &JSONFileStore{FilePath: filePath}, nil
+	return &JSONFileStore{
+		FilePath:         filePath,
+		Namespace:        DefaultNamespace,
+		LockTimeout:      DefaultLockTimeout,
+		HistoryRetention: DefaultHistoryRetention,
+	}, nil
+}
+
+// setHistoryRetention sets the number of previous versions kept per secret.
+func (s *JSONFileStore) setHistoryRetention(n int) {
+	s.HistoryRetention = n
+}
+
+// setNamespace selects the namespace the store operates on.
+func (s *JSONFileStore) setNamespace(ns string) {
+	s.Namespace = ns
+}
+
+// lock serializes a read-modify-write cycle against other goroutines and,
+// through an advisory lock on <file>.lock, against other processes.
+// The returned function releases both locks.
+func (s *JSONFileStore) lock() (func(), error) {
+	s.mu.Lock()
+	fl, err := acquireFileLock(s.FilePath+".lock", s.LockTimeout)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		fl.Unlock() // Closing the file releases the lock even if this fails
+		s.mu.Unlock()
+	}, nil
 }
 
 // Init ensures the file exists (creates empty JSON object if not).
 func (s *JSONFileStore) Init() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
+	if s.Format == JSONFormatJournal {
+		if err := s.checkJournalKey(); err != nil {
+			return err
+		}
+	}
+	if s.Seal {
+		if err := checkFileKey(s.FileKey); err != nil {
+			return err
+		}
+	}
 	if _, err := os.Stat(s.FilePath); os.IsNotExist(err) {
-		// File doesn't exist, create it with an empty JSON object
-		err := os.WriteFile(s.FilePath, []byte("{}"), 0600) // Owner read/write
-		if err != nil {
+		// File doesn't exist, create it with an empty document
+		doc := newJSONDocument()
+		if doc.jsonHeader, err = newJSONHeader(); err != nil {
+			return err
+		}
+		// A new journal starts with a snapshot holding the header
+		s.journal.convert = true
+		if err := s.saveData(doc); err != nil {
 			return fmt.Errorf("failed to create JSON file: %w", err)
 		}
 	} else if err != nil {
@@ -50,63 +115,225 @@ func (s *JSONFileStore) Close() error {
 	return nil // No resources to close
 }
 
-// loadData reads and unmarshals the JSON file.
-func (s *JSONFileStore) loadData() (map[string][]byte, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// jsonEntry is a secret as stored in the JSON file. encoding/json stores
+// the encrypted value as a base64 string.
+type jsonEntry struct {
+	Value []byte `json:"value"`
+	Metadata
+	History []SecretVersion `json:"history,omitempty"` // Newest first
+}
+
+// jsonTrashEntry is a secret in the trash of the JSON file.
+type jsonTrashEntry struct {
+	jsonEntry
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// jsonNamespace holds the secrets of one namespace.
+type jsonNamespace struct {
+	Entries map[string]*jsonEntry      `json:"entries"`
+	Trash   map[string]*jsonTrashEntry `json:"trash,omitempty"`
+}
+
+// JSONFileVersion is the newest format version of the JSON file, the one
+// new files are created with and 'upgrade' converts files to. Version 1
+// files have no header; the flat legacy format is read as version 1.
+const JSONFileVersion = 2
+
+// ErrUnsupportedFormat is returned when writing a JSON file in a format this
+// version of secrets-cli doesn't know, which could lose what it doesn't
+// understand.
+var ErrUnsupportedFormat = fmt.Errorf("unsupported store file format")
+
+// jsonHeader describes the format of the JSON file and how its values are
+// encrypted. It is empty in version 1 files.
+type jsonHeader struct {
+	Version int    `json:"version,omitempty"`
+	StoreID string `json:"store_id,omitempty"` // Random ID telling stores apart
+	Cipher  string `json:"cipher,omitempty"`   // See crypto.Cipher
+	KDF     string `json:"kdf,omitempty"`      // See key.KDF
+}
+
+// newJSONHeader returns the header of a new file with a new store ID.
+func newJSONHeader() (jsonHeader, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return jsonHeader{}, fmt.Errorf("failed to generate store ID: %w", err)
+	}
+	return jsonHeader{Version: JSONFileVersion, StoreID: hex.EncodeToString(id), Cipher: crypto.Cipher, KDF: key.KDF}, nil
+}
+
+// version returns the format version described by the header.
+func (h jsonHeader) version() int {
+	return max(h.Version, 1)
+}
+
+// checkWritable fails if writing the file could lose information because it
+// is in a newer format or encrypted in another way than this binary knows.
+func (h jsonHeader) checkWritable() error {
+	if h.version() > JSONFileVersion {
+		return fmt.Errorf("%w: file has format version %d, this secrets-cli writes up to version %d; upgrade secrets-cli",
+			ErrUnsupportedFormat, h.version(), JSONFileVersion)
+	}
+	if h.Cipher != "" && h.Cipher != crypto.Cipher {
+		return fmt.Errorf("%w: file is encrypted with cipher '%s'", ErrUnsupportedFormat, h.Cipher)
+	}
+	if h.KDF != "" && h.KDF != key.KDF {
+		return fmt.Errorf("%w: file uses key derivation '%s'", ErrUnsupportedFormat, h.KDF)
+	}
+	return nil
+}
+
+// jsonDocument is the content of the JSON file. The default namespace is
+// kept at the top level, where files written before namespaces existed have
+// their entries.
+type jsonDocument struct {
+	jsonHeader
+	jsonNamespace
+	Namespaces map[string]*jsonNamespace `json:"namespaces,omitempty"`
+}
 
-	data := make(map[string][]byte)
+// newJSONDocument returns an empty document without a header.
+func newJSONDocument() *jsonDocument {
+	return &jsonDocument{jsonNamespace: jsonNamespace{Entries: make(map[string]*jsonEntry)}}
+}
+
+// space returns the secrets of namespace ns, adding an empty namespace to
+// the document if it doesn't exist yet.
+func (doc *jsonDocument) space(ns string) *jsonNamespace {
+	if ns == DefaultNamespace {
+		return &doc.jsonNamespace
+	}
+	if doc.Namespaces == nil {
+		doc.Namespaces = make(map[string]*jsonNamespace)
+	}
+	sp, exists := doc.Namespaces[ns]
+	if !exists || sp == nil {
+		sp = &jsonNamespace{}
+		doc.Namespaces[ns] = sp
+	}
+	if sp.Entries == nil {
+		sp.Entries = make(map[string]*jsonEntry)
+	}
+	return sp
+}
+
+// loadData reads and unmarshals the JSON file. The caller must hold s.mu.
+// Files written before metadata was introduced are a flat object of
+// key -> base64 value; they are read as entries without metadata and
+// rewritten as version 1 by the next change. Changes keep the format version
+// of the file, so that older binaries can still read it until 'upgrade'.
+func (s *JSONFileStore) loadData() (*jsonDocument, error) {
+	doc := newJSONDocument()
+	// An empty journal, until the file says otherwise
+	s.journal = journalState{base: make(map[journalRef]string)}
 
 	// Read file content
 	content, err := os.ReadFile(s.FilePath)
-	if (err != nil) {
+	if err != nil {
 		// If file doesn't exist, treat as empty store
 		if os.IsNotExist(err) {
-			return data, nil
+			return doc, nil
 		}
 		return nil, fmt.Errorf("failed to read JSON file: %w", err)
 	}
 
+	// Sealed files are read, and stay sealed, whatever Seal says
+	s.sealed = isSealed(content)
+	if s.sealed {
+		if content, err = unsealFile(sealedJSON, content, s.FileKey); err != nil {
+			return nil, err
+		}
+	}
+
 	// If file is empty or contains only whitespace, treat as empty JSON object
-	if len(content) == 0 || len([]byte(string(content))) == 0 {
-		return data, nil
+	if len(bytes.TrimSpace(content)) == 0 {
+		s.journal.end = int64(len(content))
+		return doc, nil
 	}
 
-	// Unmarshal JSON (reading base64 strings)
+	// Journals are read whatever the format, so that changing the format
+	// converts the file on the next change
+	if isJournal(content) {
+		doc, state, err := s.parseJournal(content)
+		if err != nil {
+			return nil, err
+		}
+		s.journal = state
+		s.sealed = state.sealed
+		if s.journal.base, err = journalEntries(doc); err != nil {
+			return nil, fmt.Errorf("failed to marshal journal entries: %w", err)
+		}
+		return doc, nil
+	}
+	s.journal = journalState{convert: true}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %w", err)
+	}
+
+	// Legacy values are always strings, so an "entries" object is unambiguous
+	if entries, ok := raw["entries"]; ok && bytes.HasPrefix(bytes.TrimSpace(entries), []byte("{")) {
+		if err := json.Unmarshal(content, doc); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON data: %w", err)
+		}
+		if doc.Entries == nil {
+			doc.Entries = make(map[string]*jsonEntry)
+		}
+		return doc, nil
+	}
+
+	// Unmarshal legacy JSON (reading base64 strings)
 	var base64Data map[string]string
 	if err := json.Unmarshal(content, &base64Data); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal JSON data: %w", err)
 	}
 
-
 	// Decode base64 values
 	for k, v := range base64Data {
 		decodedValue, err := base64.StdEncoding.DecodeString(v)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode base64 value for key '%s': %w", k, err)
 		}
-		data[k] = decodedValue
+		doc.Entries[k] = &jsonEntry{Value: decodedValue}
 	}
 
-	return data, nil
+	return doc, nil
 }
 
-// saveData marshals and writes data to the JSON file.
-func (s *JSONFileStore) saveData(data map[string][]byte) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// sealing reports whether changes are written sealed: once a file is sealed
+// it stays sealed. The caller must hold s.mu.
+func (s *JSONFileStore) sealing() bool {
+	return s.Seal || s.sealed
+}
 
-	// Encode values to base64 for JSON
-	base64Data := make(map[string]string)
-	for k, v := range data {
-		base64Data[k] = base64.StdEncoding.EncodeToString(v)
+// saveData marshals and writes data to the JSON file. The caller must hold s.mu.
+func (s *JSONFileStore) saveData(doc *jsonDocument) error {
+	if err := doc.checkWritable(); err != nil {
+		return err
+	}
+	if s.Format == JSONFormatJournal {
+		return s.saveJournal(doc)
+	}
+
+	// Drop namespaces left empty
+	for ns, sp := range doc.Namespaces {
+		if sp == nil || (len(sp.Entries) == 0 && len(sp.Trash) == 0) {
+			delete(doc.Namespaces, ns)
+		}
 	}
 
 	// Marshal data to JSON
-	content, err := json.MarshalIndent(base64Data, "", "  ")
+	content, err := json.MarshalIndent(doc, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON data: %w", err)
 	}
+	if s.sealing() {
+		if content, err = sealFile(sealedJSON, content, s.FileKey); err != nil {
+			return err
+		}
+	}
 
 	// Write to a temporary file in the same directory as the target file and rename for atomic update
 	tmpFile, err := os.CreateTemp(filepath.Dir(s.FilePath), "secrets-json-")
@@ -142,74 +369,438 @@ func (s *JSONFileStore) saveData(data map[string][]byte) error {
 
 // Create stores a new encrypted value.
 func (s *JSONFileStore) Create(key string, encryptedValue []byte) error {
-	data, err := s.loadData()
+	return s.CreateWithMetadata(key, encryptedValue, nil)
+}
+
+// CreateWithMetadata stores a new encrypted value and applies edit to its
+// metadata, in one write of the file.
+func (s *JSONFileStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	unlock, err := s.lock()
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	if _, exists := data[key]; exists {
-		return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+	doc, err := s.loadData()
+	if err != nil {
+		return err
 	}
+	if err := doc.space(s.Namespace).create(key, encryptedValue, edit); err != nil {
+		return err
+	}
+	return s.saveData(doc)
+}
 
-	data[key] = encryptedValue
-	return s.saveData(data)
+// create adds a new secret to the namespace, applying edit to its metadata.
+func (sp *jsonNamespace) create(key string, encryptedValue []byte, edit MetadataEdit) error {
+	if _, exists := sp.Entries[key]; exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+	}
+	entry := &jsonEntry{Value: encryptedValue, Metadata: newMetadata()}
+	edit.apply(&entry.Metadata)
+	sp.Entries[key] = entry
+	return nil
 }
 
 // Read retrieves an encrypted value.
 func (s *JSONFileStore) Read(key string) ([]byte, error) {
-	data, err := s.loadData()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.loadData()
 	if err != nil {
 		return nil, err
 	}
+	sp := doc.space(s.Namespace)
 
-	value, exists := data[key]
+	entry, exists := sp.Entries[key]
 	if !exists {
 		return nil, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
 	}
 
-	return value, nil
+	return entry.Value, nil
+}
+
+// ReadRevision retrieves an encrypted value and its revision.
+func (s *JSONFileStore) ReadRevision(key string) ([]byte, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return nil, 0, err
+	}
+	sp := doc.space(s.Namespace)
+
+	entry, exists := sp.Entries[key]
+	if !exists {
+		return nil, 0, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+
+	return entry.Value, currentVersion(entry.Metadata), nil
 }
 
 // Update updates an existing encrypted value.
 func (s *JSONFileStore) Update(key string, encryptedValue []byte) error {
-	data, err := s.loadData()
+	return s.UpdateWithMetadata(key, anyRevision, encryptedValue, nil)
+}
+
+// CompareAndSwap updates a secret if it is still at expectedRevision. The
+// check and the write happen under the file lock.
+func (s *JSONFileStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	return s.UpdateWithMetadata(key, expectedRevision, encryptedValue, nil)
+}
+
+// UpdateWithMetadata replaces the value of a secret at the expected revision
+// and applies edit to its metadata, in one write of the file.
+func (s *JSONFileStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc, err := s.loadData()
 	if err != nil {
 		return err
 	}
+	if err := doc.space(s.Namespace).update(key, expectedRevision, encryptedValue, edit, s.HistoryRetention); err != nil {
+		return err
+	}
+	return s.saveData(doc)
+}
 
-	if _, exists := data[key]; !exists {
+// update replaces the value of a secret of the namespace at the expected
+// revision, keeping retention previous versions, and applies edit to its
+// metadata.
+func (sp *jsonNamespace) update(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit, retention int) error {
+	entry, exists := sp.Entries[key]
+	if !exists {
 		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
 	}
+	if err := checkRevision(key, entry.Metadata, expectedRevision); err != nil {
+		return err
+	}
 
-	data[key] = encryptedValue
-	return s.saveData(data)
+	entry.History = prependVersion(entry.History, archiveVersion(entry.Value, entry.Metadata), retention)
+	entry.Value = encryptedValue
+	entry.Version = currentVersion(entry.Metadata) + 1
+	entry.UpdatedAt = time.Now().UTC()
+	edit.apply(&entry.Metadata)
+	return nil
 }
 
 // Delete removes a secret.
 func (s *JSONFileStore) Delete(key string) error {
-	data, err := s.loadData()
+	unlock, err := s.lock()
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	if _, exists := data[key]; !exists {
+	doc, err := s.loadData()
+	if err != nil {
+		return err
+	}
+	if err := doc.space(s.Namespace).delete(key); err != nil {
+		return err
+	}
+	return s.saveData(doc)
+}
+
+// delete removes a secret from the namespace.
+func (sp *jsonNamespace) delete(key string) error {
+	if _, exists := sp.Entries[key]; !exists {
 		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
 	}
+	delete(sp.Entries, key)
+	return nil
+}
 
-	delete(data, key)
-	return s.saveData(data)
+// ApplyBatch applies ops to the loaded document and writes the file once, so
+// a failing operation leaves the file untouched.
+func (s *JSONFileStore) ApplyBatch(ops []BatchOp) error {
+	if err := validateBatch(ops); err != nil {
+		return err
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return err
+	}
+	sp := doc.space(s.Namespace)
+	for i, op := range ops {
+		switch op.Kind {
+		case BatchCreate:
+			err = sp.create(op.Key, op.Value, op.Metadata)
+		case BatchUpdate:
+			err = sp.update(op.Key, anyRevision, op.Value, op.Metadata, s.HistoryRetention)
+		case BatchDelete:
+			err = sp.delete(op.Key)
+		}
+		if err != nil {
+			return batchOpError(i, op, err)
+		}
+	}
+	return s.saveData(doc)
 }
 
 // ListKeys lists all available keys.
 func (s *JSONFileStore) ListKeys() ([]string, error) {
-	data, err := s.loadData()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.loadData()
 	if err != nil {
 		return nil, err
 	}
+	sp := doc.space(s.Namespace)
 
-	keys := make([]string, 0, len(data))
-	for key := range data {
+	keys := make([]string, 0, len(sp.Entries))
+	for key := range sp.Entries {
 		keys = append(keys, key)
 	}
 	return keys, nil
 }
+
+// ReadMetadata returns the metadata of a secret.
+func (s *JSONFileStore) ReadMetadata(key string) (Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return Metadata{}, err
+	}
+	sp := doc.space(s.Namespace)
+
+	entry, exists := sp.Entries[key]
+	if !exists {
+		return Metadata{}, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+
+	return entry.Metadata, nil
+}
+
+// ListMetadata returns the metadata of every secret of the namespace from one
+// read of the file.
+func (s *JSONFileStore) ListMetadata() (map[string]Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return nil, err
+	}
+	sp := doc.space(s.Namespace)
+
+	all := make(map[string]Metadata, len(sp.Entries))
+	for key, entry := range sp.Entries {
+		all[key] = entry.Metadata
+	}
+	return all, nil
+}
+
+// WriteMetadata replaces the metadata of a secret.
+func (s *JSONFileStore) WriteMetadata(key string, md Metadata) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return err
+	}
+	sp := doc.space(s.Namespace)
+
+	entry, exists := sp.Entries[key]
+	if !exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+
+	md.Version = entry.Metadata.Version
+	entry.Metadata = md
+	return s.saveData(doc)
+}
+
+// ListVersions returns the retained previous versions of a secret.
+func (s *JSONFileStore) ListVersions(key string) ([]SecretVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return nil, err
+	}
+	sp := doc.space(s.Namespace)
+
+	entry, exists := sp.Entries[key]
+	if !exists {
+		return nil, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+
+	return entry.History, nil
+}
+
+// ReadVersion returns the value of the current or a previous version.
+func (s *JSONFileStore) ReadVersion(key string, version int64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return nil, err
+	}
+	sp := doc.space(s.Namespace)
+
+	entry, exists := sp.Entries[key]
+	if !exists {
+		return nil, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	if version == currentVersion(entry.Metadata) {
+		return entry.Value, nil
+	}
+	for _, v := range entry.History {
+		if v.Version == version {
+			return v.Value, nil
+		}
+	}
+
+	return nil, versionNotFound(key, version)
+}
+
+// Trash moves a secret to the trash.
+func (s *JSONFileStore) Trash(key string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return err
+	}
+	sp := doc.space(s.Namespace)
+
+	entry, exists := sp.Entries[key]
+	if !exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+
+	if _, trashed := sp.Trash[key]; trashed {
+		return alreadyInTrash(key)
+	}
+	if sp.Trash == nil {
+		sp.Trash = make(map[string]*jsonTrashEntry)
+	}
+	sp.Trash[key] = &jsonTrashEntry{jsonEntry: *entry, DeletedAt: time.Now().UTC()}
+	delete(sp.Entries, key)
+	return s.saveData(doc)
+}
+
+// ListTrash returns the secrets in the trash.
+func (s *JSONFileStore) ListTrash() ([]TrashedSecret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return nil, err
+	}
+	sp := doc.space(s.Namespace)
+
+	trashed := make([]TrashedSecret, 0, len(sp.Trash))
+	for key, entry := range sp.Trash {
+		trashed = append(trashed, TrashedSecret{Key: key, DeletedAt: entry.DeletedAt})
+	}
+	return trashed, nil
+}
+
+// Restore moves a secret out of the trash.
+func (s *JSONFileStore) Restore(key string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return err
+	}
+	sp := doc.space(s.Namespace)
+
+	entry, exists := sp.Trash[key]
+	if !exists {
+		return notInTrash(key)
+	}
+	if _, exists := sp.Entries[key]; exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+	}
+
+	sp.Entries[key] = &entry.jsonEntry
+	delete(sp.Trash, key)
+	return s.saveData(doc)
+}
+
+// Purge permanently removes the secrets trashed before the given time.
+func (s *JSONFileStore) Purge(before time.Time) ([]string, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return nil, err
+	}
+	sp := doc.space(s.Namespace)
+
+	var purged []string
+	for key, entry := range sp.Trash {
+		if entry.DeletedAt.Before(before) {
+			purged = append(purged, key)
+			delete(sp.Trash, key)
+		}
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+	if err := s.saveData(doc); err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+// ListNamespaces returns the namespaces that contain secrets.
+func (s *JSONFileStore) ListNamespaces() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for ns, sp := range doc.Namespaces {
+		if sp != nil && (len(sp.Entries) > 0 || len(sp.Trash) > 0) {
+			names = append(names, ns)
+		}
+	}
+	return namespaceList(names), nil
+}
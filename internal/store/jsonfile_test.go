@@ -0,0 +1,209 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestJSONFileStoreSeparateInstances simulates two processes by using two
+// store instances on the same file: they share no mutex, only the file lock.
+func TestJSONFileStoreSeparateInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	stores := make([]*JSONFileStore, 2)
+	for i := range stores {
+		s, err := NewJSONFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Init(); err != nil {
+			t.Fatal(err)
+		}
+		stores[i] = s
+	}
+
+	const perStore = 20
+	var wg sync.WaitGroup
+	for i, s := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range perStore {
+				key := fmt.Sprintf("store-%d-key-%d", i, j)
+				if err := s.Create(key, []byte(key)); err != nil {
+					t.Errorf("Create(%q): %v", key, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	keys, err := stores[0].ListKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != len(stores)*perStore {
+		t.Fatalf("found %d keys after concurrent creates, want %d", len(keys), len(stores)*perStore)
+	}
+}
+
+func TestJSONFileStoreLockTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	held, err := acquireFileLock(path+".lock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.LockTimeout = 50 * time.Millisecond
+
+	if err := s.Create("blocked", []byte("value")); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Create while locked: got %v, want ErrLockTimeout", err)
+	}
+
+	if err := held.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("blocked", []byte("value")); err != nil {
+		t.Fatalf("Create after unlock failed: %v", err)
+	}
+}
+
+func TestJSONFileStoreLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	legacy := `{"db_password": "` + base64.StdEncoding.EncodeToString([]byte("ciphertext")) + `"}`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := s.Read("db_password")
+	if err != nil || string(value) != "ciphertext" {
+		t.Fatalf("Read of legacy entry = %q, %v", value, err)
+	}
+	md, err := s.ReadMetadata("db_password")
+	if err != nil || !md.CreatedAt.IsZero() {
+		t.Fatalf("ReadMetadata of legacy entry = %+v, %v; want zero metadata", md, err)
+	}
+
+	// The next change rewrites the file in the current format
+	if err := s.Create("api_token", []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc jsonDocument
+	if err := json.Unmarshal(content, &doc); err != nil || len(doc.Entries) != 2 {
+		t.Fatalf("file after write is not a document with 2 entries: %v\n%s", err, content)
+	}
+	if string(doc.Entries["db_password"].Value) != "ciphertext" {
+		t.Fatalf("legacy entry lost on rewrite:\n%s", content)
+	}
+}
+
+// readJSONHeader returns the header of the JSON document at path.
+func readJSONHeader(t *testing.T, path string) jsonHeader {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header jsonHeader
+	if err := json.Unmarshal(content, &header); err != nil {
+		t.Fatalf("file is not a JSON document: %v\n%s", err, content)
+	}
+	return header
+}
+
+func TestJSONFileStoreFormatVersions(t *testing.T) {
+	dir := t.TempDir()
+
+	// New files get the newest version
+	s, err := NewJSONFileStore(filepath.Join(dir, "new.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if h := readJSONHeader(t, s.FilePath); h.Version != JSONFileVersion || h.StoreID == "" || h.Cipher == "" || h.KDF == "" {
+		t.Fatalf("header of new file = %+v", h)
+	}
+
+	// Version 1 files stay version 1 until upgraded
+	v1 := filepath.Join(dir, "v1.json")
+	if err := os.WriteFile(v1, []byte(`{"entries": {}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewJSONFileStore(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if h := readJSONHeader(t, v1); h != (jsonHeader{}) {
+		t.Fatalf("change of version 1 file wrote header %+v", h)
+	}
+
+	upgrade, err := s.Upgrade()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := readJSONHeader(t, v1)
+	if upgrade.From != 1 || upgrade.To != JSONFileVersion || h.Version != JSONFileVersion || h.StoreID != upgrade.StoreID {
+		t.Fatalf("Upgrade = %+v, header %+v", upgrade, h)
+	}
+	if value, err := s.Read("a"); err != nil || string(value) != "1" {
+		t.Fatalf("Read after upgrade = %q, %v", value, err)
+	}
+	if again, err := s.Upgrade(); err != nil || again.From != JSONFileVersion || again.StoreID != h.StoreID {
+		t.Fatalf("second Upgrade = %+v, %v", again, err)
+	}
+}
+
+func TestJSONFileStoreNewerFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	newer := fmt.Sprintf(`{"version": %d, "entries": {"a": {"value": "MQ=="}}}`, JSONFileVersion+1)
+	if err := os.WriteFile(path, []byte(newer), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := s.Read("a"); err != nil || string(value) != "1" {
+		t.Fatalf("Read of newer format = %q, %v", value, err)
+	}
+	if err := s.Create("b", []byte("2")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("Create in newer format = %v, want ErrUnsupportedFormat", err)
+	}
+	if _, err := s.Upgrade(); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("Upgrade of newer format = %v, want ErrUnsupportedFormat", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != newer {
+		t.Fatalf("file in newer format was changed:\n%s", content)
+	}
+}
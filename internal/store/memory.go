@@ -0,0 +1,432 @@
+package store
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+// memoryEntry is a secret held by MemoryStore.
+type memoryEntry struct {
+	value    []byte
+	metadata Metadata
+	history  []SecretVersion // Newest first
+}
+
+// trashedMemoryEntry is a secret in the trash of a MemoryStore.
+type trashedMemoryEntry struct {
+	*memoryEntry
+	deletedAt time.Time
+}
+
+// memorySpace holds the secrets of one namespace.
+type memorySpace struct {
+	data  map[string]*memoryEntry
+	trash map[string]trashedMemoryEntry
+}
+
+// memoryState is the content of a MemoryStore, shared by its clones.
+type memoryState struct {
+	mu     sync.RWMutex
+	spaces map[string]*memorySpace
+}
+
+// MemoryStore implements the SecretStore interface in process memory.
+// It is intended for tests and never persists anything.
+type MemoryStore struct {
+	Namespace        string
+	HistoryRetention int // Number of previous versions kept per secret
+	*memoryState
+}
+
+// NewMemoryStore creates a new, empty MemoryStore instance.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Namespace:        DefaultNamespace,
+		HistoryRetention: DefaultHistoryRetention,
+		memoryState:      &memoryState{spaces: make(map[string]*memorySpace)},
+	}
+}
+
+// Clone returns a store sharing the secrets of s whose settings can be
+// changed independently.
+func (s *MemoryStore) Clone() *MemoryStore {
+	c := *s
+	return &c
+}
+
+// setHistoryRetention sets the number of previous versions kept per secret.
+func (s *MemoryStore) setHistoryRetention(n int) {
+	s.HistoryRetention = n
+}
+
+// setNamespace selects the namespace the store operates on.
+func (s *MemoryStore) setNamespace(ns string) {
+	s.Namespace = ns
+}
+
+// space returns the secrets of the selected namespace. The caller must hold
+// s.mu, for writing if create is set.
+func (s *MemoryStore) space(create bool) *memorySpace {
+	sp, exists := s.spaces[s.Namespace]
+	if !exists {
+		sp = &memorySpace{data: make(map[string]*memoryEntry), trash: make(map[string]trashedMemoryEntry)}
+		if create {
+			s.spaces[s.Namespace] = sp
+		}
+	}
+	return sp
+}
+
+// Init does nothing for an in-memory store.
+func (s *MemoryStore) Init() error {
+	return nil
+}
+
+// Close does nothing for an in-memory store; the secrets are kept.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Create stores a copy of a new encrypted value.
+func (s *MemoryStore) Create(key string, encryptedValue []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return createMemoryEntry(s.space(true).data, key, encryptedValue, nil)
+}
+
+// CreateWithMetadata stores a copy of a new encrypted value and applies edit
+// to its metadata.
+func (s *MemoryStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return createMemoryEntry(s.space(true).data, key, encryptedValue, edit)
+}
+
+// createMemoryEntry adds a new secret to data, applying edit to its metadata.
+func createMemoryEntry(data map[string]*memoryEntry, key string, encryptedValue []byte, edit MetadataEdit) error {
+	if _, exists := data[key]; exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+	}
+	md := newMetadata()
+	edit.apply(&md)
+	md.Tags = maps.Clone(md.Tags)
+	data[key] = &memoryEntry{
+		value:    append([]byte(nil), encryptedValue...),
+		metadata: md,
+	}
+	return nil
+}
+
+// Read retrieves a copy of an encrypted value.
+func (s *MemoryStore) Read(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp := s.space(false)
+
+	entry, exists := sp.data[key]
+	if !exists {
+		return nil, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+// ReadRevision returns a copy of the encrypted value and its revision.
+func (s *MemoryStore) ReadRevision(key string) ([]byte, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp := s.space(false)
+
+	entry, exists := sp.data[key]
+	if !exists {
+		return nil, 0, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	return append([]byte(nil), entry.value...), currentVersion(entry.metadata), nil
+}
+
+// Update replaces an existing encrypted value with a copy of the new one.
+func (s *MemoryStore) Update(key string, encryptedValue []byte) error {
+	return s.UpdateWithMetadata(key, anyRevision, encryptedValue, nil)
+}
+
+// CompareAndSwap updates a secret if it is still at expectedRevision.
+func (s *MemoryStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	return s.UpdateWithMetadata(key, expectedRevision, encryptedValue, nil)
+}
+
+// UpdateWithMetadata replaces the value of a secret at the expected revision
+// and applies edit to its metadata.
+func (s *MemoryStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateEntry(s.space(true).data, key, expectedRevision, encryptedValue, edit)
+}
+
+// updateEntry replaces the secret in data with an updated copy, so that the
+// entry itself is never modified, and applies edit to its metadata.
+func (s *MemoryStore) updateEntry(data map[string]*memoryEntry, key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	entry, exists := data[key]
+	if !exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	if err := checkRevision(key, entry.metadata, expectedRevision); err != nil {
+		return err
+	}
+	updated := *entry
+	updated.history = prependVersion(entry.history, archiveVersion(entry.value, entry.metadata), s.HistoryRetention)
+	updated.value = append([]byte(nil), encryptedValue...)
+	updated.metadata.Version = currentVersion(entry.metadata) + 1
+	updated.metadata.UpdatedAt = time.Now().UTC()
+	updated.metadata.Tags = maps.Clone(entry.metadata.Tags)
+	edit.apply(&updated.metadata)
+	data[key] = &updated
+	return nil
+}
+
+// ApplyBatch applies ops to a copy of the namespace's secrets and keeps the
+// copy only if every operation succeeds.
+func (s *MemoryStore) ApplyBatch(ops []BatchOp) error {
+	if err := validateBatch(ops); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp := s.space(true)
+	data := maps.Clone(sp.data)
+	for i, op := range ops {
+		var err error
+		switch op.Kind {
+		case BatchCreate:
+			err = createMemoryEntry(data, op.Key, op.Value, op.Metadata)
+		case BatchUpdate:
+			err = s.updateEntry(data, op.Key, anyRevision, op.Value, op.Metadata)
+		case BatchDelete:
+			if _, exists := data[op.Key]; !exists {
+				err = fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, op.Key)
+			}
+			delete(data, op.Key)
+		}
+		if err != nil {
+			return batchOpError(i, op, err)
+		}
+	}
+	sp.data = data
+	return nil
+}
+
+// Delete removes a secret.
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp := s.space(true)
+
+	if _, exists := sp.data[key]; !exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	delete(sp.data, key)
+	return nil
+}
+
+// ListKeys lists all available keys.
+func (s *MemoryStore) ListKeys() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp := s.space(false)
+
+	keys := make([]string, 0, len(sp.data))
+	for key := range sp.data {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ReadMetadata returns a copy of the metadata of a secret.
+func (s *MemoryStore) ReadMetadata(key string) (Metadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp := s.space(false)
+
+	entry, exists := sp.data[key]
+	if !exists {
+		return Metadata{}, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	md := entry.metadata
+	md.Tags = maps.Clone(md.Tags)
+	return md, nil
+}
+
+// ListMetadata returns copies of the metadata of every secret.
+func (s *MemoryStore) ListMetadata() (map[string]Metadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp := s.space(false)
+
+	all := make(map[string]Metadata, len(sp.data))
+	for key, entry := range sp.data {
+		md := entry.metadata
+		md.Tags = maps.Clone(md.Tags)
+		all[key] = md
+	}
+	return all, nil
+}
+
+// WriteMetadata replaces the metadata of a secret with a copy of md.
+func (s *MemoryStore) WriteMetadata(key string, md Metadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp := s.space(true)
+
+	entry, exists := sp.data[key]
+	if !exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	md.Tags = maps.Clone(md.Tags)
+	md.Version = entry.metadata.Version
+	entry.metadata = md
+	return nil
+}
+
+// ListVersions returns copies of the retained previous versions of a secret.
+func (s *MemoryStore) ListVersions(key string) ([]SecretVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp := s.space(false)
+
+	entry, exists := sp.data[key]
+	if !exists {
+		return nil, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	versions := make([]SecretVersion, len(entry.history))
+	for i, v := range entry.history {
+		v.Value = append([]byte(nil), v.Value...)
+		versions[i] = v
+	}
+	return versions, nil
+}
+
+// ReadVersion returns a copy of the value of the current or a previous version.
+func (s *MemoryStore) ReadVersion(key string, version int64) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp := s.space(false)
+
+	entry, exists := sp.data[key]
+	if !exists {
+		return nil, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	if version == currentVersion(entry.metadata) {
+		return append([]byte(nil), entry.value...), nil
+	}
+	for _, v := range entry.history {
+		if v.Version == version {
+			return append([]byte(nil), v.Value...), nil
+		}
+	}
+	return nil, versionNotFound(key, version)
+}
+
+// Trash moves a secret to the trash.
+func (s *MemoryStore) Trash(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp := s.space(true)
+
+	entry, exists := sp.data[key]
+	if !exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	if _, trashed := sp.trash[key]; trashed {
+		return alreadyInTrash(key)
+	}
+	sp.trash[key] = trashedMemoryEntry{memoryEntry: entry, deletedAt: time.Now().UTC()}
+	delete(sp.data, key)
+	return nil
+}
+
+// ListTrash returns the secrets in the trash.
+func (s *MemoryStore) ListTrash() ([]TrashedSecret, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sp := s.space(false)
+
+	trashed := make([]TrashedSecret, 0, len(sp.trash))
+	for key, entry := range sp.trash {
+		trashed = append(trashed, TrashedSecret{Key: key, DeletedAt: entry.deletedAt})
+	}
+	return trashed, nil
+}
+
+// Restore moves a secret out of the trash.
+func (s *MemoryStore) Restore(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp := s.space(true)
+
+	entry, exists := sp.trash[key]
+	if !exists {
+		return notInTrash(key)
+	}
+	if _, exists := sp.data[key]; exists {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+	}
+	sp.data[key] = entry.memoryEntry
+	delete(sp.trash, key)
+	return nil
+}
+
+// Purge permanently removes the secrets trashed before the given time.
+func (s *MemoryStore) Purge(before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp := s.space(true)
+
+	var purged []string
+	for key, entry := range sp.trash {
+		if entry.deletedAt.Before(before) {
+			purged = append(purged, key)
+			delete(sp.trash, key)
+		}
+	}
+	return purged, nil
+}
+
+// ListNamespaces returns the namespaces that contain secrets.
+func (s *MemoryStore) ListNamespaces() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var names []string
+	for ns, sp := range s.spaces {
+		if len(sp.data) > 0 || len(sp.trash) > 0 {
+			names = append(names, ns)
+		}
+	}
+	return namespaceList(names), nil
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotSupported is returned when a backend lacks an optional capability.
+var ErrNotSupported = fmt.Errorf("operation not supported by backend")
+
+// describeStore names s in ErrNotSupported errors: the configured backend,
+// or the wrapper around it, which may lack capabilities the backend has.
+func describeStore(s SecretStore) string {
+	switch s.(type) {
+	case *OverlayStore:
+		return "the overlay"
+	case *MirrorStore:
+		return "a store with replicas"
+	}
+	return fmt.Sprintf("backend '%s'", BackendType)
+}
+
+// Policies for reading a secret past its expiry date, see ExpiryPolicy.
+const (
+	ExpiryPolicyWarn   = "warn"   // Print a warning and return the value
+	ExpiryPolicyRefuse = "refuse" // Fail the read
+)
+
+// Metadata describes a secret without revealing its value.
+type Metadata struct {
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	CreatedBy   string            `json:"created_by,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Version     int64             `json:"version,omitempty"`      // Incremented by every Update
+	ExpiresAt   time.Time         `json:"expires_at,omitzero"`    // Rotate-by date; zero if the secret never expires
+	RotateEvery string            `json:"rotate_every,omitempty"` // Age, such as 90d, that each update moves ExpiresAt ahead by
+}
+
+// Expired reports whether the secret's expiry date has passed at now.
+func (md Metadata) Expired(now time.Time) bool {
+	return !md.ExpiresAt.IsZero() && !now.Before(md.ExpiresAt)
+}
+
+// MetadataStore is implemented by backends that keep a metadata record next
+// to each secret. Create stamps CreatedAt and UpdatedAt, Update refreshes
+// UpdatedAt and increments Version, and Delete removes the record together
+// with the secret.
+type MetadataStore interface {
+	SecretStore
+
+	// ReadMetadata returns the metadata of an existing secret. Secrets
+	// written before metadata was introduced return a zero Metadata.
+	// Returns an error wrapping ErrSecretNotFound if the key doesn't exist.
+	ReadMetadata(key string) (Metadata, error)
+	// WriteMetadata replaces the metadata of an existing secret as given,
+	// except for Version: the revision only changes with the value. Returns an error wrapping ErrSecretNotFound if the key doesn't exist.
+	WriteMetadata(key string, md Metadata) error
+}
+
+// AsMetadataStore returns s as a MetadataStore, or an error wrapping
+// ErrNotSupported if the backend doesn't keep metadata.
+func AsMetadataStore(s SecretStore) (MetadataStore, error) {
+	ms, ok := s.(MetadataStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s does not keep secret metadata", ErrNotSupported, describeStore(s))
+	}
+	return ms, nil
+}
+
+// newMetadata returns the metadata of a secret created now.
+func newMetadata() Metadata {
+	now := time.Now().UTC()
+	return Metadata{CreatedAt: now, UpdatedAt: now, Version: 1}
+}
+
+// MetadataEdit changes the metadata of a secret as it is written, such as its
+// description or tags. Changes to Version are ignored; the revision only
+// changes with the value.
+type MetadataEdit func(md *Metadata)
+
+// apply runs edit on md, keeping its revision. A nil edit does nothing.
+func (edit MetadataEdit) apply(md *Metadata) {
+	if edit == nil {
+		return
+	}
+	version := md.Version
+	edit(md)
+	md.Version = version
+}
+
+// MetadataEditStore is implemented by backends that write a secret's value
+// and the changes to its metadata in one step, so that they are never seen,
+// or committed to git, apart.
+type MetadataEditStore interface {
+	MetadataStore
+
+	// CreateWithMetadata stores a new secret like Create and applies edit to
+	// its fresh metadata.
+	CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error
+	// UpdateWithMetadata updates a secret like CompareAndSwap, or like Update
+	// if expectedRevision is 0, and applies edit to its updated metadata.
+	UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error
+}
+
+// CreateWithMetadata creates a secret in s and applies edit, which may be
+// nil, to its metadata. Backends that don't implement MetadataEditStore write
+// the metadata in a second step.
+func CreateWithMetadata(s SecretStore, key string, encryptedValue []byte, edit MetadataEdit) error {
+	if es, ok := s.(MetadataEditStore); ok {
+		return es.CreateWithMetadata(key, encryptedValue, edit)
+	}
+	ms, err := metadataStoreFor(s, edit)
+	if err != nil {
+		return err
+	}
+	if err := s.Create(key, encryptedValue); err != nil {
+		return err
+	}
+	return editMetadata(ms, key, edit)
+}
+
+// UpdateWithMetadata updates a secret in s, only if it is still at
+// expectedRevision unless that is 0, and applies edit, which may be nil, to
+// its metadata. Backends that don't implement MetadataEditStore write the
+// metadata in a second step.
+func UpdateWithMetadata(s SecretStore, key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	if es, ok := s.(MetadataEditStore); ok {
+		return es.UpdateWithMetadata(key, expectedRevision, encryptedValue, edit)
+	}
+	ms, err := metadataStoreFor(s, edit)
+	if err != nil {
+		return err
+	}
+	if expectedRevision == anyRevision {
+		err = s.Update(key, encryptedValue)
+	} else {
+		var rs RevisionStore
+		if rs, err = AsRevisionStore(s); err != nil {
+			return err
+		}
+		err = rs.CompareAndSwap(key, expectedRevision, encryptedValue)
+	}
+	if err != nil {
+		return err
+	}
+	return editMetadata(ms, key, edit)
+}
+
+// metadataStoreFor returns s as a MetadataStore if edit is set, failing
+// before anything is written if the backend doesn't keep metadata.
+func metadataStoreFor(s SecretStore, edit MetadataEdit) (MetadataStore, error) {
+	if edit == nil {
+		return nil, nil
+	}
+	return AsMetadataStore(s)
+}
+
+// editMetadata applies edit to the metadata of key in ms. A nil edit does
+// nothing.
+func editMetadata(ms MetadataStore, key string, edit MetadataEdit) error {
+	if edit == nil {
+		return nil
+	}
+	md, err := ms.ReadMetadata(key)
+	if err != nil {
+		return err
+	}
+	edit.apply(&md)
+	return ms.WriteMetadata(key, md)
+}
+
+// MetadataLister is implemented by backends that can read the metadata of
+// every secret of the namespace at once, such as in a single query.
+type MetadataLister interface {
+	// ListMetadata returns the metadata of every secret, by key.
+	ListMetadata() (map[string]Metadata, error)
+}
+
+// ListMetadata returns the metadata of every secret of s by key, letting the
+// backend read it at once if it implements MetadataLister. Otherwise it is
+// read key by key, skipping secrets deleted in the meantime.
+func ListMetadata(s SecretStore) (map[string]Metadata, error) {
+	if ml, ok := s.(MetadataLister); ok {
+		return ml.ListMetadata()
+	}
+	ms, err := AsMetadataStore(s)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.ListKeys()
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]Metadata, len(keys))
+	for _, key := range keys {
+		md, err := ms.ReadMetadata(key)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metadata of '%s': %w", key, err)
+		}
+		all[key] = md
+	}
+	return all, nil
+}
@@ -0,0 +1,629 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MirrorMember is one store of a MirrorStore.
+type MirrorMember struct {
+	Name  string // Backend or store spec, for messages
+	Store SecretStore
+}
+
+// MirrorStore writes every change to a primary store and its replicas, and
+// reads from the first member that can be reached, so the replicas are an
+// up-to-date offsite copy of the primary. Changes need the primary; a replica
+// that misses a change is reported with a warning and brought back in sync by
+// Repair. History, trash listings and revisions are the primary's, since
+// each member keeps its own.
+type MirrorStore struct {
+	Members  []MirrorMember // The primary first, then the replicas
+	Warnings io.Writer      // Receives warnings about unavailable replicas
+
+	mu     sync.Mutex
+	failed []error // Why each member is unavailable; nil if it is healthy
+}
+
+// ReplicaStatus describes how a replica differs from the primary.
+type ReplicaStatus struct {
+	Name      string   `json:"name"`
+	Error     string   `json:"error,omitempty"`     // Why the replica couldn't be compared
+	Missing   []string `json:"missing,omitempty"`   // Keys only the primary has
+	Extra     []string `json:"extra,omitempty"`     // Keys only the replica has
+	Different []string `json:"different,omitempty"` // Keys with another value
+}
+
+// InSync reports whether the replica holds the same secrets as the primary.
+func (rs ReplicaStatus) InSync() bool {
+	return rs.Error == "" && len(rs.Missing) == 0 && len(rs.Extra) == 0 && len(rs.Different) == 0
+}
+
+// NewMirrorStore mirrors primary to replicas.
+func NewMirrorStore(primary MirrorMember, replicas ...MirrorMember) (*MirrorStore, error) {
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("%w: mirror needs at least one replica", ErrInvalidConfiguration)
+	}
+	return &MirrorStore{Members: append([]MirrorMember{primary}, replicas...), Warnings: os.Stderr}, nil
+}
+
+// AsMirrorStore returns s as a MirrorStore, or an error if no replicas are
+// configured.
+func AsMirrorStore(s SecretStore) (*MirrorStore, error) {
+	ms, ok := s.(*MirrorStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: no replicas configured", ErrInvalidConfiguration)
+	}
+	return ms, nil
+}
+
+// withReplicas mirrors s, the store of backend, to the same namespace of the
+// stores of Replicas.
+func withReplicas(s SecretStore, backend, namespace string) (SecretStore, error) {
+	replicas := make([]MirrorMember, 0, len(Replicas))
+	for _, spec := range Replicas {
+		replicaBackend, location, err := parseStoreSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		r, err := newStore(replicaBackend, location, namespace, false)
+		if err != nil {
+			return nil, fmt.Errorf("replica '%s': %w", spec, err)
+		}
+		replicas = append(replicas, MirrorMember{Name: spec, Store: r})
+	}
+	return NewMirrorStore(MirrorMember{Name: backend, Store: s}, replicas...)
+}
+
+// Init initializes all members. It fails only if none can be initialized;
+// unavailable replicas are skipped with a warning.
+func (s *MirrorStore) Init() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = make([]error, len(s.Members))
+	healthy := false
+	for i, m := range s.Members {
+		if err := m.Store.Init(); err != nil {
+			s.failed[i] = err
+			if i > 0 {
+				fmt.Fprintf(s.Warnings, "warning: replica '%s' unavailable: %v\n", m.Name, err)
+			}
+			continue
+		}
+		healthy = true
+	}
+	if !healthy {
+		return s.failed[0]
+	}
+	return nil
+}
+
+// Close closes all members that were initialized.
+func (s *MirrorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for i, m := range s.Members {
+		if s.failed[i] != nil {
+			continue
+		}
+		if err := m.Store.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unavailable returns why member i is unavailable, or nil.
+func (s *MirrorStore) unavailable(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failed[i]
+}
+
+// primary returns the primary store, or an error if it is unavailable.
+func (s *MirrorStore) primary() (SecretStore, error) {
+	if err := s.unavailable(0); err != nil {
+		return nil, fmt.Errorf("primary store '%s' unavailable: %w", s.Members[0].Name, err)
+	}
+	return s.Members[0].Store, nil
+}
+
+// write applies a change to the primary and then to every replica. Replicas
+// that fail get a warning, since the change was made.
+func (s *MirrorStore) write(change func(SecretStore) error) error {
+	return s.writeSplit(change, change)
+}
+
+// writeSplit is write with a different change for the replicas, such as an
+// update without the revision check of the primary's.
+func (s *MirrorStore) writeSplit(change, replicaChange func(SecretStore) error) error {
+	primary, err := s.primary()
+	if err != nil {
+		return err
+	}
+	if err := change(primary); err != nil {
+		return err
+	}
+	for i, m := range s.Members[1:] {
+		err := s.unavailable(i + 1)
+		if err == nil {
+			err = replicaChange(m.Store)
+		}
+		if err != nil {
+			fmt.Fprintf(s.Warnings, "warning: replica '%s' not updated, run 'replica repair': %v\n", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// read runs fetch against the first healthy member whose answer is definite,
+// marking members that fail otherwise as unavailable.
+func (s *MirrorStore) read(fetch func(SecretStore) error) error {
+	var err error
+	for i, m := range s.Members {
+		if s.unavailable(i) != nil {
+			continue
+		}
+		if err = fetch(m.Store); err == nil || definiteError(err) {
+			return err
+		}
+		s.mu.Lock()
+		s.failed[i] = err
+		s.mu.Unlock()
+		fmt.Fprintf(s.Warnings, "warning: store '%s' unavailable, trying the next one: %v\n", m.Name, err)
+	}
+	if err == nil {
+		err = s.unavailable(0) // No member was healthy to begin with
+	}
+	return err
+}
+
+// Create stores a new encrypted value in all members.
+func (s *MirrorStore) Create(key string, encryptedValue []byte) error {
+	return s.write(func(m SecretStore) error { return m.Create(key, encryptedValue) })
+}
+
+// Read retrieves an encrypted value from the first healthy member.
+func (s *MirrorStore) Read(key string) (value []byte, err error) {
+	err = s.read(func(m SecretStore) (err error) {
+		value, err = m.Read(key)
+		return err
+	})
+	return value, err
+}
+
+// Update updates an existing encrypted value in all members.
+func (s *MirrorStore) Update(key string, encryptedValue []byte) error {
+	return s.write(func(m SecretStore) error { return m.Update(key, encryptedValue) })
+}
+
+// Delete removes a secret from all members.
+func (s *MirrorStore) Delete(key string) error {
+	return s.write(func(m SecretStore) error { return m.Delete(key) })
+}
+
+// ListKeys lists all available keys of the first healthy member.
+func (s *MirrorStore) ListKeys() (keys []string, err error) {
+	err = s.read(func(m SecretStore) (err error) {
+		keys, err = m.ListKeys()
+		return err
+	})
+	return keys, err
+}
+
+// ListKeysWithPrefix lists the keys starting with prefix of the first
+// healthy member.
+func (s *MirrorStore) ListKeysWithPrefix(prefix string) (keys []string, err error) {
+	err = s.read(func(m SecretStore) (err error) {
+		keys, err = ListKeysWithPrefix(m, prefix)
+		return err
+	})
+	return keys, err
+}
+
+// ReadMetadata returns the metadata of a secret from the first healthy
+// member.
+func (s *MirrorStore) ReadMetadata(key string) (md Metadata, err error) {
+	err = s.read(func(m SecretStore) error {
+		ms, err := AsMetadataStore(m)
+		if err != nil {
+			return err
+		}
+		md, err = ms.ReadMetadata(key)
+		return err
+	})
+	return md, err
+}
+
+// WriteMetadata replaces the metadata of a secret in all members that keep
+// metadata.
+func (s *MirrorStore) WriteMetadata(key string, md Metadata) error {
+	if _, err := AsMetadataStore(s.Members[0].Store); err != nil {
+		return err
+	}
+	return s.write(func(m SecretStore) error {
+		ms, ok := m.(MetadataStore)
+		if !ok {
+			return nil
+		}
+		return ms.WriteMetadata(key, md)
+	})
+}
+
+// ListMetadata returns the metadata of every secret from the first healthy
+// member.
+func (s *MirrorStore) ListMetadata() (all map[string]Metadata, err error) {
+	err = s.read(func(m SecretStore) (err error) {
+		all, err = ListMetadata(m)
+		return err
+	})
+	return all, err
+}
+
+// replicaEdit returns edit for a replica that keeps metadata, and nil for one
+// that doesn't, so it still gets the value.
+func replicaEdit(m SecretStore, edit MetadataEdit) MetadataEdit {
+	if _, ok := m.(MetadataStore); !ok {
+		return nil
+	}
+	return edit
+}
+
+// CreateWithMetadata stores a new encrypted value with edited metadata in
+// all members.
+func (s *MirrorStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	return s.writeSplit(func(m SecretStore) error {
+		return CreateWithMetadata(m, key, encryptedValue, edit)
+	}, func(m SecretStore) error {
+		return CreateWithMetadata(m, key, encryptedValue, replicaEdit(m, edit))
+	})
+}
+
+// UpdateWithMetadata updates a secret and its metadata in all members. Only
+// the primary's revision is checked; the replicas count their own.
+func (s *MirrorStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	return s.writeSplit(func(m SecretStore) error {
+		return UpdateWithMetadata(m, key, expectedRevision, encryptedValue, edit)
+	}, func(m SecretStore) error {
+		return UpdateWithMetadata(m, key, anyRevision, encryptedValue, replicaEdit(m, edit))
+	})
+}
+
+// ReadRevision retrieves an encrypted value and its revision from the
+// primary, whose revisions CompareAndSwap checks.
+func (s *MirrorStore) ReadRevision(key string) ([]byte, int64, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, 0, err
+	}
+	rs, err := AsRevisionStore(primary)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rs.ReadRevision(key)
+}
+
+// CompareAndSwap updates a secret in all members if it is still at
+// expectedRevision in the primary.
+func (s *MirrorStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	return s.writeSplit(func(m SecretStore) error {
+		rs, err := AsRevisionStore(m)
+		if err != nil {
+			return err
+		}
+		return rs.CompareAndSwap(key, expectedRevision, encryptedValue)
+	}, func(m SecretStore) error {
+		return m.Update(key, encryptedValue)
+	})
+}
+
+// ApplyBatch applies a batch atomically to the primary and then to every
+// replica, one change at a time for replicas that can't apply batches.
+func (s *MirrorStore) ApplyBatch(ops []BatchOp) error {
+	return s.writeSplit(func(m SecretStore) error {
+		bs, err := AsBatchStore(m)
+		if err != nil {
+			return err
+		}
+		return bs.ApplyBatch(ops)
+	}, func(m SecretStore) error {
+		if bs, ok := m.(BatchStore); ok {
+			return bs.ApplyBatch(ops)
+		}
+		for _, op := range ops {
+			var err error
+			switch op.Kind {
+			case BatchCreate:
+				err = CreateWithMetadata(m, op.Key, op.Value, replicaEdit(m, op.Metadata))
+			case BatchUpdate:
+				err = UpdateWithMetadata(m, op.Key, anyRevision, op.Value, replicaEdit(m, op.Metadata))
+			case BatchDelete:
+				err = m.Delete(op.Key)
+			}
+			if err != nil {
+				return fmt.Errorf("%s '%s': %w", op.Kind, op.Key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListVersions returns the previous versions of a secret kept by the
+// primary.
+func (s *MirrorStore) ListVersions(key string) ([]SecretVersion, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, err
+	}
+	vs, err := AsVersionedStore(primary)
+	if err != nil {
+		return nil, err
+	}
+	return vs.ListVersions(key)
+}
+
+// ReadVersion returns one version of a secret kept by the primary.
+func (s *MirrorStore) ReadVersion(key string, version int64) ([]byte, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, err
+	}
+	vs, err := AsVersionedStore(primary)
+	if err != nil {
+		return nil, err
+	}
+	return vs.ReadVersion(key, version)
+}
+
+// Trash moves a secret to the trash of all members; replicas without a
+// trash delete it.
+func (s *MirrorStore) Trash(key string) error {
+	return s.writeSplit(func(m SecretStore) error {
+		ts, err := AsTrashStore(m)
+		if err != nil {
+			return err
+		}
+		return ts.Trash(key)
+	}, func(m SecretStore) error {
+		if ts, ok := m.(TrashStore); ok {
+			return ts.Trash(key)
+		}
+		return m.Delete(key)
+	})
+}
+
+// ListTrash lists the trashed secrets of the primary.
+func (s *MirrorStore) ListTrash() ([]TrashedSecret, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, err
+	}
+	ts, err := AsTrashStore(primary)
+	if err != nil {
+		return nil, err
+	}
+	return ts.ListTrash()
+}
+
+// Restore moves a secret out of the trash of all members. Replicas without a
+// trash get it copied from the primary.
+func (s *MirrorStore) Restore(key string) error {
+	primary := s.Members[0].Store
+	return s.writeSplit(func(m SecretStore) error {
+		ts, err := AsTrashStore(m)
+		if err != nil {
+			return err
+		}
+		return ts.Restore(key)
+	}, func(m SecretStore) error {
+		if ts, ok := m.(TrashStore); ok {
+			return ts.Restore(key)
+		}
+		value, err := primary.Read(key)
+		if err != nil {
+			return err
+		}
+		if err := m.Create(key, value); err != nil {
+			return err
+		}
+		return copyMirrorMetadata(primary, m, key)
+	})
+}
+
+// Purge permanently removes the secrets trashed before the given time from
+// all members and returns the keys purged from the primary.
+func (s *MirrorStore) Purge(before time.Time) (purged []string, err error) {
+	err = s.writeSplit(func(m SecretStore) error {
+		ts, err := AsTrashStore(m)
+		if err != nil {
+			return err
+		}
+		purged, err = ts.Purge(before)
+		return err
+	}, func(m SecretStore) error {
+		if ts, ok := m.(TrashStore); ok {
+			_, err := ts.Purge(before)
+			return err
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// ListNamespaces returns the namespaces of the primary.
+func (s *MirrorStore) ListNamespaces() ([]string, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, err
+	}
+	ns, err := AsNamespacedStore(primary)
+	if err != nil {
+		return nil, err
+	}
+	return ns.ListNamespaces()
+}
+
+// setNamespace selects the namespace of all members.
+func (s *MirrorStore) setNamespace(ns string) {
+	for _, m := range s.Members {
+		if nsel, ok := m.Store.(namespaceSelector); ok {
+			nsel.setNamespace(ns)
+		}
+	}
+}
+
+// setHistoryRetention configures the history retention of all members.
+func (s *MirrorStore) setHistoryRetention(n int) {
+	for _, m := range s.Members {
+		if hr, ok := m.Store.(historyRetainer); ok {
+			hr.setHistoryRetention(n)
+		}
+	}
+}
+
+// Status compares every replica with the primary.
+func (s *MirrorStore) Status() ([]ReplicaStatus, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, err
+	}
+	want, err := readAll(primary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read primary store '%s': %w", s.Members[0].Name, err)
+	}
+
+	statuses := make([]ReplicaStatus, 0, len(s.Members)-1)
+	for i, m := range s.Members[1:] {
+		status := ReplicaStatus{Name: m.Name}
+		if err := s.unavailable(i + 1); err != nil {
+			status.Error = err.Error()
+			statuses = append(statuses, status)
+			continue
+		}
+		have, err := readAll(m.Store)
+		if err != nil {
+			status.Error = err.Error()
+			statuses = append(statuses, status)
+			continue
+		}
+		for key, value := range want {
+			haveValue, ok := have[key]
+			switch {
+			case !ok:
+				status.Missing = append(status.Missing, key)
+			case !bytes.Equal(value, haveValue):
+				status.Different = append(status.Different, key)
+			}
+		}
+		for key := range have {
+			if _, ok := want[key]; !ok {
+				status.Extra = append(status.Extra, key)
+			}
+		}
+		slices.Sort(status.Missing)
+		slices.Sort(status.Extra)
+		slices.Sort(status.Different)
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Repair makes every reachable replica hold the same secrets as the primary:
+// missing secrets are created, different ones updated and extra ones
+// deleted. Metadata is copied along where both stores keep it. It returns
+// the differences found before the repair.
+func (s *MirrorStore) Repair() ([]ReplicaStatus, error) {
+	statuses, err := s.Status()
+	if err != nil {
+		return nil, err
+	}
+	primary := s.Members[0].Store
+
+	var errs []error
+	for i, status := range statuses {
+		if status.Error != "" || status.InSync() {
+			continue
+		}
+		replica := s.Members[i+1].Store
+		if err := repairReplica(primary, replica, status); err != nil {
+			errs = append(errs, fmt.Errorf("replica '%s': %w", status.Name, err))
+		}
+	}
+	return statuses, errors.Join(errs...)
+}
+
+// repairReplica applies the differences of status to replica.
+func repairReplica(primary, replica SecretStore, status ReplicaStatus) error {
+	for _, key := range slices.Concat(status.Missing, status.Different) {
+		value, err := primary.Read(key)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(status.Missing, key) {
+			err = replica.Create(key, value)
+		} else {
+			err = replica.Update(key, value)
+		}
+		if err != nil {
+			return err
+		}
+		if err := copyMirrorMetadata(primary, replica, key); err != nil {
+			return err
+		}
+	}
+	for _, key := range status.Extra {
+		if err := replica.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyMirrorMetadata copies the metadata of a secret from primary to replica
+// if both keep metadata, keeping the replica's version number.
+func copyMirrorMetadata(primary, replica SecretStore, key string) error {
+	src, ok := primary.(MetadataStore)
+	if !ok {
+		return nil
+	}
+	dst, ok := replica.(MetadataStore)
+	if !ok {
+		return nil
+	}
+	md, err := src.ReadMetadata(key)
+	if err != nil {
+		return err
+	}
+	current, err := dst.ReadMetadata(key)
+	if err != nil {
+		return err
+	}
+	md.Version = current.Version
+	return dst.WriteMetadata(key, md)
+}
+
+// readAll reads every secret of s.
+func readAll(s SecretStore) (map[string][]byte, error) {
+	keys, err := s.ListKeys()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, err := s.Read(key)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,144 @@
+package store_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"secrets-cli/internal/store"
+	"secrets-cli/internal/store/storetest"
+)
+
+// newTestMirror mirrors a memory store to another one.
+func newTestMirror(t *testing.T, primary, replica store.SecretStore) *store.MirrorStore {
+	t.Helper()
+	s, err := store.NewMirrorStore(store.MirrorMember{Name: "primary", Store: primary},
+		store.MirrorMember{Name: "replica", Store: replica})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestMirrorStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		return initStore(t, newTestMirror(t, store.NewMemoryStore(), store.NewMemoryStore()))
+	})
+}
+
+func TestMirrorStoreReadsFromReplica(t *testing.T) {
+	primary := &flakyStore{MemoryStore: store.NewMemoryStore()}
+	replica := store.NewMemoryStore()
+	s := newTestMirror(t, primary, replica)
+	var warnings bytes.Buffer
+	s.Warnings = &warnings
+	initStore(t, s)
+
+	if err := s.Create("db_password", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := replica.Read("db_password"); err != nil || string(value) != "v1" {
+		t.Fatalf("replica Read = %q, %v; want the mirrored v1", value, err)
+	}
+
+	primary.down = true
+	if value, err := s.Read("db_password"); err != nil || string(value) != "v1" {
+		t.Fatalf("Read with primary down = %q, %v; want v1 from the replica", value, err)
+	}
+	if warnings.Len() == 0 {
+		t.Error("failing over to the replica printed no warning")
+	}
+	if err := s.Update("db_password", []byte("v2")); err == nil {
+		t.Error("Update with primary down succeeded")
+	}
+}
+
+func TestMirrorStoreStatusAndRepair(t *testing.T) {
+	primary, replica := store.NewMemoryStore(), store.NewMemoryStore()
+	s := newTestMirror(t, primary, replica)
+	initStore(t, s)
+
+	for _, key := range []string{"same", "changed", "missing"} {
+		if err := s.Create(key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Diverge behind the mirror's back
+	replica.Delete("missing")
+	replica.Update("changed", []byte("stale"))
+	replica.Create("extra", []byte("extra"))
+
+	statuses, err := s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := statuses[0]
+	if st.InSync() || !slices.Equal(st.Missing, []string{"missing"}) ||
+		!slices.Equal(st.Different, []string{"changed"}) || !slices.Equal(st.Extra, []string{"extra"}) {
+		t.Fatalf("Status = %+v, want missing, changed and extra reported", st)
+	}
+
+	if _, err := s.Repair(); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	statuses, err = s.Status()
+	if err != nil || !statuses[0].InSync() {
+		t.Fatalf("Status after repair = %+v, %v; want in sync", statuses, err)
+	}
+	md, err := replica.ReadMetadata("missing")
+	if err != nil || md.CreatedAt.IsZero() {
+		t.Errorf("repaired secret metadata = %+v, %v; want copied metadata", md, err)
+	}
+}
+
+// plainStore hides the optional interfaces of the store it wraps.
+type plainStore struct {
+	store.SecretStore
+}
+
+func TestMirrorStoreForwardsToReplicas(t *testing.T) {
+	primary, replica, plain := store.NewMemoryStore(), store.NewMemoryStore(), store.NewMemoryStore()
+	s, err := store.NewMirrorStore(store.MirrorMember{Name: "primary", Store: primary},
+		store.MirrorMember{Name: "replica", Store: replica}, store.MirrorMember{Name: "plain", Store: plainStore{plain}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	initStore(t, s)
+
+	err = s.ApplyBatch([]store.BatchOp{
+		{Kind: store.BatchCreate, Key: "db", Value: []byte("v1")},
+		{Kind: store.BatchCreate, Key: "token", Value: []byte("t1")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+	if err := s.CompareAndSwap("db", 1, []byte("v2")); err != nil {
+		t.Fatalf("CompareAndSwap failed: %v", err)
+	}
+	if err := s.Trash("token"); err != nil {
+		t.Fatalf("Trash failed: %v", err)
+	}
+	for _, m := range []store.SecretStore{primary, replica, plain} {
+		if value, err := m.Read("db"); err != nil || string(value) != "v2" {
+			t.Fatalf("member Read(db) = %q, %v, want v2", value, err)
+		}
+		if _, err := m.Read("token"); err == nil {
+			t.Fatal("trashed secret still readable in a member")
+		}
+	}
+	if trashed, err := replica.ListTrash(); err != nil || len(trashed) != 1 {
+		t.Fatalf("replica ListTrash = %+v, %v, want the trashed secret", trashed, err)
+	}
+
+	if err := s.Restore("token"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	for _, m := range []store.SecretStore{primary, replica, plain} {
+		if value, err := m.Read("token"); err != nil || string(value) != "t1" {
+			t.Fatalf("member Read(token) after restore = %q, %v, want t1", value, err)
+		}
+	}
+	if versions, err := s.ListVersions("db"); err != nil || len(versions) != 1 || versions[0].Version != 1 {
+		t.Fatalf("ListVersions = %+v, %v, want the primary's version 1", versions, err)
+	}
+}
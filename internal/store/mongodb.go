@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"time"
 )
 
 // MongoDBStore implements the SecretStore interface for MongoDB.
@@ -11,13 +12,14 @@ type MongoDBStore struct {
 	URI        string
 	Database   string
 	Collection string
+	Namespace  string // Namespace the store operates on, a field of every document
 }
 
 // NewMongoDBStore creates a new MongoDBStore instance.
 // Placeholder
 func NewMongoDBStore(uri, dbName, collectionName string) (*MongoDBStore, error) {
 	// Validate inputs
-	return &MongoDBStore{URI: uri, Database: dbName, Collection: collectionName}, nil
+	return &MongoDBStore{URI: uri, Database: dbName, Collection: collectionName, Namespace: DefaultNamespace}, nil
 }
 
 // Init connects to MongoDB and potentially ensures the collection exists.
@@ -70,3 +72,119 @@ func (s *MongoDBStore) ListKeys() ([]string, error) {
 	// Implement MongoDB find (projection) logic
 	return nil, fmt.Errorf("MongoDB backend is not fully implemented")
 }
+
+// ReadRevision retrieves an encrypted value and its revision from MongoDB.
+// Placeholder
+func (s *MongoDBStore) ReadRevision(key string) ([]byte, int64, error) {
+	// Implement MongoDB find (value, version projection) logic
+	return nil, 0, fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// CompareAndSwap updates a secret in MongoDB if it is still at
+// expectedRevision.
+// Placeholder
+func (s *MongoDBStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	// Implement MongoDB updateOne with filter {"key": key, "version": expectedRevision}
+	// and $inc on version; no matched document means a revision mismatch
+	return fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// CreateWithMetadata stores a new encrypted value with edited metadata in
+// MongoDB.
+// Placeholder
+func (s *MongoDBStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	// Implement MongoDB insert logic with the metadata fields of the edited
+	// newMetadata() in the same document
+	return fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// UpdateWithMetadata updates a secret and its metadata in MongoDB.
+// Placeholder
+func (s *MongoDBStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	// Implement like CompareAndSwap, setting the edited metadata fields in the
+	// same updateOne
+	return fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// ApplyBatch applies several changes in a MongoDB transaction.
+// Placeholder
+func (s *MongoDBStore) ApplyBatch(ops []BatchOp) error {
+	// Implement with a client session: session.WithTransaction running
+	// InsertOne/UpdateOne/DeleteOne per op, aborting on the first error
+	return fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// ListKeysWithPrefix lists the keys starting with prefix from MongoDB.
+// Placeholder
+func (s *MongoDBStore) ListKeysWithPrefix(prefix string) ([]string, error) {
+	// Implement MongoDB find with {"key": {"$regex": "^" + regexp.QuoteMeta(prefix)}}
+	return nil, fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// ReadMetadata retrieves the metadata of a secret from MongoDB.
+// Placeholder
+func (s *MongoDBStore) ReadMetadata(key string) (Metadata, error) {
+	// Implement MongoDB find (metadata fields) logic
+	return Metadata{}, fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// WriteMetadata replaces the metadata of a secret in MongoDB.
+// Placeholder
+func (s *MongoDBStore) WriteMetadata(key string, md Metadata) error {
+	// Implement MongoDB update (metadata fields except version) logic
+	return fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// ListVersions lists the previous versions of a secret from MongoDB.
+// Placeholder
+func (s *MongoDBStore) ListVersions(key string) ([]SecretVersion, error) {
+	// Implement MongoDB find (history) logic
+	return nil, fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// ReadVersion retrieves one version of a secret from MongoDB.
+// Placeholder
+func (s *MongoDBStore) ReadVersion(key string, version int64) ([]byte, error) {
+	// Implement MongoDB find (history) logic
+	return nil, fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// Trash moves a secret to the trash collection in MongoDB.
+// Placeholder
+func (s *MongoDBStore) Trash(key string) error {
+	// Implement MongoDB move (trash collection) logic
+	return fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// ListTrash lists the trashed secrets from MongoDB.
+// Placeholder
+func (s *MongoDBStore) ListTrash() ([]TrashedSecret, error) {
+	// Implement MongoDB find (trash collection) logic
+	return nil, fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// Restore moves a secret out of the trash collection in MongoDB.
+// Placeholder
+func (s *MongoDBStore) Restore(key string) error {
+	// Implement MongoDB move (trash collection) logic
+	return fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// Purge removes old secrets from the trash collection in MongoDB.
+// Placeholder
+func (s *MongoDBStore) Purge(before time.Time) ([]string, error) {
+	// Implement MongoDB delete (trash collection) logic
+	return nil, fmt.Errorf("MongoDB backend is not fully implemented")
+}
+
+// setNamespace selects the namespace the store operates on.
+func (s *MongoDBStore) setNamespace(ns string) {
+	s.Namespace = ns
+}
+
+// ListNamespaces lists the namespaces stored in MongoDB.
+// Placeholder
+func (s *MongoDBStore) ListNamespaces() ([]string, error) {
+	// Implement MongoDB distinct (namespace) logic
+	return nil, fmt.Errorf("MongoDB backend is not fully implemented")
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// DefaultNamespace is the namespace used when none is selected. It holds the
+// secrets of stores written before namespaces were introduced.
+const DefaultNamespace = "default"
+
+// namespacePattern restricts namespace names so that they can be embedded in
+// bucket names, directory names and JSON keys without escaping.
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// NamespacedStore is implemented by backends that partition secrets into
+// namespaces. Every SecretStore operation of such a store only sees the keys
+// of its selected namespace, so the same key can exist in several namespaces.
+type NamespacedStore interface {
+	SecretStore
+
+	// ListNamespaces returns the namespaces that contain secrets, always
+	// including DefaultNamespace.
+	ListNamespaces() ([]string, error)
+}
+
+// namespaceSelector is implemented by backends whose namespace can be
+// selected by GetSecretStore.
+type namespaceSelector interface {
+	setNamespace(ns string)
+}
+
+// AsNamespacedStore returns s as a NamespacedStore, or an error wrapping
+// ErrNotSupported if the backend doesn't support namespaces.
+func AsNamespacedStore(s SecretStore) (NamespacedStore, error) {
+	ns, ok := s.(NamespacedStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s does not support namespaces", ErrNotSupported, describeStore(s))
+	}
+	return ns, nil
+}
+
+// selectedNamespace returns the namespace selected by --namespace or the
+// config file.
+func selectedNamespace() string {
+	if Namespace == "" {
+		return DefaultNamespace
+	}
+	return Namespace
+}
+
+// ValidateNamespace rejects namespace names that can't be stored by every
+// backend.
+func ValidateNamespace(ns string) error {
+	if !namespacePattern.MatchString(ns) {
+		return fmt.Errorf("%w: invalid namespace '%s' (use letters, digits, '.', '_' and '-')", ErrInvalidConfiguration, ns)
+	}
+	return nil
+}
+
+// namespaceList returns DefaultNamespace followed by the other names, sorted
+// and without duplicates.
+func namespaceList(names []string) []string {
+	namespaces := []string{DefaultNamespace}
+	seen := map[string]bool{DefaultNamespace: true}
+	for _, ns := range names {
+		if !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces[1:])
+	return namespaces
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestNamespacesIsolated opens two stores on the same storage, one per
+// namespace, and checks that neither sees the other's secrets.
+func TestNamespacesIsolated(t *testing.T) {
+	// Each backend returns a function opening a new store on the same
+	// storage.
+	backends := []struct {
+		name  string
+		setup func(t *testing.T) func() SecretStore
+	}{
+		{"memory", func(t *testing.T) func() SecretStore {
+			shared := NewMemoryStore()
+			return func() SecretStore { return shared.Clone() }
+		}},
+		{"jsonfile", func(t *testing.T) func() SecretStore {
+			path := filepath.Join(t.TempDir(), "secrets.json")
+			return func() SecretStore {
+				s, err := NewJSONFileStore(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s
+			}
+		}},
+		{"sqlite", func(t *testing.T) func() SecretStore {
+			path := filepath.Join(t.TempDir(), "secrets.db")
+			return func() SecretStore {
+				s, err := NewSQLiteStore(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s
+			}
+		}},
+		{"bolt", func(t *testing.T) func() SecretStore {
+			path := filepath.Join(t.TempDir(), "secrets.bolt")
+			return func() SecretStore {
+				s, err := NewBoltStore(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s
+			}
+		}},
+		{"dir", func(t *testing.T) func() SecretStore {
+			root := filepath.Join(t.TempDir(), "secrets")
+			return func() SecretStore {
+				s, err := NewDirStore(root)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s
+			}
+		}},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			open := backend.setup(t)
+			// Opens a store in namespace ns; bolt allows a single open handle
+			// per file, so every step closes its store again.
+			use := func(ns string, fn func(s NamespacedStore)) {
+				t.Helper()
+				s := open()
+				s.(namespaceSelector).setNamespace(ns)
+				if err := s.Init(); err != nil {
+					t.Fatalf("Init in namespace '%s' failed: %v", ns, err)
+				}
+				defer s.Close()
+				fn(s.(NamespacedStore))
+			}
+
+			use(DefaultNamespace, func(s NamespacedStore) {
+				if err := s.Create("db_password", []byte("default")); err != nil {
+					t.Fatal(err)
+				}
+			})
+			use("payments", func(s NamespacedStore) {
+				if _, err := s.Read("db_password"); !errors.Is(err, ErrSecretNotFound) {
+					t.Fatalf("Read of other namespace's key = %v, want ErrSecretNotFound", err)
+				}
+				if err := s.Create("db_password", []byte("payments")); err != nil {
+					t.Fatalf("Create of same key in other namespace failed: %v", err)
+				}
+				if err := s.Create("stripe_key", []byte("sk")); err != nil {
+					t.Fatal(err)
+				}
+			})
+			use(DefaultNamespace, func(s NamespacedStore) {
+				if value, err := s.Read("db_password"); err != nil || string(value) != "default" {
+					t.Fatalf("Read in default namespace = %q, %v", value, err)
+				}
+				if keys, err := s.ListKeys(); err != nil || !slices.Equal(keys, []string{"db_password"}) {
+					t.Fatalf("ListKeys in default namespace = %v, %v", keys, err)
+				}
+				if err := s.Delete("stripe_key"); !errors.Is(err, ErrSecretNotFound) {
+					t.Fatalf("Delete of other namespace's key = %v, want ErrSecretNotFound", err)
+				}
+			})
+			use("empty", func(s NamespacedStore) {
+				if keys, err := s.ListKeys(); err != nil || len(keys) != 0 {
+					t.Fatalf("ListKeys in empty namespace = %v, %v", keys, err)
+				}
+			})
+			use("payments", func(s NamespacedStore) {
+				keys, err := s.ListKeys()
+				slices.Sort(keys)
+				if err != nil || !slices.Equal(keys, []string{"db_password", "stripe_key"}) {
+					t.Fatalf("ListKeys in namespace payments = %v, %v", keys, err)
+				}
+				if value, err := s.Read("db_password"); err != nil || string(value) != "payments" {
+					t.Fatalf("Read in namespace payments = %q, %v", value, err)
+				}
+				namespaces, err := s.ListNamespaces()
+				if err != nil || !slices.Equal(namespaces, []string{DefaultNamespace, "payments"}) {
+					t.Fatalf("ListNamespaces = %v, %v", namespaces, err)
+				}
+			})
+		})
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	for _, ns := range []string{"default", "payments", "team-a", "v1.2", "A_b"} {
+		if err := ValidateNamespace(ns); err != nil {
+			t.Errorf("ValidateNamespace(%q) = %v, want nil", ns, err)
+		}
+	}
+	for _, ns := range []string{"", ".hidden", "a/b", "-flag", "with space"} {
+		if err := ValidateNamespace(ns); !errors.Is(err, ErrInvalidConfiguration) {
+			t.Errorf("ValidateNamespace(%q) = %v, want ErrInvalidConfiguration", ns, err)
+		}
+	}
+}
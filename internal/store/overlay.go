@@ -0,0 +1,230 @@
+package store
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrInheritedSecret is returned when deleting a secret that the target layer
+// of an overlay only inherits from another layer.
+var ErrInheritedSecret = fmt.Errorf("secret is inherited from another layer")
+
+// OverlayLayerConfig is one layer of an overlay in the config file.
+type OverlayLayerConfig struct {
+	Name      string `json:"name"`
+	Store     string `json:"store,omitempty"`     // <backend>:<location>; the configured store if empty
+	Namespace string `json:"namespace,omitempty"` // The selected namespace if empty
+}
+
+// OverlayLayer is one store of an OverlayStore.
+type OverlayLayer struct {
+	Name  string
+	Store SecretStore
+}
+
+// OverlayStore resolves secrets through an ordered list of layers, such as
+// base, staging and prod, where a secret in a later layer overrides the same
+// key in the earlier ones. Changes go to the target layer: updating a key
+// inherited from an earlier layer creates an override in the target layer.
+type OverlayStore struct {
+	Layers []OverlayLayer // Lowest priority first
+	Target int            // Index of the layer changes go to
+}
+
+// NewOverlayStore stacks layers, lowest priority first, with changes going
+// to the layer named target, or to the last layer if target is empty.
+func NewOverlayStore(layers []OverlayLayer, target string) (*OverlayStore, error) {
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("%w: overlay needs at least one layer", ErrInvalidConfiguration)
+	}
+	s := &OverlayStore{Layers: layers, Target: len(layers) - 1}
+	if target != "" {
+		s.Target = slices.IndexFunc(layers, func(l OverlayLayer) bool { return l.Name == target })
+		if s.Target < 0 {
+			return nil, fmt.Errorf("%w: overlay has no layer '%s'", ErrInvalidConfiguration, target)
+		}
+	}
+	return s, nil
+}
+
+// AsOverlayStore returns s as an OverlayStore, or an error if no overlay is
+// selected.
+func AsOverlayStore(s SecretStore) (*OverlayStore, error) {
+	ovl, ok := s.(*OverlayStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: no overlay selected", ErrInvalidConfiguration)
+	}
+	return ovl, nil
+}
+
+// newOverlay creates the layers of the overlay called name in the config
+// file, not yet initialized.
+func newOverlay(name string) (SecretStore, error) {
+	configs, ok := Overlays[name]
+	if !ok || len(configs) == 0 {
+		return nil, fmt.Errorf("%w: no overlay '%s' in the config file", ErrInvalidConfiguration, name)
+	}
+
+	layers := make([]OverlayLayer, 0, len(configs))
+	for _, lc := range configs {
+		if lc.Name == "" {
+			return nil, fmt.Errorf("%w: layer of overlay '%s' has no name", ErrInvalidConfiguration, name)
+		}
+		if slices.ContainsFunc(layers, func(l OverlayLayer) bool { return l.Name == lc.Name }) {
+			return nil, fmt.Errorf("%w: overlay '%s' has two layers named '%s'", ErrInvalidConfiguration, name, lc.Name)
+		}
+		backend, location := BackendType, ""
+		if lc.Store != "" {
+			var err error
+			if backend, location, err = parseStoreSpec(lc.Store); err != nil {
+				return nil, fmt.Errorf("layer '%s': %w", lc.Name, err)
+			}
+		}
+		s, err := newStore(backend, location, cmp.Or(lc.Namespace, selectedNamespace()), lc.Store == "")
+		if err != nil {
+			return nil, fmt.Errorf("layer '%s': %w", lc.Name, err)
+		}
+		layers = append(layers, OverlayLayer{Name: lc.Name, Store: s})
+	}
+	return NewOverlayStore(layers, OverlayLayerName)
+}
+
+// Init initializes all layers.
+func (s *OverlayStore) Init() error {
+	for i, l := range s.Layers {
+		if err := l.Store.Init(); err != nil {
+			for _, initialized := range s.Layers[:i] {
+				initialized.Store.Close()
+			}
+			return fmt.Errorf("layer '%s': %w", l.Name, err)
+		}
+	}
+	return nil
+}
+
+// Close closes all layers.
+func (s *OverlayStore) Close() error {
+	var errs []error
+	for _, l := range s.Layers {
+		if err := l.Store.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("layer '%s': %w", l.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// target returns the layer changes go to.
+func (s *OverlayStore) target() SecretStore {
+	return s.Layers[s.Target].Store
+}
+
+// resolve returns the index of the highest priority layer holding key.
+func (s *OverlayStore) resolve(key string) (int, error) {
+	for i := len(s.Layers) - 1; i >= 0; i-- {
+		_, err := s.Layers[i].Store.Read(key)
+		if err == nil {
+			return i, nil
+		}
+		if !errors.Is(err, ErrSecretNotFound) {
+			return -1, fmt.Errorf("layer '%s': %w", s.Layers[i].Name, err)
+		}
+	}
+	return -1, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+}
+
+// Source returns the name of the layer key is read from.
+func (s *OverlayStore) Source(key string) (string, error) {
+	i, err := s.resolve(key)
+	if err != nil {
+		return "", err
+	}
+	return s.Layers[i].Name, nil
+}
+
+// Create stores a new encrypted value in the target layer. The key may exist
+// in other layers.
+func (s *OverlayStore) Create(key string, encryptedValue []byte) error {
+	return s.target().Create(key, encryptedValue)
+}
+
+// Read retrieves the encrypted value of the highest priority layer holding
+// key.
+func (s *OverlayStore) Read(key string) ([]byte, error) {
+	for i := len(s.Layers) - 1; i >= 0; i-- {
+		value, err := s.Layers[i].Store.Read(key)
+		if !errors.Is(err, ErrSecretNotFound) {
+			return value, err
+		}
+	}
+	return nil, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+}
+
+// Update updates the encrypted value of key in the target layer, creating an
+// override there if the key is only inherited from another layer.
+func (s *OverlayStore) Update(key string, encryptedValue []byte) error {
+	err := s.target().Update(key, encryptedValue)
+	if !errors.Is(err, ErrSecretNotFound) {
+		return err
+	}
+	if _, resolveErr := s.resolve(key); resolveErr != nil {
+		return err
+	}
+	return s.target().Create(key, encryptedValue)
+}
+
+// Delete removes key from the target layer. A key only inherited from
+// another layer must be deleted there.
+func (s *OverlayStore) Delete(key string) error {
+	err := s.target().Delete(key)
+	if !errors.Is(err, ErrSecretNotFound) {
+		return err
+	}
+	if i, resolveErr := s.resolve(key); resolveErr == nil {
+		return fmt.Errorf("%w: secret '%s' is inherited from layer '%s'; select that layer to delete it",
+			ErrInheritedSecret, key, s.Layers[i].Name)
+	}
+	return err
+}
+
+// ListKeys lists the keys of all layers.
+func (s *OverlayStore) ListKeys() ([]string, error) {
+	return s.ListKeysWithPrefix("")
+}
+
+// ListKeysWithPrefix lists the keys starting with prefix of all layers.
+func (s *OverlayStore) ListKeysWithPrefix(prefix string) ([]string, error) {
+	var keys []string
+	for _, l := range s.Layers {
+		layerKeys, err := ListKeysWithPrefix(l.Store, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("layer '%s': %w", l.Name, err)
+		}
+		keys = append(keys, layerKeys...)
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+// ReadMetadata returns the metadata of key from the layer it is read from.
+func (s *OverlayStore) ReadMetadata(key string) (Metadata, error) {
+	i, err := s.resolve(key)
+	if err != nil {
+		return Metadata{}, err
+	}
+	ms, err := AsMetadataStore(s.Layers[i].Store)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return ms.ReadMetadata(key)
+}
+
+// WriteMetadata replaces the metadata of key in the target layer.
+func (s *OverlayStore) WriteMetadata(key string, md Metadata) error {
+	ms, err := AsMetadataStore(s.target())
+	if err != nil {
+		return err
+	}
+	return ms.WriteMetadata(key, md)
+}
@@ -0,0 +1,144 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"secrets-cli/internal/store"
+	"secrets-cli/internal/store/storetest"
+)
+
+// newTestOverlay stacks memory stores named base, staging and prod.
+func newTestOverlay(t *testing.T, target string) (*store.OverlayStore, map[string]store.SecretStore) {
+	t.Helper()
+	layers := make(map[string]store.SecretStore)
+	var stack []store.OverlayLayer
+	for _, name := range []string{"base", "staging", "prod"} {
+		layers[name] = store.NewMemoryStore()
+		stack = append(stack, store.OverlayLayer{Name: name, Store: layers[name]})
+	}
+	s, err := store.NewOverlayStore(stack, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initStore(t, s)
+	return s, layers
+}
+
+func TestOverlayStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		s, _ := newTestOverlay(t, "")
+		return s
+	})
+}
+
+func TestOverlayStoreLayers(t *testing.T) {
+	s, layers := newTestOverlay(t, "")
+	layers["base"].Create("db_host", []byte("base-host"))
+	layers["base"].Create("db_password", []byte("base-password"))
+	layers["staging"].Create("db_password", []byte("staging-password"))
+
+	for key, want := range map[string]string{"db_host": "base", "db_password": "staging"} {
+		if source, err := s.Source(key); err != nil || source != want {
+			t.Errorf("Source(%q) = %q, %v; want %q", key, source, err, want)
+		}
+	}
+	if value, err := s.Read("db_password"); err != nil || string(value) != "staging-password" {
+		t.Errorf("Read = %q, %v; want the staging override", value, err)
+	}
+	if keys, err := s.ListKeys(); err != nil || !slices.Equal(keys, []string{"db_host", "db_password"}) {
+		t.Errorf("ListKeys = %q, %v; want the keys of all layers once", keys, err)
+	}
+
+	// Updating an inherited key overrides it in the target layer
+	if err := s.Update("db_host", []byte("prod-host")); err != nil {
+		t.Fatalf("Update of inherited key failed: %v", err)
+	}
+	if value, _ := layers["base"].Read("db_host"); string(value) != "base-host" {
+		t.Errorf("base layer changed to %q by an update in prod", value)
+	}
+	if source, _ := s.Source("db_host"); source != "prod" {
+		t.Errorf("Source after override = %q, want prod", source)
+	}
+
+	if err := s.Delete("db_password"); !errors.Is(err, store.ErrInheritedSecret) {
+		t.Errorf("Delete of inherited key = %v, want ErrInheritedSecret", err)
+	}
+	if err := s.Update("missing", []byte("x")); !errors.Is(err, store.ErrSecretNotFound) {
+		t.Errorf("Update of missing key = %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestOverlayStoreTarget(t *testing.T) {
+	s, layers := newTestOverlay(t, "base")
+	if err := s.Create("api_url", []byte("url")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := layers["base"].Read("api_url"); err != nil {
+		t.Errorf("Create with target base did not write to base: %v", err)
+	}
+	if _, err := store.NewOverlayStore(s.Layers, "qa"); !errors.Is(err, store.ErrInvalidConfiguration) {
+		t.Errorf("unknown target layer = %v, want ErrInvalidConfiguration", err)
+	}
+}
+
+func TestOverlayStoreNotSupported(t *testing.T) {
+	s, _ := newTestOverlay(t, "")
+	// The memory layers have a trash, the overlay doesn't
+	_, err := store.AsTrashStore(s)
+	if !errors.Is(err, store.ErrNotSupported) || !strings.Contains(err.Error(), "the overlay") {
+		t.Fatalf("AsTrashStore of an overlay = %v, want ErrNotSupported naming the overlay", err)
+	}
+}
+
+func TestOverlayStoreBoltNamespaces(t *testing.T) {
+	previousBackend, previousPath, previousOverlay := store.BackendType, store.BoltDBPath, store.Overlay
+	previousOverlays := store.Overlays
+	t.Cleanup(func() {
+		store.BackendType, store.BoltDBPath, store.Overlay = previousBackend, previousPath, previousOverlay
+		store.Overlays = previousOverlays
+	})
+	// Both layers are namespaces of the same bolt file
+	store.BackendType, store.BoltDBPath = "bolt", filepath.Join(t.TempDir(), "secrets.bolt")
+	store.Overlay = "env"
+	store.Overlays = map[string][]store.OverlayLayerConfig{
+		"env": {{Name: "base", Namespace: "base"}, {Name: "prod", Namespace: "prod"}},
+	}
+
+	s, err := store.GetSecretStore()
+	if err != nil {
+		t.Fatalf("opening a bolt overlay failed: %v", err)
+	}
+	ov, err := store.AsOverlayStore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ov.Layers[0].Store.Create("db_host", []byte("base-host")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("db_password", []byte("prod-password")); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := s.ListKeys(); err != nil || !slices.Equal(keys, []string{"db_host", "db_password"}) {
+		t.Errorf("ListKeys = %q, %v; want the keys of both namespaces", keys, err)
+	}
+	if _, err := ov.Layers[0].Store.Read("db_password"); !errors.Is(err, store.ErrSecretNotFound) {
+		t.Errorf("Read of prod secret in base = %v, want ErrSecretNotFound", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The file is released with the last layer
+	s, err = store.GetSecretStore()
+	if err != nil {
+		t.Fatalf("reopening the bolt overlay failed: %v", err)
+	}
+	if value, err := s.Read("db_host"); err != nil || string(value) != "base-host" {
+		t.Errorf("Read after reopening = %q, %v", value, err)
+	}
+	s.Close()
+}
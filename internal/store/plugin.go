@@ -0,0 +1,350 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// PluginPrefix is the prefix of plugin executables: --backend NAME runs
+// secrets-cli-backend-NAME from PATH unless NAME is registered.
+const PluginPrefix = "secrets-cli-backend-"
+
+// The plugin protocol is JSON-RPC 2.0 over the plugin's stdin and stdout,
+// one JSON object per line. The methods are named after the SecretStore
+// methods and take pluginParams; values travel base64 encoded. "Init" is
+// the first call and "Close" the last, after which the plugin exits.
+//
+//	-> {"jsonrpc":"2.0","id":1,"method":"Init","params":{"location":"https://vault","namespace":"default"}}
+//	<- {"jsonrpc":"2.0","id":1,"result":{}}
+//	-> {"jsonrpc":"2.0","id":2,"method":"Read","params":{"key":"db_password"}}
+//	<- {"jsonrpc":"2.0","id":2,"error":{"code":-32001,"message":"secret not found: secret with key 'db_password'"}}
+
+// pluginRequest is a JSON-RPC request to a plugin.
+type pluginRequest struct {
+	JSONRPC string       `json:"jsonrpc"`
+	ID      int64        `json:"id"`
+	Method  string       `json:"method"`
+	Params  pluginParams `json:"params"`
+}
+
+// pluginParams are the parameters of all plugin methods; each method uses
+// the fields it needs.
+type pluginParams struct {
+	Location  string `json:"location,omitempty"`  // Init
+	Namespace string `json:"namespace,omitempty"` // Init
+	Key       string `json:"key,omitempty"`
+	Value     []byte `json:"value,omitempty"`
+}
+
+// pluginResponse is a JSON-RPC response from a plugin.
+type pluginResponse struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Result  *pluginResult `json:"result,omitempty"`
+	Error   *pluginError  `json:"error,omitempty"`
+}
+
+// pluginResult is the result of all plugin methods.
+type pluginResult struct {
+	Value []byte   `json:"value,omitempty"` // Read
+	Keys  []string `json:"keys,omitempty"`  // ListKeys
+}
+
+// pluginErrorCodes map the store's errors to JSON-RPC error codes, from the
+// range reserved for implementation-defined errors.
+var pluginErrorCodes = map[int]error{
+	-32001: ErrSecretNotFound,
+	-32002: ErrSecretAlreadyExists,
+	-32003: ErrInvalidKey,
+	-32004: ErrInvalidConfiguration,
+	-32005: ErrNotSupported,
+}
+
+// pluginErrorGeneric is the code of errors without a mapping.
+const pluginErrorGeneric = -32000
+
+// pluginError is a JSON-RPC error. It unwraps to the store error of its code,
+// so errors.Is works across the process boundary.
+type pluginError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *pluginError) Error() string {
+	return e.Message
+}
+
+func (e *pluginError) Unwrap() error {
+	return pluginErrorCodes[e.Code]
+}
+
+// newPluginError returns the JSON-RPC error for err.
+func newPluginError(err error) *pluginError {
+	for code, target := range pluginErrorCodes {
+		if errors.Is(err, target) {
+			return &pluginError{Code: code, Message: err.Error()}
+		}
+	}
+	return &pluginError{Code: pluginErrorGeneric, Message: err.Error()}
+}
+
+// PluginStore implements the SecretStore interface by running a plugin
+// executable and calling it over JSON-RPC. The plugin is started by Init and
+// stopped by Close; calls are sent one at a time. The plugin is killed when
+// the context bound to the store is done.
+type PluginStore struct {
+	Executable string
+	Location   string // Passed to the plugin, e.g. a URL or a path
+	Namespace  string // Namespace the store operates on
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	reader *bufio.Reader
+	nextID int64
+	contextBinding
+}
+
+// NewPluginStore creates a new PluginStore instance for the plugin at
+// executable.
+func NewPluginStore(executable, location string) (*PluginStore, error) {
+	if executable == "" {
+		return nil, fmt.Errorf("%w: plugin executable cannot be empty", ErrInvalidConfiguration)
+	}
+	return &PluginStore{Executable: executable, Location: location, Namespace: DefaultNamespace}, nil
+}
+
+// setNamespace selects the namespace the store operates on. The plugin
+// learns it from Init.
+func (s *PluginStore) setNamespace(ns string) {
+	s.Namespace = ns
+}
+
+// Init starts the plugin and initializes it with the location and namespace.
+func (s *PluginStore) Init() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd := exec.CommandContext(s.ctx(), s.Executable)
+	cmd.Stderr = os.Stderr // Plugin diagnostics go to the user
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start plugin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start plugin: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start plugin: %w", err)
+	}
+	s.cmd, s.stdin, s.reader = cmd, stdin, bufio.NewReader(stdout)
+
+	if _, err := s.call("Init", pluginParams{Location: s.Location, Namespace: s.Namespace}); err != nil {
+		s.stop()
+		return err
+	}
+	return nil
+}
+
+// Close tells the plugin to close its store and waits for it to exit.
+func (s *PluginStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cmd == nil {
+		return nil
+	}
+	var err error
+	if s.ctx().Err() == nil { // Otherwise the plugin was killed
+		_, err = s.call("Close", pluginParams{})
+	}
+	if stopErr := s.stop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// stop closes the plugin's stdin and waits for it to exit, or to be killed.
+// The caller must hold s.mu.
+func (s *PluginStore) stop() error {
+	s.stdin.Close()
+	err := s.cmd.Wait()
+	s.cmd = nil
+	if err != nil && s.ctx().Err() == nil {
+		return fmt.Errorf("plugin failed: %w", err)
+	}
+	return nil
+}
+
+// call sends a request to the plugin and reads its response. The caller must
+// hold s.mu.
+func (s *PluginStore) call(method string, params pluginParams) (*pluginResult, error) {
+	if s.cmd == nil {
+		return nil, fmt.Errorf("plugin %s is not running", s.Executable)
+	}
+	if err := s.ctx().Err(); err != nil {
+		return nil, fmt.Errorf("plugin call %s canceled: %w", method, err)
+	}
+
+	s.nextID++
+	request, err := json.Marshal(pluginRequest{JSONRPC: "2.0", ID: s.nextID, Method: method, Params: params})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plugin request: %w", err)
+	}
+	if _, err := s.stdin.Write(append(request, '\n')); err != nil && s.ctx().Err() != nil {
+		return nil, fmt.Errorf("plugin killed before %s: %w", method, s.ctx().Err())
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to send %s to plugin: %w", method, err)
+	}
+
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil && s.ctx().Err() != nil {
+		return nil, fmt.Errorf("plugin killed during %s: %w", method, s.ctx().Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin response to %s: %w", method, err)
+	}
+	var response pluginResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return nil, fmt.Errorf("invalid plugin response to %s: %w", method, err)
+	}
+	if response.ID != s.nextID {
+		return nil, fmt.Errorf("invalid plugin response to %s: id %d, want %d", method, response.ID, s.nextID)
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	if response.Result == nil {
+		return &pluginResult{}, nil
+	}
+	return response.Result, nil
+}
+
+// do calls a plugin method while holding s.mu.
+func (s *PluginStore) do(method string, params pluginParams) (*pluginResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.call(method, params)
+}
+
+// Create stores a new encrypted value through the plugin.
+func (s *PluginStore) Create(key string, encryptedValue []byte) error {
+	_, err := s.do("Create", pluginParams{Key: key, Value: encryptedValue})
+	return err
+}
+
+// Read retrieves an encrypted value through the plugin.
+func (s *PluginStore) Read(key string) ([]byte, error) {
+	result, err := s.do("Read", pluginParams{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return result.Value, nil
+}
+
+// Update updates an existing encrypted value through the plugin.
+func (s *PluginStore) Update(key string, encryptedValue []byte) error {
+	_, err := s.do("Update", pluginParams{Key: key, Value: encryptedValue})
+	return err
+}
+
+// Delete removes a secret through the plugin.
+func (s *PluginStore) Delete(key string) error {
+	_, err := s.do("Delete", pluginParams{Key: key})
+	return err
+}
+
+// ListKeys lists all available keys through the plugin.
+func (s *PluginStore) ListKeys() ([]string, error) {
+	result, err := s.do("ListKeys", pluginParams{})
+	if err != nil {
+		return nil, err
+	}
+	return result.Keys, nil
+}
+
+// ServePlugin implements the plugin side of the protocol for the store
+// returned by open, reading requests from r and writing responses to w until
+// Close or the end of r. open receives the location passed to Init.
+func ServePlugin(open func(location string) (SecretStore, error), r io.Reader, w io.Writer) error {
+	decoder := json.NewDecoder(r)
+	encoder := json.NewEncoder(w) // Writes one object per line
+	var s SecretStore
+
+	for {
+		var request pluginRequest
+		if err := decoder.Decode(&request); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			if s != nil {
+				s.Close()
+			}
+			return err
+		}
+
+		result, err := servePluginRequest(open, &s, request)
+		response := pluginResponse{JSONRPC: "2.0", ID: request.ID, Result: result}
+		if err != nil {
+			response.Result, response.Error = nil, newPluginError(err)
+		}
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+		if request.Method == "Close" {
+			return nil
+		}
+	}
+}
+
+// servePluginRequest runs one request against *s, which Init sets.
+func servePluginRequest(open func(location string) (SecretStore, error), s *SecretStore, request pluginRequest) (*pluginResult, error) {
+	p := request.Params
+	if request.Method == "Init" {
+		store, err := open(p.Location)
+		if err != nil {
+			return nil, err
+		}
+		if nsel, ok := store.(namespaceSelector); ok {
+			nsel.setNamespace(p.Namespace)
+		} else if p.Namespace != "" && p.Namespace != DefaultNamespace {
+			return nil, fmt.Errorf("%w: plugin does not support namespaces", ErrNotSupported)
+		}
+		if err := store.Init(); err != nil {
+			return nil, err
+		}
+		*s = store
+		return &pluginResult{}, nil
+	}
+	if *s == nil {
+		return nil, fmt.Errorf("%s called before Init", request.Method)
+	}
+
+	switch request.Method {
+	case "Close":
+		err := (*s).Close()
+		*s = nil
+		return &pluginResult{}, err
+	case "Create":
+		return &pluginResult{}, (*s).Create(p.Key, p.Value)
+	case "Read":
+		value, err := (*s).Read(p.Key)
+		return &pluginResult{Value: value}, err
+	case "Update":
+		return &pluginResult{}, (*s).Update(p.Key, p.Value)
+	case "Delete":
+		return &pluginResult{}, (*s).Delete(p.Key)
+	case "ListKeys":
+		keys, err := (*s).ListKeys()
+		return &pluginResult{Keys: keys}, err
+	default:
+		return nil, fmt.Errorf("%w: unknown method '%s'", ErrNotSupported, request.Method)
+	}
+}
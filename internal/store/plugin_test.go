@@ -0,0 +1,74 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"secrets-cli/internal/store"
+	"secrets-cli/internal/store/storetest"
+)
+
+// TestMain lets the test binary act as a plugin serving a memory store, so
+// the plugin tests can run it as their plugin executable.
+func TestMain(m *testing.M) {
+	if os.Getenv("SECRETS_CLI_TEST_PLUGIN") == "1" {
+		err := store.ServePlugin(func(location string) (store.SecretStore, error) {
+			switch location {
+			case "broken":
+				return nil, store.ErrInvalidConfiguration
+			case "hang":
+				return hangingStore{store.NewMemoryStore()}, nil
+			}
+			return store.NewMemoryStore(), nil
+		}, os.Stdin, os.Stdout)
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// hangingStore is a store whose reads never return.
+type hangingStore struct {
+	*store.MemoryStore
+}
+
+func (hangingStore) Read(key string) ([]byte, error) {
+	select {}
+}
+
+// newTestPlugin returns a PluginStore running the test binary as its plugin.
+func newTestPlugin(t *testing.T, location string) *store.PluginStore {
+	t.Helper()
+	t.Setenv("SECRETS_CLI_TEST_PLUGIN", "1")
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.NewPluginStore(executable, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPluginStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		return initStore(t, newTestPlugin(t, ""))
+	})
+}
+
+func TestPluginStoreInitError(t *testing.T) {
+	s := newTestPlugin(t, "broken")
+	if err := s.Init(); !errors.Is(err, store.ErrInvalidConfiguration) {
+		t.Fatalf("Init error = %v, want ErrInvalidConfiguration", err)
+	}
+	if _, err := s.ListKeys(); err == nil {
+		t.Fatal("ListKeys on a failed plugin succeeded")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close of a failed plugin = %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package store
+
+import "strings"
+
+// PrefixLister is implemented by backends that can list the keys starting
+// with a prefix without reading every key, such as an SQL query or a cursor
+// seek.
+type PrefixLister interface {
+	// ListKeysWithPrefix retrieves the keys that start with prefix. The
+	// comparison is case-sensitive and treats the prefix literally.
+	ListKeysWithPrefix(prefix string) ([]string, error)
+}
+
+// ListKeysWithPrefix returns the keys of s that start with prefix, letting the
+// backend do the filtering if it implements PrefixLister.
+func ListKeysWithPrefix(s SecretStore, prefix string) ([]string, error) {
+	if pl, ok := s.(PrefixLister); ok {
+		return pl.ListKeysWithPrefix(prefix)
+	}
+
+	keys, err := s.ListKeys()
+	if err != nil || prefix == "" {
+		return keys, err
+	}
+	var matching []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			matching = append(matching, key)
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+)
+
+// Factory creates a backend, not yet initialized. location is the path of
+// a store spec such as "sqlite:/tmp/secrets.db"; it is empty for the store
+// configured by the flags and the config file.
+type Factory func(location string) (SecretStore, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a backend available under name, for --backend and store
+// specs. It panics if name is registered twice, like database/sql.Register.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("store: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("store: Register called twice for backend " + name)
+	}
+	registry[name] = factory
+}
+
+// Backends returns the names of the registered backends, sorted. Plugin
+// backends are not included.
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// lookupBackend returns the factory of a registered backend or, failing
+// that, of the plugin executable secrets-cli-backend-<name> on PATH.
+func lookupBackend(name string) (Factory, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if ok {
+		return factory, nil
+	}
+
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown backend type: %s (no %s%s plugin on PATH)", name, PluginPrefix, name)
+	}
+	return func(location string) (SecretStore, error) {
+		return NewPluginStore(path, cmp.Or(location, BackendLocation))
+	}, nil
+}
+
+// configuredLocation returns the location the factory of backend uses when
+// it is given none.
+func configuredLocation(backend string) string {
+	switch backend {
+	case "sqlite":
+		return SqliteDBPath
+	case "jsonfile":
+		return JsonFilePath
+	case "bolt":
+		return BoltDBPath
+	case "dir":
+		return DirRoot
+	case "remote":
+		return RemoteURL
+	case "mongodb-placeholder":
+		return MongoURI
+	}
+	return BackendLocation // Plugins
+}
+
+func init() {
+	Register("sqlite", func(location string) (SecretStore, error) {
+		s, err := NewSQLiteStore(cmp.Or(location, SqliteDBPath))
+		if err != nil {
+			return nil, err
+		}
+		if SqliteTable != "" {
+			s.Table = SqliteTable
+		}
+		if SqliteBusyTimeout > 0 {
+			s.BusyTimeout = SqliteBusyTimeout
+		}
+		if SqliteJournalMode != "" {
+			s.JournalMode = SqliteJournalMode
+		}
+		// A sealed database stays sealed; without the encryption key Init
+		// fails
+		if FileEncryption || isSealedFile(s.DBPath) {
+			fileKey, _ := loadFileKey()
+			return NewSealedSQLiteStore(s, fileKey), nil
+		}
+		return s, nil
+	})
+	Register("jsonfile", func(location string) (SecretStore, error) {
+		s, err := NewJSONFileStore(cmp.Or(location, JsonFilePath))
+		if err != nil {
+			return nil, err
+		}
+		if LockTimeout > 0 {
+			s.LockTimeout = LockTimeout
+		}
+		switch JsonFormat {
+		case "", JSONFormatDocument:
+		case JSONFormatJournal:
+			s.Format = JSONFormatJournal
+		default:
+			return nil, fmt.Errorf("%w: invalid JSON format '%s' (expected document or journal)", ErrInvalidConfiguration, JsonFormat)
+		}
+		// Journal records are signed with a key derived from the encryption
+		// key; without it journals can be neither read nor written
+		if master, err := key.LoadKeyFromEnv(); err == nil {
+			if s.JournalKey, err = crypto.DeriveKey(master, journalKeyPurpose); err != nil {
+				return nil, err
+			}
+		}
+		s.Seal = FileEncryption
+		s.FileKey, _ = loadFileKey()
+		return s, nil
+	})
+	Register("bolt", func(location string) (SecretStore, error) {
+		return NewBoltStore(cmp.Or(location, BoltDBPath))
+	})
+	Register("dir", func(location string) (SecretStore, error) {
+		s, err := NewDirStore(cmp.Or(location, DirRoot))
+		if err != nil {
+			return nil, err
+		}
+		if LockTimeout > 0 {
+			s.LockTimeout = LockTimeout
+		}
+		return s, nil
+	})
+	Register("remote", func(location string) (SecretStore, error) {
+		s, err := NewRemoteStore(cmp.Or(location, RemoteURL))
+		if err != nil {
+			return nil, err
+		}
+		s.Token = os.Getenv(cmp.Or(RemoteTokenEnv, DefaultRemoteTokenEnv))
+		s.Retries = RemoteRetries
+		if s.TLS, err = RemoteTLSConfig(RemoteCA, RemoteCert, RemoteKey); err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+	Register("mongodb-placeholder", func(location string) (SecretStore, error) {
+		return NewMongoDBStore(cmp.Or(location, MongoURI), MongoDatabase, MongoCollection)
+	})
+}
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// The remote protocol is JSON over HTTPS, served by secrets-cli serve. The
+// secrets of a namespace live under /v1/namespaces/<ns>/secrets/<key>, with
+// the key path-escaped. Values are the ciphertext, base64 encoded: clients
+// encrypt and decrypt, so the server never sees a plaintext or the key.
+//
+//	GET    /v1/namespaces/default                     <- {}
+//	GET    /v1/namespaces/default/secrets             <- {"keys":["db_password"]}
+//	GET    /v1/namespaces/default/secrets/db_password <- {"value":"..."}
+//	POST   /v1/namespaces/default/secrets/db_password -> {"value":"..."} creates
+//	PUT    /v1/namespaces/default/secrets/db_password -> {"value":"..."} updates
+//	DELETE /v1/namespaces/default/secrets/db_password
+//
+// Errors come with an HTTP error status and a body such as
+// {"error":{"code":-32001,"message":"secret not found"}}, using the codes of
+// the plugin protocol so that errors.Is works across the network.
+
+const (
+	// DefaultRemoteRetries is how often a failed request is retried.
+	DefaultRemoteRetries = 3
+	// DefaultRemoteTokenEnv is the environment variable holding the bearer
+	// token of the remote backend and of serve.
+	DefaultRemoteTokenEnv = "SECRETS_REMOTE_TOKEN"
+)
+
+// remoteTimeout bounds every request of the remote backend.
+const remoteTimeout = 30 * time.Second
+
+// Delays between retries of the remote backend, doubling from the first.
+var (
+	remoteRetryDelay    = 200 * time.Millisecond
+	remoteMaxRetryDelay = 5 * time.Second
+)
+
+// remoteRequest is the body of POST and PUT requests.
+type remoteRequest struct {
+	Value []byte `json:"value"`
+}
+
+// remoteResponse is the body of all responses; each request uses the fields
+// it needs.
+type remoteResponse struct {
+	Value []byte       `json:"value,omitempty"`
+	Keys  []string     `json:"keys,omitempty"`
+	Error *pluginError `json:"error,omitempty"`
+}
+
+// RemoteStore implements the SecretStore interface against a secrets-cli
+// serve instance. Requests that fail on the way or find the server
+// unavailable are retried with exponential backoff, as long as retrying
+// can't apply a change twice. Requests and the waits between them give up
+// when the context bound to the store is done.
+type RemoteStore struct {
+	URL       string      // Base URL of the server, e.g. https://secrets:8443
+	Namespace string      // Namespace the store operates on
+	Token     string      // Bearer token, if the server requires one
+	Retries   int         // Retries of a failed request
+	TLS       *tls.Config // Server CA and client certificate; nil for the system roots
+
+	client *http.Client
+	contextBinding
+}
+
+// NewRemoteStore creates a new RemoteStore instance for the server at
+// baseURL, which must use HTTPS.
+func NewRemoteStore(baseURL string) (*RemoteStore, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("%w: remote URL cannot be empty", ErrInvalidConfiguration)
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid remote URL '%s' (expected https://host[:port])", ErrInvalidConfiguration, baseURL)
+	}
+	return &RemoteStore{
+		URL:       strings.TrimRight(baseURL, "/"),
+		Namespace: DefaultNamespace,
+		Retries:   DefaultRemoteRetries,
+	}, nil
+}
+
+// RemoteTLSConfig returns the TLS configuration of the remote backend. It
+// trusts the certificates in caFile, or the system roots if it is empty, and
+// presents the client certificate in certFile and keyFile if they are set.
+func RemoteTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to load client certificate: %v", ErrInvalidConfiguration, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// loadCertPool returns the PEM certificates in path as a pool.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read CA file: %v", ErrInvalidConfiguration, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w: no PEM certificates in '%s'", ErrInvalidConfiguration, path)
+	}
+	return pool, nil
+}
+
+// setNamespace selects the namespace the store operates on.
+func (s *RemoteStore) setNamespace(ns string) {
+	s.Namespace = ns
+}
+
+// Init checks that the server is reachable, accepts the credentials and
+// serves the namespace.
+func (s *RemoteStore) Init() error {
+	if s.Retries < 0 {
+		return fmt.Errorf("%w: remote retries cannot be negative", ErrInvalidConfiguration)
+	}
+	s.client = &http.Client{
+		Timeout:   remoteTimeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: s.TLS},
+	}
+	_, err := s.do(http.MethodGet, s.namespacePath(), nil)
+	return err
+}
+
+// Close releases the idle connections to the server.
+func (s *RemoteStore) Close() error {
+	if s.client != nil {
+		s.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// namespacePath returns the path of the store's namespace.
+func (s *RemoteStore) namespacePath() string {
+	return "/v1/namespaces/" + url.PathEscape(s.Namespace)
+}
+
+// secretPath returns the path of a secret.
+func (s *RemoteStore) secretPath(key string) string {
+	return s.namespacePath() + "/secrets/" + url.PathEscape(key)
+}
+
+// do sends a request, retrying it as long as it failed in a way that allows
+// it and the store's context isn't done, and returns the decoded response.
+func (s *RemoteStore) do(method, path string, value []byte) (*remoteResponse, error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("remote store %s is not initialized", s.URL)
+	}
+	var body []byte
+	if method == http.MethodPost || method == http.MethodPut {
+		var err error
+		if body, err = json.Marshal(remoteRequest{Value: value}); err != nil {
+			return nil, fmt.Errorf("failed to encode remote request: %w", err)
+		}
+	}
+
+	ctx := s.ctx()
+	delay := remoteRetryDelay
+	for attempt := 0; ; attempt++ {
+		response, retry, err := s.send(ctx, method, path, body)
+		if err == nil || !retry || attempt >= s.Retries {
+			return response, err
+		}
+		// Jitter keeps clients that failed together from retrying together
+		select {
+		case <-time.After(delay/2 + rand.N(delay/2+1)):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("remote request to %s canceled: %w", s.URL, ctx.Err())
+		}
+		delay = min(2*delay, remoteMaxRetryDelay)
+	}
+}
+
+// send sends a request once under ctx. It reports whether the request may be
+// retried if it failed: changes that may have been applied are not, nor
+// requests whose context is done.
+func (s *RemoteStore) send(ctx context.Context, method, path string, body []byte) (*remoteResponse, bool, error) {
+	request, err := http.NewRequestWithContext(ctx, method, s.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create remote request: %w", err)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if s.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	// GET and PUT can be repeated, POST and DELETE only if they never left
+	idempotent := method == http.MethodGet || method == http.MethodPut
+
+	resp, err := s.client.Do(request)
+	if err != nil && ctx.Err() != nil {
+		return nil, false, fmt.Errorf("remote request to %s canceled: %w", s.URL, ctx.Err())
+	}
+	if err != nil {
+		var opErr *net.OpError
+		isOpErr := errors.As(err, &opErr)
+		notSent := isOpErr && opErr.Op == "dial"
+		// Certificates rejected by either side fail again
+		var verifyErr *tls.CertificateVerificationError
+		rejected := errors.As(err, &verifyErr) || isOpErr && opErr.Op == "remote error"
+		return nil, (idempotent || notSent) && !rejected, fmt.Errorf("remote request to %s failed: %w", s.URL, err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, idempotent, fmt.Errorf("failed to read remote response: %w", err)
+	}
+	var response remoteResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		if resp.StatusCode >= 400 {
+			err = fmt.Errorf("remote server answered %s", resp.Status)
+		} else {
+			err = fmt.Errorf("invalid remote response: %w", err)
+		}
+		return nil, retryableStatus(resp.StatusCode, idempotent), err
+	}
+	if response.Error != nil {
+		return nil, retryableStatus(resp.StatusCode, idempotent), response.Error
+	}
+	if resp.StatusCode >= 400 {
+		return nil, retryableStatus(resp.StatusCode, idempotent), fmt.Errorf("remote server answered %s", resp.Status)
+	}
+	return &response, false, nil
+}
+
+// retryableStatus reports whether a request that got status may be retried.
+// A server that is unavailable or rate limiting didn't apply the request;
+// a gateway that failed may have passed it on.
+func retryableStatus(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	default:
+		return false
+	}
+}
+
+// Create stores a new encrypted value on the server.
+func (s *RemoteStore) Create(key string, encryptedValue []byte) error {
+	_, err := s.do(http.MethodPost, s.secretPath(key), encryptedValue)
+	return err
+}
+
+// Read retrieves an encrypted value from the server.
+func (s *RemoteStore) Read(key string) ([]byte, error) {
+	response, err := s.do(http.MethodGet, s.secretPath(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.Value, nil
+}
+
+// Update updates an existing encrypted value on the server.
+func (s *RemoteStore) Update(key string, encryptedValue []byte) error {
+	_, err := s.do(http.MethodPut, s.secretPath(key), encryptedValue)
+	return err
+}
+
+// Delete removes a secret from the server.
+func (s *RemoteStore) Delete(key string) error {
+	_, err := s.do(http.MethodDelete, s.secretPath(key), nil)
+	return err
+}
+
+// ListKeys lists the keys of the namespace on the server.
+func (s *RemoteStore) ListKeys() ([]string, error) {
+	response, err := s.do(http.MethodGet, s.namespacePath()+"/secrets", nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.Keys, nil
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// remoteMaxRequest bounds the body of a request to the server.
+const remoteMaxRequest = 16 << 20
+
+// RemoteServer serves the remote protocol for the stores returned by open,
+// one per namespace, opened on first use and kept open until Close. It only
+// handles ciphertext and never needs the encryption key.
+type RemoteServer struct {
+	open  func(namespace string) (SecretStore, error)
+	token string
+
+	mu     sync.Mutex
+	stores map[string]SecretStore
+}
+
+// NewRemoteServer creates a server for the stores returned by open. If token
+// is set, requests must carry it as bearer token.
+func NewRemoteServer(open func(namespace string) (SecretStore, error), token string) *RemoteServer {
+	return &RemoteServer{open: open, token: token, stores: make(map[string]SecretStore)}
+}
+
+// RemoteServerTLSConfig returns the TLS configuration of the server with the
+// certificate in certFile and keyFile. If clientCAFile is set, clients must
+// present a certificate it signed.
+func RemoteServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load server certificate: %v", ErrInvalidConfiguration, err)
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs, config.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Handler returns the HTTP handler of the server.
+func (rs *RemoteServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/namespaces/{ns}", rs.handle(func(s SecretStore, r *http.Request, _ []byte) (*remoteResponse, error) {
+		return &remoteResponse{}, nil
+	}))
+	mux.HandleFunc("GET /v1/namespaces/{ns}/secrets", rs.handle(func(s SecretStore, r *http.Request, _ []byte) (*remoteResponse, error) {
+		keys, err := s.ListKeys()
+		return &remoteResponse{Keys: keys}, err
+	}))
+	mux.HandleFunc("GET /v1/namespaces/{ns}/secrets/{key...}", rs.handle(func(s SecretStore, r *http.Request, _ []byte) (*remoteResponse, error) {
+		value, err := s.Read(r.PathValue("key"))
+		return &remoteResponse{Value: value}, err
+	}))
+	mux.HandleFunc("POST /v1/namespaces/{ns}/secrets/{key...}", rs.handle(func(s SecretStore, r *http.Request, value []byte) (*remoteResponse, error) {
+		return &remoteResponse{}, s.Create(r.PathValue("key"), value)
+	}))
+	mux.HandleFunc("PUT /v1/namespaces/{ns}/secrets/{key...}", rs.handle(func(s SecretStore, r *http.Request, value []byte) (*remoteResponse, error) {
+		return &remoteResponse{}, s.Update(r.PathValue("key"), value)
+	}))
+	mux.HandleFunc("DELETE /v1/namespaces/{ns}/secrets/{key...}", rs.handle(func(s SecretStore, r *http.Request, _ []byte) (*remoteResponse, error) {
+		return &remoteResponse{}, s.Delete(r.PathValue("key"))
+	}))
+	return mux
+}
+
+// handle returns a handler that authenticates the request, decodes its value
+// and runs fn on the store of its namespace.
+func (rs *RemoteServer) handle(fn func(s SecretStore, r *http.Request, value []byte) (*remoteResponse, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !rs.authorized(r) {
+			writeRemoteError(w, r, fmt.Errorf("%w: missing or wrong token", ErrInvalidConfiguration), http.StatusUnauthorized)
+			return
+		}
+		var request remoteRequest
+		if r.Method == http.MethodPost || r.Method == http.MethodPut {
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, remoteMaxRequest))
+			if err := decoder.Decode(&request); err != nil {
+				writeRemoteError(w, r, fmt.Errorf("invalid request: %w", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		s, err := rs.store(r.PathValue("ns"))
+		if err != nil {
+			writeRemoteError(w, r, err, remoteErrorStatus(err))
+			return
+		}
+		response, err := fn(s, r, request.Value)
+		if err != nil {
+			writeRemoteError(w, r, err, remoteErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// authorized reports whether r carries the token, if one is required.
+func (rs *RemoteServer) authorized(r *http.Request) bool {
+	if rs.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(rs.token)) == 1
+}
+
+// store returns the store of namespace, opening it on first use.
+func (rs *RemoteServer) store(namespace string) (SecretStore, error) {
+	if err := ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if s, ok := rs.stores[namespace]; ok {
+		return s, nil
+	}
+	s, err := rs.open(namespace)
+	if err != nil {
+		return nil, err
+	}
+	rs.stores[namespace] = s
+	return s, nil
+}
+
+// Close closes the stores opened by the server.
+func (rs *RemoteServer) Close() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	var errs []error
+	for ns, s := range rs.stores {
+		errs = append(errs, s.Close())
+		delete(rs.stores, ns)
+	}
+	return errors.Join(errs...)
+}
+
+// remoteErrorStatus returns the HTTP status of a store error.
+func remoteErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrSecretNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrSecretAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidKey), errors.Is(err, ErrInvalidConfiguration):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotSupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, ErrLockTimeout):
+		// Nothing was changed, the client may retry
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeRemoteError writes err as the response to r, logging server errors.
+func writeRemoteError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if status >= http.StatusInternalServerError && status != http.StatusServiceUnavailable {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(remoteResponse{Error: newPluginError(err)})
+}
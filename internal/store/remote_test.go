@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startTestRemote starts a test server serving memory stores through wrap
+// and returns a client of it, retrying without delay.
+func startTestRemote(t *testing.T, token string, wrap func(http.Handler) http.Handler) *RemoteStore {
+	t.Helper()
+	return startTestServer(t, func(string) (SecretStore, error) {
+		return NewMemoryStore(), nil
+	}, token, wrap)
+}
+
+// startTestServer is startTestRemote serving the stores opened by open.
+func startTestServer(t *testing.T, open func(namespace string) (SecretStore, error), token string, wrap func(http.Handler) http.Handler) *RemoteStore {
+	t.Helper()
+	previous := remoteRetryDelay
+	remoteRetryDelay = time.Millisecond
+	t.Cleanup(func() { remoteRetryDelay = previous })
+
+	server := NewRemoteServer(open, token)
+	ts := httptest.NewTLSServer(wrap(server.Handler()))
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { server.Close() })
+
+	s, err := NewRemoteStore(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	s.TLS = &tls.Config{RootCAs: pool}
+	s.Token = token
+	return s
+}
+
+// failing returns a wrapper answering the first n requests of method with
+// status instead of passing them on, counting the requests in calls.
+func failing(method string, status, n int, calls *atomic.Int32) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != method {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if calls.Add(1) <= int32(n) {
+				w.WriteHeader(status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRemoteStoreRetries(t *testing.T) {
+	var calls atomic.Int32
+	s := startTestRemote(t, "", failing(http.MethodPost, http.StatusServiceUnavailable, 2, &calls))
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("a", []byte("1")); err != nil {
+		t.Fatalf("Create after two unavailable answers = %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("Create was sent %d times, want 3", calls.Load())
+	}
+
+	calls.Store(0)
+	s = startTestRemote(t, "", failing(http.MethodPost, http.StatusServiceUnavailable, 100, &calls))
+	s.Retries = 1
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("a", []byte("1")); err == nil {
+		t.Fatal("Create succeeded although every attempt failed")
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("Create with one retry was sent %d times, want 2", calls.Load())
+	}
+}
+
+func TestRemoteStoreDoesNotRepeatChanges(t *testing.T) {
+	// A gateway that failed may have passed the request on
+	var calls atomic.Int32
+	s := startTestRemote(t, "", failing(http.MethodPost, http.StatusBadGateway, 1, &calls))
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("a", []byte("1")); err == nil || calls.Load() != 1 {
+		t.Fatalf("Create through a failed gateway = %v after %d requests, want an error after 1", err, calls.Load())
+	}
+
+	calls.Store(0)
+	s = startTestRemote(t, "", failing(http.MethodGet, http.StatusBadGateway, 1, &calls))
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init through a gateway failing once = %v", err)
+	}
+}
+
+func TestRemoteStoreToken(t *testing.T) {
+	s := startTestRemote(t, "right", func(h http.Handler) http.Handler { return h })
+	s.Token = "wrong"
+	if err := s.Init(); !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("Init with the wrong token = %v, want ErrInvalidConfiguration", err)
+	}
+	s.Token = ""
+	if err := s.Init(); !errors.Is(err, ErrInvalidConfiguration) {
+		t.Fatalf("Init without a token = %v, want ErrInvalidConfiguration", err)
+	}
+	s.Token = "right"
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init with the right token = %v", err)
+	}
+}
+
+func TestRemoteStorePathKeys(t *testing.T) {
+	s := startTestRemote(t, "", func(h http.Handler) http.Handler { return h })
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"prod/db/password", "../escape", "with space", "percent%2F", "query?x=1#y"}
+	for _, key := range keys {
+		if err := s.Create(key, []byte(key)); err != nil {
+			t.Fatalf("Create(%q) = %v", key, err)
+		}
+		if value, err := s.Read(key); err != nil || string(value) != key {
+			t.Fatalf("Read(%q) = %q, %v", key, value, err)
+		}
+	}
+	got, err := s.ListKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	slices.Sort(keys)
+	if !slices.Equal(got, keys) {
+		t.Fatalf("ListKeys = %q, want %q", got, keys)
+	}
+}
+
+func TestNewRemoteStoreRequiresHTTPS(t *testing.T) {
+	for _, u := range []string{"", "http://secrets:8443", "secrets:8443", "https://"} {
+		if _, err := NewRemoteStore(u); !errors.Is(err, ErrInvalidConfiguration) {
+			t.Errorf("NewRemoteStore(%q) = %v, want ErrInvalidConfiguration", u, err)
+		}
+	}
+}
+
+func TestRemoteServerBoltNamespaces(t *testing.T) {
+	previousBackend, previousPath := BackendType, BoltDBPath
+	t.Cleanup(func() { BackendType, BoltDBPath = previousBackend, previousPath })
+	BackendType, BoltDBPath = "bolt", filepath.Join(t.TempDir(), "secrets.bolt")
+
+	// Every namespace served is a store of the same bolt file
+	s := startTestServer(t, OpenNamespaceStore, "", func(h http.Handler) http.Handler { return h })
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, ns := range []string{"default", "team"} {
+		s.setNamespace(ns)
+		if err := s.Create("db", []byte(ns)); err != nil {
+			t.Fatalf("Create in namespace %s failed: %v", ns, err)
+		}
+	}
+	for _, ns := range []string{"default", "team"} {
+		s.setNamespace(ns)
+		if value, err := s.Read("db"); err != nil || string(value) != ns {
+			t.Errorf("Read in namespace %s = %q, %v", ns, value, err)
+		}
+	}
+}
+
+func TestRemoteStoreHonorsContext(t *testing.T) {
+	// A server that never answers
+	hang := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+	}
+	s := startTestRemote(t, "", hang)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.bindContext(ctx)
+	if err := s.Init(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Init against a hung server = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The wait between retries ends with the context too
+	var calls atomic.Int32
+	s = startTestRemote(t, "", failing(http.MethodPost, http.StatusServiceUnavailable, 100, &calls))
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	remoteRetryDelay = time.Hour
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.bindContext(ctx)
+	start := time.Now()
+	if err := s.Create("a", []byte("1")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Create while backing off = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Create gave up after %s, want at the deadline", elapsed)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("Create was sent %d times, want once before the deadline", calls.Load())
+	}
+}
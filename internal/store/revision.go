@@ -0,0 +1,52 @@
+package store
+
+import "fmt"
+
+// ErrRevisionMismatch is returned by CompareAndSwap when the secret was
+// changed since the expected revision was read.
+var ErrRevisionMismatch = fmt.Errorf("secret revision mismatch")
+
+// anyRevision makes the shared update paths skip the revision check, so
+// Update and CompareAndSwap can use them alike. Revisions start at 1.
+const anyRevision int64 = 0
+
+// RevisionStore is implemented by backends that can update a secret only if
+// nobody else changed it in the meantime. A secret's revision is the Version
+// of its metadata: 1 on creation, incremented by every update.
+type RevisionStore interface {
+	MetadataStore
+
+	// ReadRevision retrieves the encrypted value of a secret together with
+	// its current revision.
+	ReadRevision(key string) ([]byte, int64, error)
+	// CompareAndSwap updates the encrypted value like Update if the secret is
+	// still at expectedRevision. Returns an error wrapping
+	// ErrRevisionMismatch otherwise, and one wrapping ErrSecretNotFound if the
+	// key doesn't exist.
+	CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error
+}
+
+// AsRevisionStore returns s as a RevisionStore, or an error wrapping
+// ErrNotSupported if the backend can't compare and swap.
+func AsRevisionStore(s SecretStore) (RevisionStore, error) {
+	rs, ok := s.(RevisionStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s does not support revisions", ErrNotSupported, describeStore(s))
+	}
+	return rs, nil
+}
+
+// checkRevision returns an error wrapping ErrRevisionMismatch unless the
+// secret described by md is at the expected revision.
+func checkRevision(key string, md Metadata, expected int64) error {
+	if current := currentVersion(md); expected != anyRevision && current != expected {
+		return revisionMismatch(key, current, expected)
+	}
+	return nil
+}
+
+// revisionMismatch returns the error for a secret found at another revision
+// than expected.
+func revisionMismatch(key string, current, expected int64) error {
+	return fmt.Errorf("%w: secret with key '%s' is at revision %d, not %d", ErrRevisionMismatch, key, current, expected)
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+)
+
+// sealedKeyPurpose is what file keys are derived from the encryption key for.
+const sealedKeyPurpose = "secrets-cli file encryption"
+
+// Contents of sealed files.
+const (
+	sealedJSON   = "json"
+	sealedSQLite = "sqlite"
+)
+
+// sealedPrefix starts every sealed file.
+var sealedPrefix = []byte(`{"sealed":`)
+
+// sealedFile is a store file encrypted as a whole, so that it reveals
+// neither the keys of the secrets nor their number.
+type sealedFile struct {
+	Sealed  string `json:"sealed"` // What the content is, sealedJSON or sealedSQLite
+	Cipher  string `json:"cipher"` // See crypto.Cipher
+	KDF     string `json:"kdf"`    // See crypto.KeyDerivation
+	Content []byte `json:"content"`
+}
+
+// loadFileKey derives the key of sealed files from the encryption key.
+func loadFileKey() ([]byte, error) {
+	master, err := key.LoadKeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DeriveKey(master, sealedKeyPurpose)
+}
+
+// checkFileKey fails if sealed files can't be read or written.
+func checkFileKey(fileKey []byte) error {
+	if len(fileKey) == 0 {
+		return fmt.Errorf("%w: file encryption needs the encryption key", ErrInvalidConfiguration)
+	}
+	return nil
+}
+
+// isSealed reports whether content is a sealed file.
+func isSealed(content []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(content), sealedPrefix)
+}
+
+// isSealedFile reports whether the file at path is sealed.
+func isSealedFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(sealedPrefix))
+	n, _ := f.Read(head)
+	return isSealed(head[:n])
+}
+
+// sealFile encrypts content of kind with fileKey.
+func sealFile(kind string, content, fileKey []byte) ([]byte, error) {
+	if err := checkFileKey(fileKey); err != nil {
+		return nil, err
+	}
+	encrypted, err := crypto.Encrypt(content, fileKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt store file: %w", err)
+	}
+	sealed, err := json.Marshal(sealedFile{Sealed: kind, Cipher: crypto.Cipher, KDF: crypto.KeyDerivation, Content: encrypted})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sealed store file: %w", err)
+	}
+	return append(sealed, '\n'), nil
+}
+
+// unsealFile decrypts a sealed file of kind with fileKey.
+func unsealFile(kind string, content, fileKey []byte) ([]byte, error) {
+	if err := checkFileKey(fileKey); err != nil {
+		return nil, err
+	}
+	var sealed sealedFile
+	if err := json.Unmarshal(content, &sealed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sealed store file: %w", err)
+	}
+	if sealed.Sealed != kind {
+		return nil, fmt.Errorf("%w: file seals %s content, not %s", ErrUnsupportedFormat, sealed.Sealed, kind)
+	}
+	if sealed.Cipher != crypto.Cipher || sealed.KDF != crypto.KeyDerivation {
+		return nil, fmt.Errorf("%w: file is sealed with cipher '%s' and key derivation '%s'",
+			ErrUnsupportedFormat, sealed.Cipher, sealed.KDF)
+	}
+	plain, err := crypto.Decrypt(sealed.Content, fileKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt store file (wrong encryption key?): %w", err)
+	}
+	return plain, nil
+}
+
+// writeFileAtomic replaces the file at path with content, readable only by
+// its owner, through a temporary file in the same directory.
+func writeFileAtomic(path string, content []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "secrets-sealed-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpFilePath := tmpFile.Name()
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpFilePath, path); err != nil {
+		os.Remove(tmpFilePath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testFileKey = bytes.Repeat([]byte{1}, 32)
+
+// newTestSealedJSON returns an initialized JSON file store on path that
+// seals the file if seal is set.
+func newTestSealedJSON(t *testing.T, path, format string, seal bool) *JSONFileStore {
+	t.Helper()
+	s, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Format = format
+	s.JournalKey = []byte("journal-test-key")
+	s.Seal = seal
+	s.FileKey = testFileKey
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// newTestSealedSQLite returns an initialized sealed SQLite store on path.
+func newTestSealedSQLite(t *testing.T, path string, fileKey []byte) *SealedSQLiteStore {
+	t.Helper()
+	inner, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSealedSQLiteStore(inner, fileKey)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// assertSealed fails unless the file at path is sealed and doesn't contain
+// secret.
+func assertSealed(t *testing.T, path, secret string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealed(content) {
+		t.Fatalf("file isn't sealed:\n%s", content)
+	}
+	if bytes.Contains(content, []byte(secret)) {
+		t.Fatalf("sealed file reveals %q:\n%s", secret, content)
+	}
+}
+
+func TestSealedJSONFileHidesKeys(t *testing.T) {
+	for _, format := range []string{JSONFormatDocument, JSONFormatJournal} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "secrets.json")
+			s := newTestSealedJSON(t, path, format, true)
+			if err := s.Create("db_password", []byte("1")); err != nil {
+				t.Fatal(err)
+			}
+			if format == JSONFormatJournal {
+				// Journal records are sealed one by one
+				for _, line := range journalLines(t, path) {
+					if bytes.Contains(line, []byte("db_password")) {
+						t.Fatalf("journal record reveals the key: %s", line)
+					}
+				}
+			} else {
+				assertSealed(t, path, "db_password")
+			}
+
+			// Sealing is sticky: an instance without Seal keeps the file sealed
+			plain := newTestSealedJSON(t, path, format, false)
+			if err := plain.Update("db_password", []byte("2")); err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(content, []byte("db_password")) {
+				t.Fatalf("write without Seal revealed the key:\n%s", content)
+			}
+			if value, err := s.Read("db_password"); err != nil || string(value) != "2" {
+				t.Fatalf("Read = %q, %v", value, err)
+			}
+		})
+	}
+}
+
+func TestSealedJSONFileConvertsPlainFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	if err := newTestSealedJSON(t, path, JSONFormatDocument, false).Create("db_password", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSealedJSON(t, path, JSONFormatDocument, true)
+	if err := s.Create("other", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	assertSealed(t, path, "db_password")
+	if value, err := s.Read("db_password"); err != nil || string(value) != "1" {
+		t.Fatalf("Read of converted secret = %q, %v", value, err)
+	}
+}
+
+func TestSealedJSONFileWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	if err := newTestSealedJSON(t, path, JSONFormatDocument, true).Create("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewJSONFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.FileKey = bytes.Repeat([]byte{2}, 32)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("a"); err == nil {
+		t.Fatal("Read with the wrong file key succeeded")
+	}
+}
+
+func TestSealedSQLiteStoreSeparateInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.db")
+	first := newTestSealedSQLite(t, path, testFileKey)
+	second := newTestSealedSQLite(t, path, testFileKey)
+
+	if err := first.Create("db_password", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	assertSealed(t, path, "db_password")
+	// The second instance reloads the file changed by the first
+	if err := second.Update("db_password", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := first.Read("db_password"); err != nil || string(value) != "2" {
+		t.Fatalf("Read after update by another instance = %q, %v", value, err)
+	}
+
+	inner, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSealedSQLiteStore(inner, bytes.Repeat([]byte{2}, 32)).Init(); err == nil {
+		t.Fatal("Init with the wrong file key succeeded")
+	}
+}
+
+func TestSealedSQLiteStoreConvertsPlainDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.db")
+	plain, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Create("db_password", []byte{0, 0xff}); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.WriteMetadata("db_password", Metadata{Description: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+	plain.Close()
+
+	s := newTestSealedSQLite(t, path, testFileKey)
+	assertSealed(t, path, "db_password")
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(path + suffix); err == nil {
+			t.Errorf("plain %s file left next to the sealed database", suffix)
+		}
+	}
+	if value, err := s.Read("db_password"); err != nil || !bytes.Equal(value, []byte{0, 0xff}) {
+		t.Fatalf("Read of converted secret = %q, %v", value, err)
+	}
+	if md, err := s.ReadMetadata("db_password"); err != nil || md.Description != "kept" {
+		t.Fatalf("ReadMetadata of converted secret = %+v, %v", md, err)
+	}
+}
+
+func TestSQLiteDumpRoundTrip(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`PRAGMA user_version = 7;
+		CREATE TABLE "odd ""name""" (k TEXT PRIMARY KEY, v BLOB, n INTEGER);
+		CREATE INDEX odd_v ON "odd ""name""" (v);
+		INSERT INTO "odd ""name""" VALUES ('it''s', x'00ff', NULL), ('b', NULL, 42);`); err != nil {
+		t.Fatal(err)
+	}
+	script, err := dumpSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadSQLite(db, script); err != nil {
+		t.Fatalf("loading the dump failed: %v\n%s", err, script)
+	}
+	again, err := dumpSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(script, again) {
+		t.Fatalf("dump changed after loading it:\n%s\nthen:\n%s", script, again)
+	}
+}
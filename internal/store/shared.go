@@ -1,38 +1,121 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 var (
-	BackendType     string // Flag to select backend type
-	SqliteDBPath    string // Flag for sqlite backend config
-	JsonFilePath    string // Flag for jsonfile backend config
-	MongoURI        string // Flag for mongodb backend config
-	MongoDatabase   string // Flag for mongodb backend config
-	MongoCollection string // Flag for mongodb backend config
+	BackendType       string        // Flag to select backend type
+	BackendLocation   string        // Flag for plugin backend config
+	Namespace         string        // Flag to select the namespace of the secrets
+	SqliteDBPath      string        // Flag for sqlite backend config
+	SqliteTable       string        // Flag for sqlite backend config
+	SqliteBusyTimeout time.Duration // Flag for sqlite backend config
+	SqliteJournalMode string        // Flag for sqlite backend config
+	JsonFilePath      string        // Flag for jsonfile backend config
+	LockTimeout       time.Duration // Flag for jsonfile backend config
+	JsonFormat        string        // Flag for jsonfile backend config
+	FileEncryption    bool          // Flag to encrypt whole jsonfile and sqlite files
+	BoltDBPath        string        // Flag for bolt backend config
+	DirRoot           string        // Flag for dir backend config
+	GitEnabled        bool          // Flag to record changes of file backends in git
+	GitRemote         string        // Flag for the remote used by git sync
+	SoftDelete        bool          // Flag to move deleted secrets to the trash
+	ExpiryPolicy      string        // Flag for how read treats expired secrets
+	Timeout           time.Duration // Flag bounding how long a command may take
+	CacheTTL          time.Duration // Flag to cache reads of the selected backend
+	NoCache           bool          // Flag to bypass the cache
+	CacheDir          string        // Flag for the directory of the cache files
+	Replicas          []string      // Flag for the stores mirroring the selected one
+	Overlay           string        // Flag to select an overlay of the config file
+	OverlayLayerName  string        // Flag to select the overlay layer changes go to
+	RemoteURL         string        // Flag for remote backend config
+	RemoteTokenEnv    string        // Flag for remote backend config
+	RemoteCA          string        // Flag for remote backend config
+	RemoteCert        string        // Flag for remote backend config
+	RemoteKey         string        // Flag for remote backend config
+	MongoURI          string        // Flag for mongodb backend config
+	MongoDatabase     string        // Flag for mongodb backend config
+	MongoCollection   string        // Flag for mongodb backend config
 )
 
+// HistoryRetention is the flag for the number of previous versions kept per
+// secret.
+var HistoryRetention = DefaultHistoryRetention
+
+// RemoteRetries is the flag for how often the remote backend retries a
+// failed request.
+var RemoteRetries = DefaultRemoteRetries
+
+// CacheTTLs are the cache TTLs of the config file by backend, used unless
+// CacheTTL is set.
+var CacheTTLs map[string]time.Duration
+
+// Overlays are the overlays of the config file by name.
+var Overlays map[string][]OverlayLayerConfig
+
 // Config structure for loading defaults
 type StoreConfig struct {
-	BackendType     string `json:"backend_type"`
-	SqliteDBPath    string `json:"sqlite_db_path"`
-	JsonFilePath    string `json:"json_file_path"`
-	MongoURI        string `json:"mongo_uri"`
-	MongoDatabase   string `json:"mongo_database"`
-	MongoCollection string `json:"mongo_collection"`
+	BackendType       string `json:"backend_type"`
+	BackendLocation   string `json:"backend_location"`
+	Namespace         string `json:"namespace"`
+	SqliteDBPath      string `json:"sqlite_db_path"`
+	SqliteTable       string `json:"sqlite_table"`
+	SqliteBusyTimeout string `json:"sqlite_busy_timeout"`
+	SqliteJournalMode string `json:"sqlite_journal_mode"`
+	JsonFilePath      string `json:"json_file_path"`
+	LockTimeout       string `json:"lock_timeout"`
+	JsonFormat        string `json:"json_format"`
+	EncryptFile       bool   `json:"encrypt_file"`
+	BoltDBPath        string `json:"bolt_db_path"`
+	DirRoot           string `json:"dir_root"`
+	Git               bool   `json:"git"`
+	GitRemote         string `json:"git_remote"`
+	HistoryRetention  *int   `json:"history_retention"`
+	SoftDelete        bool   `json:"soft_delete"`
+	ExpiryPolicy      string `json:"expiry_policy"`
+	Timeout           string `json:"timeout"`
+	CacheDir          string `json:"cache_dir"`
+	Overlay           string `json:"overlay"`
+	RemoteURL         string `json:"remote_url"`
+	RemoteTokenEnv    string `json:"remote_token_env"`
+	RemoteCA          string `json:"remote_ca"`
+	RemoteCert        string `json:"remote_cert"`
+	RemoteKey         string `json:"remote_key"`
+	RemoteRetries     *int   `json:"remote_retries"`
+	MongoURI          string `json:"mongo_uri"`
+	MongoDatabase     string `json:"mongo_database"`
+	MongoCollection   string `json:"mongo_collection"`
+
+	// Cache TTL by backend, such as {"vault": "10m"}
+	CacheTTL map[string]string `json:"cache_ttl"`
+	// Stores mirroring the selected one, such as ["sqlite:/backup/secrets.db"]
+	Replicas []string `json:"replicas"`
+	// Layered stores by name, lowest priority layer first
+	Overlays map[string][]OverlayLayerConfig `json:"overlays"`
+}
+
+// ConfigPath returns the path of the config file, ~/.secrets-cli.json.
+func ConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".secrets-cli.json"), nil
 }
 
 // LoadConfig loads config from ~/.secrets-cli.json if present
 func LoadConfig() error {
-	home, err := os.UserHomeDir()
+	configPath, err := ConfigPath()
 	if err != nil {
 		return err
 	}
-	configPath := filepath.Join(home, ".secrets-cli.json")
 	file, err := os.Open(configPath)
 	if err != nil {
 		// If config file does not exist, skip loading
@@ -48,12 +131,107 @@ func LoadConfig() error {
 	if BackendType == "" {
 		BackendType = cfg.BackendType
 	}
+	if BackendLocation == "" {
+		BackendLocation = cfg.BackendLocation
+	}
+	if Namespace == "" {
+		Namespace = cfg.Namespace
+	}
 	if SqliteDBPath == "" {
 		SqliteDBPath = cfg.SqliteDBPath
 	}
+	if SqliteTable == "" {
+		SqliteTable = cfg.SqliteTable
+	}
+	if SqliteBusyTimeout == 0 && cfg.SqliteBusyTimeout != "" {
+		SqliteBusyTimeout, err = time.ParseDuration(cfg.SqliteBusyTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid sqlite_busy_timeout in config: %w", err)
+		}
+	}
+	if SqliteJournalMode == "" {
+		SqliteJournalMode = cfg.SqliteJournalMode
+	}
 	if JsonFilePath == "" {
 		JsonFilePath = cfg.JsonFilePath
 	}
+	if LockTimeout == 0 && cfg.LockTimeout != "" {
+		LockTimeout, err = time.ParseDuration(cfg.LockTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid lock_timeout in config: %w", err)
+		}
+	}
+	if JsonFormat == "" {
+		JsonFormat = cfg.JsonFormat
+	}
+	if !FileEncryption {
+		FileEncryption = cfg.EncryptFile
+	}
+	if BoltDBPath == "" {
+		BoltDBPath = cfg.BoltDBPath
+	}
+	if DirRoot == "" {
+		DirRoot = cfg.DirRoot
+	}
+	if !GitEnabled {
+		GitEnabled = cfg.Git
+	}
+	if GitRemote == "" {
+		GitRemote = cfg.GitRemote
+	}
+	if cfg.HistoryRetention != nil {
+		HistoryRetention = *cfg.HistoryRetention
+	}
+	if !SoftDelete {
+		SoftDelete = cfg.SoftDelete
+	}
+	if ExpiryPolicy == "" {
+		ExpiryPolicy = cfg.ExpiryPolicy
+	}
+	if Timeout == 0 && cfg.Timeout != "" {
+		Timeout, err = time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout in config: %w", err)
+		}
+	}
+	for backend, ttl := range cfg.CacheTTL {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("invalid cache_ttl for %s in config: %w", backend, err)
+		}
+		if CacheTTLs == nil {
+			CacheTTLs = make(map[string]time.Duration)
+		}
+		CacheTTLs[backend] = d
+	}
+	if CacheDir == "" {
+		CacheDir = cfg.CacheDir
+	}
+	if len(Replicas) == 0 {
+		Replicas = cfg.Replicas
+	}
+	if Overlay == "" {
+		Overlay = cfg.Overlay
+	}
+	Overlays = cfg.Overlays
+	if RemoteURL == "" {
+		RemoteURL = cfg.RemoteURL
+	}
+	if RemoteTokenEnv == "" {
+		RemoteTokenEnv = cfg.RemoteTokenEnv
+	}
+	if RemoteCA == "" {
+		RemoteCA = cfg.RemoteCA
+	}
+	if RemoteCert == "" {
+		RemoteCert = cfg.RemoteCert
+	}
+	if RemoteKey == "" {
+		RemoteKey = cfg.RemoteKey
+	}
+	if cfg.RemoteRetries != nil {
+		RemoteRetries = *cfg.RemoteRetries
+	}
 	if MongoURI == "" {
 		MongoURI = cfg.MongoURI
 	}
@@ -66,32 +244,218 @@ func LoadConfig() error {
 	return nil
 }
 
+// OpenStore is GetSecretStore bounded by ctx. A backend that honors a
+// context natively runs all its operations under ctx. For the others it
+// returns ctx's error if ctx is done before the backend is ready, closing the
+// store once it is.
+func OpenStore(ctx context.Context) (SecretStore, error) {
+	s, err := newSecretStore()
+	if err != nil {
+		return nil, err
+	}
+	return initContext(ctx, s)
+}
+
+// initContext binds ctx to s if s honors it natively and initializes s
+// bounded by ctx.
+func initContext(ctx context.Context, s SecretStore) (SecretStore, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cb, ok := s.(contextBinder); ok {
+		cb.bindContext(ctx)
+		if err := s.Init(); err != nil {
+			return nil, fmt.Errorf("failed to initialize store backend: %w", err)
+		}
+		return s, nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Init() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize store backend: %w", err)
+		}
+		return s, nil
+	case <-ctx.Done():
+		go func() {
+			if err := <-done; err == nil {
+				s.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
 // getSecretStore is a helper function to create and initialize the chosen backend.
 func GetSecretStore() (SecretStore, error) {
 	// Load defaults from config file if not already set
 	//_ = LoadConfig()
 
-	var s SecretStore
-	var err error
+	s, err := newSecretStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Init(); err != nil {
+		return nil, fmt.Errorf("failed to initialize store backend: %w", err)
+	}
+	return s, nil
+}
+
+// newSecretStore creates the chosen backend, not yet initialized.
+func newSecretStore() (SecretStore, error) {
+	if Overlay != "" {
+		s, err := newOverlay(Overlay)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create store instance: %w", err)
+		}
+		return s, nil
+	}
+	if OverlayLayerName != "" {
+		return nil, fmt.Errorf("%w: --layer requires an overlay", ErrInvalidConfiguration)
+	}
+	return newStore(BackendType, "", selectedNamespace(), true)
+}
 
-	switch BackendType {
-	case "sqlite":
-		s, err = NewSQLiteStore(SqliteDBPath)
-	case "jsonfile":
-		s, err = NewJSONFileStore(JsonFilePath)
-	case "mongodb-placeholder":
-		s, err = NewMongoDBStore(MongoURI, MongoDatabase, MongoCollection)
-	default:
-		return nil, fmt.Errorf("unknown backend type: %s", BackendType)
+// OpenNamespaceStore is GetSecretStore for namespace instead of the selected
+// one, for serving every namespace of the configured store. Overlays, whose
+// layers pick their own namespaces, are not supported.
+func OpenNamespaceStore(namespace string) (SecretStore, error) {
+	if Overlay != "" {
+		return nil, fmt.Errorf("%w: overlays can't be opened by namespace", ErrNotSupported)
 	}
+	return openStore(BackendType, "", namespace, true)
+}
 
+// OpenStoreSpec creates and initializes the store described by spec,
+// "<backend>:<location>" such as "jsonfile:/home/me/secrets.json". The
+// location is the database file, JSON file or directory of the backend. All
+// other settings, such as the namespace, come from the flags and the config
+// file; changes are not recorded in git. Like OpenStore, the store is
+// bounded by ctx.
+func OpenStoreSpec(ctx context.Context, spec string) (SecretStore, error) {
+	backend, location, err := parseStoreSpec(spec)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create store instance: %w", err)
+		return nil, err
+	}
+	s, err := newStore(backend, location, selectedNamespace(), false)
+	if err != nil {
+		return nil, err
+	}
+	return initContext(ctx, s)
+}
+
+// SameStore reports whether the store specs a and b name the same store. An
+// empty spec is the configured store. Locations are compared after the
+// defaults are applied, paths as absolute paths.
+func SameStore(a, b string) (bool, error) {
+	backendA, locationA, err := resolveStoreSpec(a)
+	if err != nil {
+		return false, err
+	}
+	backendB, locationB, err := resolveStoreSpec(b)
+	if err != nil {
+		return false, err
 	}
+	return backendA == backendB && locationA == locationB, nil
+}
 
+// resolveStoreSpec splits a store spec into backend and location like
+// parseStoreSpec, resolving an empty spec to the configured store and the
+// location to a canonical form.
+func resolveStoreSpec(spec string) (backend, location string, err error) {
+	if spec == "" && Overlay != "" {
+		return "overlay", Overlay, nil
+	}
+	if spec == "" {
+		backend, location = BackendType, configuredLocation(BackendType)
+	} else if backend, location, err = parseStoreSpec(spec); err != nil {
+		return "", "", err
+	}
+	if strings.Contains(location, "://") {
+		return backend, strings.TrimRight(location, "/"), nil
+	}
+	if location, err = filepath.Abs(location); err != nil {
+		return "", "", fmt.Errorf("failed to resolve store location: %w", err)
+	}
+	return backend, location, nil
+}
+
+// parseStoreSpec splits a store spec into backend and location.
+func parseStoreSpec(spec string) (backend, location string, err error) {
+	backend, location, _ = strings.Cut(spec, ":")
+	if location == "" {
+		return "", "", fmt.Errorf("%w: store '%s' has no location (expected <backend>:<path>)", ErrInvalidConfiguration, spec)
+	}
+	return backend, location, nil
+}
+
+// openStore creates a store of namespace with newStore and initializes it.
+func openStore(backend, location, namespace string, configured bool) (SecretStore, error) {
+	s, err := newStore(backend, location, namespace, configured)
+	if err != nil {
+		return nil, err
+	}
 	if err := s.Init(); err != nil {
 		return nil, fmt.Errorf("failed to initialize store backend: %w", err)
 	}
+	return s, nil
+}
+
+// newStore creates and configures a registered or plugin backend working in
+// namespace, not yet initialized. An empty location selects the configured
+// one. Changes are recorded in git, mirrored to replicas and reads are cached
+// only for the configured store.
+func newStore(backend, location, namespace string, configured bool) (SecretStore, error) {
+	factory, err := lookupBackend(backend)
+	if err != nil {
+		return nil, err
+	}
+	s, err := factory(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store instance: %w", err)
+	}
+
+	if configured && GitEnabled {
+		if s, err = newGitStore(s); err != nil {
+			return nil, fmt.Errorf("failed to create store instance: %w", err)
+		}
+	}
 
+	if err := ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+	if nsel, ok := s.(namespaceSelector); ok {
+		nsel.setNamespace(namespace)
+	} else if namespace != DefaultNamespace {
+		return nil, fmt.Errorf("%w: backend '%s' does not support namespaces", ErrNotSupported, backend)
+	}
+
+	if HistoryRetention < 0 {
+		return nil, fmt.Errorf("%w: history retention cannot be negative", ErrInvalidConfiguration)
+	}
+	if hr, ok := s.(historyRetainer); ok {
+		hr.setHistoryRetention(HistoryRetention)
+	}
+
+	if configured && len(Replicas) > 0 {
+		if s, err = withReplicas(s, backend, namespace); err != nil {
+			return nil, fmt.Errorf("failed to create store instance: %w", err)
+		}
+	}
+	if configured && !NoCache {
+		if s, err = withCache(s, backend, location, namespace); err != nil {
+			return nil, fmt.Errorf("failed to create store instance: %w", err)
+		}
+	}
 	return s, nil
 }
+
+// validateKey rejects keys that no backend can store.
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: secret key cannot be empty", ErrInvalidKey)
+	}
+	return nil
+}
@@ -1,23 +1,157 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	 //_ "github.com/mattn/go-sqlite3" // Import the SQLite driver
 	//"github.com/mattn/go-sqlite3"    // Import sqlite3 for specific error codes
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 const (
-	sqliteTableName = "secrets"
+	// DefaultSQLiteTable is the table holding the secrets unless configured
+	// otherwise; the history and trash tables are named after it.
+	DefaultSQLiteTable = "secrets"
+	// DefaultSQLiteBusyTimeout is how long a statement waits for another
+	// process's lock on the database before failing.
+	DefaultSQLiteBusyTimeout = 5 * time.Second
+	// DefaultSQLiteJournalMode is the journal mode set on the database.
+	DefaultSQLiteJournalMode = "wal"
 )
 
+// sqliteJournalModes are the journal modes that keep the database safe
+// against crashes.
+var sqliteJournalModes = []string{"wal", "delete", "truncate", "persist"}
+
+// sqliteTablePattern restricts table names to plain identifiers, since they
+// are spliced into the queries.
+var sqliteTablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sqliteQuerier is satisfied by both *sql.DB and *sql.Tx, so helpers can run
+// inside or outside a transaction.
+type sqliteQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqliteMetadataColumns are added to tables created before metadata was kept.
+// Timestamps are RFC 3339 text, tags a JSON object; NULL means unknown.
+var sqliteMetadataColumns = []struct{ name, definition string }{
+	{"created_at", "TEXT"},
+	{"updated_at", "TEXT"},
+	{"created_by", "TEXT"},
+	{"description", "TEXT"},
+	{"tags", "TEXT"},
+	{"version", "INTEGER"},
+	{"expires_at", "TEXT"},
+}
+
+// sqliteSchemas are the current definitions of the tables, keyed by the
+// suffix added to the configured table name. Every row belongs to a
+// namespace.
+var sqliteSchemas = map[string]string{
+	"": `
+            namespace TEXT NOT NULL DEFAULT 'default',
+            key TEXT NOT NULL,
+            value BLOB NOT NULL,
+            created_at TEXT,
+            updated_at TEXT,
+            created_by TEXT,
+            description TEXT,
+            tags TEXT,
+            version INTEGER,
+            expires_at TEXT,
+            rotate_every TEXT,
+            UNIQUE (namespace, key)`,
+	// Previous values replaced by Update, pruned to HistoryRetention per key
+	"_history": `
+            namespace TEXT NOT NULL DEFAULT 'default',
+            key TEXT NOT NULL,
+            version INTEGER NOT NULL,
+            value BLOB NOT NULL,
+            created_at TEXT,
+            PRIMARY KEY (namespace, key, version)`,
+	// Soft-deleted secrets with their metadata and history as JSON
+	"_trash": `
+            namespace TEXT NOT NULL DEFAULT 'default',
+            key TEXT NOT NULL,
+            value BLOB NOT NULL,
+            metadata TEXT,
+            history TEXT,
+            deleted_at TEXT NOT NULL,
+            PRIMARY KEY (namespace, key)`,
+}
+
+// sqliteMigrations bring the schema from one version to the next: entry i
+// upgrades a database at user_version i to version i+1. Databases created
+// before versions were recorded are at version 0 in any older layout, so the
+// first migrations check what they change. New schema changes are appended.
+var sqliteMigrations = []func(s *SQLiteStore, q sqliteQuerier) error{
+	// 0 -> 1: metadata columns, history and trash tables
+	func(s *SQLiteStore, q sqliteQuerier) error {
+		columns, err := s.columns(q, s.Table)
+		if err != nil {
+			return err
+		}
+		for _, col := range sqliteMetadataColumns {
+			if slices.Contains(columns, col.name) {
+				continue
+			}
+			query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", s.Table, col.name, col.definition)
+			if _, err := q.ExecContext(s.ctx(), query); err != nil {
+				return fmt.Errorf("failed to add column '%s' to table '%s': %w", col.name, s.Table, err)
+			}
+		}
+		return s.createTables(q)
+	},
+	// 1 -> 2: namespaces
+	func(s *SQLiteStore, q sqliteQuerier) error {
+		for _, table := range s.tables() {
+			if err := s.addNamespaceColumn(q, table); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2 -> 3: rotation interval
+	func(s *SQLiteStore, q sqliteQuerier) error {
+		columns, err := s.columns(q, s.Table)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(columns, "rotate_every") {
+			return nil
+		}
+		if _, err := q.ExecContext(s.ctx(), fmt.Sprintf("ALTER TABLE %s ADD COLUMN rotate_every TEXT", s.Table)); err != nil {
+			return fmt.Errorf("failed to add column 'rotate_every' to table '%s': %w", s.Table, err)
+		}
+		return nil
+	},
+}
+
 // SQLiteStore implements the SecretStore interface for a SQLite database.
 type SQLiteStore struct {
-	DBPath string
-	db     *sql.DB // Database connection
+	DBPath           string
+	Table            string        // Table of the secrets, also the prefix of the other tables
+	BusyTimeout      time.Duration // How long to wait for another process's lock
+	JournalMode      string        // Journal mode of the database, one of sqliteJournalModes
+	Namespace        string        // Namespace the store operates on
+	HistoryRetention int           // Number of previous versions kept per secret
+	db               *sql.DB       // Database connection
+	memory           bool          // Keep the database in memory, see SealedSQLiteStore
+	contextBinding                 // Context the statements run under
 }
 
 // NewSQLiteStore creates a new SQLiteStore instance.
@@ -25,40 +159,265 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 	if dbPath == "" {
 		return nil, fmt.Errorf("%w: SQLite database path cannot be empty", ErrInvalidConfiguration)
 	}
-	return &SQLiteStore{DBPath: dbPath}, nil
+	return &SQLiteStore{
+		DBPath:           dbPath,
+		Table:            DefaultSQLiteTable,
+		BusyTimeout:      DefaultSQLiteBusyTimeout,
+		JournalMode:      DefaultSQLiteJournalMode,
+		Namespace:        DefaultNamespace,
+		HistoryRetention: DefaultHistoryRetention,
+	}, nil
+}
+
+// setHistoryRetention sets the number of previous versions kept per secret.
+func (s *SQLiteStore) setHistoryRetention(n int) {
+	s.HistoryRetention = n
+}
+
+// setNamespace selects the namespace the store operates on.
+func (s *SQLiteStore) setNamespace(ns string) {
+	s.Namespace = ns
+}
+
+// historyTable returns the name of the table of previous versions.
+func (s *SQLiteStore) historyTable() string {
+	return s.Table + "_history"
+}
+
+// trashTable returns the name of the table of soft-deleted secrets.
+func (s *SQLiteStore) trashTable() string {
+	return s.Table + "_trash"
+}
+
+// tables returns the names of all tables used by the store.
+func (s *SQLiteStore) tables() []string {
+	return []string{s.Table, s.historyTable(), s.trashTable()}
+}
+
+// schema returns the definition of one of the store's tables.
+func (s *SQLiteStore) schema(table string) string {
+	return sqliteSchemas[strings.TrimPrefix(table, s.Table)]
 }
 
-// Init connects to the database and creates the table if it doesn't exist.
+// Init connects to the database, restricts the database file to its owner and
+// brings the schema up to date.
 func (s *SQLiteStore) Init() error {
-	dbConn, err := sql.Open("sqlite", s.DBPath)
+	if !sqliteTablePattern.MatchString(s.Table) {
+		return fmt.Errorf("%w: invalid SQLite table name '%s'", ErrInvalidConfiguration, s.Table)
+	}
+	if !slices.Contains(sqliteJournalModes, s.JournalMode) {
+		return fmt.Errorf("%w: invalid SQLite journal mode '%s' (expected one of %s)",
+			ErrInvalidConfiguration, s.JournalMode, strings.Join(sqliteJournalModes, ", "))
+	}
+	if s.BusyTimeout < 0 {
+		return fmt.Errorf("%w: invalid SQLite busy timeout %s", ErrInvalidConfiguration, s.BusyTimeout)
+	}
+
+	path := s.DBPath
+	if s.memory {
+		path = ":memory:"
+	} else {
+		// Create the file with restrictive permissions before SQLite does, and
+		// tighten them on files created by older versions
+		file, err := os.OpenFile(s.DBPath, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		file.Close()
+		if err := os.Chmod(s.DBPath, 0600); err != nil {
+			return fmt.Errorf("failed to set permissions on database: %w", err)
+		}
+	}
+
+	// The pragmas are applied to every connection the pool opens. Write
+	// transactions take the lock when they begin, so that two processes
+	// upgrading read locks can't deadlock.
+	params := url.Values{}
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", s.BusyTimeout.Milliseconds()))
+	params.Add("_pragma", fmt.Sprintf("journal_mode(%s)", s.JournalMode))
+	params.Set("_txlock", "immediate")
+	dbConn, err := sql.Open("sqlite", path+"?"+params.Encode())
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	// Pinging is a good practice to verify the connection
-	if err = dbConn.Ping(); err != nil {
+	if err = dbConn.PingContext(s.ctx()); err != nil {
 		dbConn.Close()
 		return fmt.Errorf("failed to ping database: %w", err)
 	}
+	// SQLite allows a single writer; sharing one connection serializes
+	// goroutines instead of failing them with SQLITE_BUSY
+	dbConn.SetMaxOpenConns(1)
 	s.db = dbConn
 
-	// Create table if not exists
-	// 'key' is TEXT and UNIQUE NOT NULL (implicitly creates an index)
-	// 'value' is BLOB to store the encrypted binary data
-	query := fmt.Sprintf(`
-        CREATE TABLE IF NOT EXISTS %s (
-            key TEXT UNIQUE NOT NULL,
-            value BLOB NOT NULL
-        )`, sqliteTableName)
+	if err := s.migrate(); err != nil {
+		s.Close()
+		return err
+	}
 
-	_, err = s.db.Exec(query)
+	return nil
+}
+
+// migrate runs the migrations the database hasn't seen yet, each in a
+// transaction that also records the new version in user_version. A database
+// without the secrets table gets the current schema right away. user_version
+// belongs to the database file, so all table names used in one file share
+// it.
+func (s *SQLiteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRowContext(s.ctx(), "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	latest := len(sqliteMigrations)
+	if version > latest {
+		return fmt.Errorf("database schema version %d is newer than the supported version %d; upgrade secrets-cli", version, latest)
+	}
+
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)"
+	if err := s.db.QueryRowContext(s.ctx(), query, s.Table).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to inspect database: %w", err)
+	}
+	if !exists {
+		return s.inTx("create tables", func(tx *sql.Tx) error {
+			if err := s.createTables(tx); err != nil {
+				return err
+			}
+			return setUserVersion(s.ctx(), tx, max(version, latest))
+		})
+	}
+
+	for v := version; v < latest; v++ {
+		err := s.inTx(fmt.Sprintf("migrate schema to version %d", v+1), func(tx *sql.Tx) error {
+			if err := sqliteMigrations[v](s, tx); err != nil {
+				return err
+			}
+			return setUserVersion(s.ctx(), tx, v+1)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setUserVersion records the schema version in the database header.
+func setUserVersion(ctx context.Context, q sqliteQuerier, version int) error {
+	// PRAGMA statements don't take parameters
+	if _, err := q.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction that is committed if fn succeeds.
+func (s *SQLiteStore) inTx(what string, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(s.ctx(), nil)
 	if err != nil {
-		s.Close() // Close connection on error
-		return fmt.Errorf("failed to create table '%s': %w", sqliteTableName, err)
+		return fmt.Errorf("failed to %s: %w", what, err)
 	}
+	defer tx.Rollback()
 
+	if err := fn(tx); err != nil {
+		return fmt.Errorf("failed to %s: %w", what, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to %s: %w", what, err)
+	}
 	return nil
 }
 
+// createTables creates the tables that don't exist with the current schema.
+func (s *SQLiteStore) createTables(q sqliteQuerier) error {
+	for _, table := range s.tables() {
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s\n        )", table, s.schema(table))
+		if _, err := q.ExecContext(s.ctx(), query); err != nil {
+			return fmt.Errorf("failed to create table '%s': %w", table, err)
+		}
+	}
+	return nil
+}
+
+// columns returns the column names of a table in declaration order.
+func (s *SQLiteStore) columns(q sqliteQuerier, table string) ([]string, error) {
+	rows, err := q.QueryContext(s.ctx(), fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect table '%s': %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     any
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, fmt.Errorf("failed to inspect table '%s': %w", table, err)
+		}
+		columns = append(columns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to inspect table '%s': %w", table, err)
+	}
+	return columns, nil
+}
+
+// addNamespaceColumn rebuilds a table created before namespaces existed,
+// since SQLite can't change the unique constraint of an existing table. The
+// rows are copied into the default namespace.
+func (s *SQLiteStore) addNamespaceColumn(q sqliteQuerier, table string) error {
+	columns, err := s.columns(q, table)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(columns, "namespace") {
+		return nil
+	}
+
+	old := table + "_old"
+	list := strings.Join(columns, ", ")
+	for _, query := range []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table, old),
+		fmt.Sprintf("CREATE TABLE %s (%s\n        )", table, s.schema(table)),
+		fmt.Sprintf("INSERT INTO %s (namespace, %s) SELECT '%s', %s FROM %s", table, list, DefaultNamespace, list, old),
+		fmt.Sprintf("DROP TABLE %s", old),
+	} {
+		if _, err := q.ExecContext(s.ctx(), query); err != nil {
+			return fmt.Errorf("failed to migrate table '%s': %w", table, err)
+		}
+	}
+	return nil
+}
+
+// isSQLiteConstraintViolation reports whether err is a UNIQUE or PRIMARY KEY
+// violation, i.e. the row already exists.
+func isSQLiteConstraintViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// sqliteTime formats t for storage, mapping the zero time to NULL.
+func sqliteTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseSQLiteTime parses a stored timestamp, mapping NULL to the zero time.
+func parseSQLiteTime(v sql.NullString) (time.Time, error) {
+	if !v.Valid || v.String == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, v.String)
+}
+
 // Close closes the database connection.
 func (s *SQLiteStore) Close() error {
 	if s.db != nil {
@@ -69,20 +428,55 @@ func (s *SQLiteStore) Close() error {
 
 // Create stores a new encrypted value.
 func (s *SQLiteStore) Create(key string, encryptedValue []byte) error {
-	query := fmt.Sprintf("INSERT INTO %s (key, value) VALUES (?, ?)", sqliteTableName)
-	_, err := s.db.Exec(query, key, encryptedValue)
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return s.insert(s.db, key, encryptedValue, nil)
+}
 
+// CreateWithMetadata stores a new encrypted value and applies edit to its
+// metadata within one transaction.
+func (s *SQLiteStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(s.ctx(), nil)
 	if err != nil {
 		return fmt.Errorf("sqlite create failed: %w", err)
 	}
+	defer tx.Rollback()
 
+	if err := s.insert(tx, key, encryptedValue, edit); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite create failed: %w", err)
+	}
 	return nil
 }
 
+// insert stores a new secret with fresh metadata, changed by edit. q must be
+// a transaction if edit is set.
+func (s *SQLiteStore) insert(q sqliteQuerier, key string, encryptedValue []byte, edit MetadataEdit) error {
+	md := newMetadata()
+	query := fmt.Sprintf("INSERT INTO %s (namespace, key, value, created_at, updated_at, version) VALUES (?, ?, ?, ?, ?, ?)", s.Table)
+	_, err := q.ExecContext(s.ctx(), query, s.Namespace, key, encryptedValue, sqliteTime(md.CreatedAt), sqliteTime(md.UpdatedAt), md.Version)
+
+	if isSQLiteConstraintViolation(err) {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+	}
+	if err != nil {
+		return fmt.Errorf("sqlite create failed: %w", err)
+	}
+
+	return s.editMetadata(q, key, edit)
+}
+
 // Read retrieves an encrypted value.
 func (s *SQLiteStore) Read(key string) ([]byte, error) {
-	query := fmt.Sprintf("SELECT value FROM %s WHERE key = ?", sqliteTableName)
-	row := s.db.QueryRow(query, key)
+	query := fmt.Sprintf("SELECT value FROM %s WHERE namespace = ? AND key = ?", s.Table)
+	row := s.db.QueryRowContext(s.ctx(), query, s.Namespace, key)
 
 	var encryptedValue []byte
 	err := row.Scan(&encryptedValue)
@@ -97,29 +491,115 @@ func (s *SQLiteStore) Read(key string) ([]byte, error) {
 	return encryptedValue, nil
 }
 
-// Update updates an existing encrypted value.
+// ReadRevision retrieves an encrypted value and its revision.
+func (s *SQLiteStore) ReadRevision(key string) ([]byte, int64, error) {
+	query := fmt.Sprintf("SELECT value, version FROM %s WHERE namespace = ? AND key = ?", s.Table)
+	var (
+		encryptedValue []byte
+		version        sql.NullInt64
+	)
+	err := s.db.QueryRowContext(s.ctx(), query, s.Namespace, key).Scan(&encryptedValue, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("sqlite read failed: %w", err)
+	}
+
+	return encryptedValue, currentVersion(Metadata{Version: version.Int64}), nil
+}
+
+// Update updates an existing encrypted value, moving the previous one into
+// the history table.
 func (s *SQLiteStore) Update(key string, encryptedValue []byte) error {
-	query := fmt.Sprintf("UPDATE %s SET value = ? WHERE key = ?", sqliteTableName)
-	result, err := s.db.Exec(query, encryptedValue, key)
+	return s.UpdateWithMetadata(key, anyRevision, encryptedValue, nil)
+}
+
+// CompareAndSwap updates a secret if it is still at expectedRevision. The
+// final UPDATE only matches the row at that revision.
+func (s *SQLiteStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	return s.UpdateWithMetadata(key, expectedRevision, encryptedValue, nil)
+}
+
+// UpdateWithMetadata replaces the value of a secret at the expected revision
+// and applies edit to its metadata within one transaction.
+func (s *SQLiteStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	tx, err := s.db.BeginTx(s.ctx(), nil)
 	if err != nil {
 		return fmt.Errorf("sqlite update failed: %w", err)
 	}
+	defer tx.Rollback()
+
+	if err := s.replace(tx, key, expectedRevision, encryptedValue, edit); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite update failed: %w", err)
+	}
+	return nil
+}
 
+// replace moves the value of a secret at the expected revision into the
+// history table, stores the new one and applies edit to its metadata. q must
+// be a transaction.
+func (s *SQLiteStore) replace(q sqliteQuerier, key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	query := fmt.Sprintf("SELECT value, updated_at, version FROM %s WHERE namespace = ? AND key = ?", s.Table)
+	var (
+		oldValue  []byte
+		updatedAt sql.NullString
+		version   sql.NullInt64
+	)
+	err := q.QueryRowContext(s.ctx(), query, s.Namespace, key).Scan(&oldValue, &updatedAt, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	if err != nil {
+		return fmt.Errorf("sqlite update failed: %w", err)
+	}
+
+	current := currentVersion(Metadata{Version: version.Int64})
+	if expectedRevision != anyRevision && current != expectedRevision {
+		return revisionMismatch(key, current, expectedRevision)
+	}
+	if s.HistoryRetention > 0 {
+		query = fmt.Sprintf("INSERT OR REPLACE INTO %s (namespace, key, version, value, created_at) VALUES (?, ?, ?, ?, ?)", s.historyTable())
+		if _, err := q.ExecContext(s.ctx(), query, s.Namespace, key, current, oldValue, updatedAt); err != nil {
+			return fmt.Errorf("sqlite update history failed: %w", err)
+		}
+	}
+	query = fmt.Sprintf(`DELETE FROM %s WHERE namespace = ? AND key = ? AND version NOT IN
+        (SELECT version FROM %s WHERE namespace = ? AND key = ? ORDER BY version DESC LIMIT ?)`, s.historyTable(), s.historyTable())
+	if _, err := q.ExecContext(s.ctx(), query, s.Namespace, key, s.Namespace, key, max(s.HistoryRetention, 0)); err != nil {
+		return fmt.Errorf("sqlite prune history failed: %w", err)
+	}
+
+	query = fmt.Sprintf(`UPDATE %s SET value = ?, updated_at = ?, version = ?
+        WHERE namespace = ? AND key = ? AND COALESCE(version, 1) = ?`, s.Table)
+	result, err := q.ExecContext(s.ctx(), query, encryptedValue, sqliteTime(time.Now()), current+1, s.Namespace, key, current)
+	if err != nil {
+		return fmt.Errorf("sqlite update failed: %w", err)
+	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("sqlite update get rows affected failed: %w", err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+		return fmt.Errorf("%w: secret with key '%s' changed during the update", ErrRevisionMismatch, key)
 	}
-
-	return nil
+	return s.editMetadata(q, key, edit)
 }
 
 // Delete removes a secret.
 func (s *SQLiteStore) Delete(key string) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE key = ?", sqliteTableName)
-	result, err := s.db.Exec(query, key)
+	// The history goes in the same transaction, so none is left behind for a
+	// key created again later
+	return s.inTx("delete secret", func(tx *sql.Tx) error { return s.remove(tx, key) })
+}
+
+// remove deletes a secret and its history using q.
+func (s *SQLiteStore) remove(q sqliteQuerier, key string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE namespace = ? AND key = ?", s.Table)
+	result, err := q.ExecContext(s.ctx(), query, s.Namespace, key)
 	if err != nil {
 		return fmt.Errorf("sqlite delete failed: %w", err)
 	}
@@ -132,13 +612,51 @@ func (s *SQLiteStore) Delete(key string) error {
 		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
 	}
 
+	query = fmt.Sprintf("DELETE FROM %s WHERE namespace = ? AND key = ?", s.historyTable())
+	if _, err := q.ExecContext(s.ctx(), query, s.Namespace, key); err != nil {
+		return fmt.Errorf("sqlite delete history failed: %w", err)
+	}
+
+	return nil
+}
+
+// ApplyBatch applies ops within a single transaction that is rolled back if
+// an operation fails.
+func (s *SQLiteStore) ApplyBatch(ops []BatchOp) error {
+	if err := validateBatch(ops); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(s.ctx(), nil)
+	if err != nil {
+		return fmt.Errorf("sqlite batch failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, op := range ops {
+		switch op.Kind {
+		case BatchCreate:
+			err = s.insert(tx, op.Key, op.Value, op.Metadata)
+		case BatchUpdate:
+			err = s.replace(tx, op.Key, anyRevision, op.Value, op.Metadata)
+		case BatchDelete:
+			err = s.remove(tx, op.Key)
+		}
+		if err != nil {
+			return batchOpError(i, op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite batch failed: %w", err)
+	}
 	return nil
 }
 
 // ListKeys lists all available keys.
 func (s *SQLiteStore) ListKeys() ([]string, error) {
-	query := fmt.Sprintf("SELECT key FROM %s", sqliteTableName)
-	rows, err := s.db.Query(query)
+	query := fmt.Sprintf("SELECT key FROM %s WHERE namespace = ?", s.Table)
+	rows, err := s.db.QueryContext(s.ctx(), query, s.Namespace)
 	if err != nil {
 		return nil, fmt.Errorf("sqlite list keys failed: %w", err)
 	}
@@ -159,3 +677,491 @@ func (s *SQLiteStore) ListKeys() ([]string, error) {
 
 	return keys, nil
 }
+
+// ListKeysWithPrefix lists the keys starting with prefix. It matches with
+// GLOB rather than LIKE, which ignores case for ASCII letters.
+func (s *SQLiteStore) ListKeysWithPrefix(prefix string) ([]string, error) {
+	query := fmt.Sprintf("SELECT key FROM %s WHERE namespace = ? AND key GLOB ?", s.Table)
+	rows, err := s.db.QueryContext(s.ctx(), query, s.Namespace, sqliteGlobEscaper.Replace(prefix)+"*")
+	if err != nil {
+		return nil, fmt.Errorf("sqlite list keys failed: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("sqlite list keys scan failed: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite list keys row iteration error: %w", err)
+	}
+
+	return keys, nil
+}
+
+// listPage lists up to limit keys starting with prefix and sorting after
+// after, in the byte order of the BINARY collation; all of them if limit
+// is 0.
+func (s *SQLiteStore) listPage(prefix, after string, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
+	query := fmt.Sprintf("SELECT key FROM %s WHERE namespace = ? AND key GLOB ? AND key > ? ORDER BY key LIMIT ?", s.Table)
+	rows, err := s.db.QueryContext(s.ctx(), query, s.Namespace, sqliteGlobEscaper.Replace(prefix)+"*", after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite list keys failed: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("sqlite list keys scan failed: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite list keys row iteration error: %w", err)
+	}
+
+	return keys, nil
+}
+
+// sqliteGlobEscaper makes the GLOB wildcards of a prefix match literally.
+var sqliteGlobEscaper = strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]")
+
+// ReadMetadata returns the metadata of a secret.
+func (s *SQLiteStore) ReadMetadata(key string) (Metadata, error) {
+	return s.readMetadata(s.db, key)
+}
+
+// readMetadata returns the metadata of a secret using q.
+func (s *SQLiteStore) readMetadata(q sqliteQuerier, key string) (Metadata, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE namespace = ? AND key = ?", sqliteMetadataSelect, s.Table)
+	md, err := scanSQLiteMetadata(q.QueryRowContext(s.ctx(), query, s.Namespace, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Metadata{}, fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+	if err != nil {
+		return Metadata{}, fmt.Errorf("sqlite read metadata failed: %w", err)
+	}
+	return md, nil
+}
+
+// ListMetadata returns the metadata of every secret of the namespace in one
+// query.
+func (s *SQLiteStore) ListMetadata() (map[string]Metadata, error) {
+	query := fmt.Sprintf("SELECT key, %s FROM %s WHERE namespace = ?", sqliteMetadataSelect, s.Table)
+	rows, err := s.db.QueryContext(s.ctx(), query, s.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite list metadata failed: %w", err)
+	}
+	defer rows.Close()
+
+	all := make(map[string]Metadata)
+	for rows.Next() {
+		var key string
+		md, err := scanSQLiteMetadata(rows, &key)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite list metadata failed: %w", err)
+		}
+		all[key] = md
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite list metadata row iteration error: %w", err)
+	}
+	return all, nil
+}
+
+// sqliteMetadataSelect are the columns decoded by scanSQLiteMetadata.
+const sqliteMetadataSelect = "created_at, updated_at, created_by, description, tags, version, expires_at, rotate_every"
+
+// scanSQLiteMetadata scans the columns selected before sqliteMetadataSelect
+// into dest and decodes the metadata columns.
+func scanSQLiteMetadata(row interface{ Scan(dest ...any) error }, dest ...any) (Metadata, error) {
+	var createdAt, updatedAt, createdBy, description, tags, expiresAt, rotateEvery sql.NullString
+	var version sql.NullInt64
+	err := row.Scan(append(dest, &createdAt, &updatedAt, &createdBy, &description, &tags, &version, &expiresAt, &rotateEvery)...)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	md := Metadata{CreatedBy: createdBy.String, Description: description.String, Version: version.Int64, RotateEvery: rotateEvery.String}
+	if md.CreatedAt, err = parseSQLiteTime(createdAt); err != nil {
+		return Metadata{}, fmt.Errorf("invalid created_at: %w", err)
+	}
+	if md.UpdatedAt, err = parseSQLiteTime(updatedAt); err != nil {
+		return Metadata{}, fmt.Errorf("invalid updated_at: %w", err)
+	}
+	if md.ExpiresAt, err = parseSQLiteTime(expiresAt); err != nil {
+		return Metadata{}, fmt.Errorf("invalid expires_at: %w", err)
+	}
+	if tags.Valid && tags.String != "" {
+		if err := json.Unmarshal([]byte(tags.String), &md.Tags); err != nil {
+			return Metadata{}, fmt.Errorf("invalid tags: %w", err)
+		}
+	}
+	return md, nil
+}
+
+// sqliteTags encodes tags for storage, mapping no tags to NULL.
+func sqliteTags(tags map[string]string) (any, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// sqliteVersion returns the version for storage, mapping an unknown version
+// to NULL.
+func sqliteVersion(version int64) any {
+	if version <= 0 {
+		return nil
+	}
+	return version
+}
+
+// WriteMetadata replaces the metadata of a secret.
+func (s *SQLiteStore) WriteMetadata(key string, md Metadata) error {
+	return s.writeMetadata(s.db, key, md)
+}
+
+// editMetadata applies edit to the metadata of a secret using q. A nil edit
+// does nothing.
+func (s *SQLiteStore) editMetadata(q sqliteQuerier, key string, edit MetadataEdit) error {
+	if edit == nil {
+		return nil
+	}
+	md, err := s.readMetadata(q, key)
+	if err != nil {
+		return err
+	}
+	edit.apply(&md)
+	return s.writeMetadata(q, key, md)
+}
+
+// writeMetadata replaces the metadata of a secret using q, except for its
+// revision.
+func (s *SQLiteStore) writeMetadata(q sqliteQuerier, key string, md Metadata) error {
+	tags, err := sqliteTags(md.Tags)
+	if err != nil {
+		return fmt.Errorf("sqlite write metadata failed: %w", err)
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET created_at = ?, updated_at = ?, created_by = ?, description = ?, tags = ?,
+        expires_at = ?, rotate_every = ? WHERE namespace = ? AND key = ?`, s.Table)
+	result, err := q.ExecContext(s.ctx(), query, sqliteTime(md.CreatedAt), sqliteTime(md.UpdatedAt),
+		md.CreatedBy, md.Description, tags, sqliteTime(md.ExpiresAt), md.RotateEvery, s.Namespace, key)
+	if err != nil {
+		return fmt.Errorf("sqlite write metadata failed: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("sqlite write metadata get rows affected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretNotFound, key)
+	}
+
+	return nil
+}
+
+// ListVersions returns the retained previous versions of a secret.
+func (s *SQLiteStore) ListVersions(key string) ([]SecretVersion, error) {
+	if _, err := s.Read(key); err != nil {
+		return nil, err
+	}
+	return s.readHistory(s.db, key)
+}
+
+// readHistory returns the history rows of a key using q, newest first.
+func (s *SQLiteStore) readHistory(q sqliteQuerier, key string) ([]SecretVersion, error) {
+	query := fmt.Sprintf("SELECT version, value, created_at FROM %s WHERE namespace = ? AND key = ? ORDER BY version DESC", s.historyTable())
+	rows, err := q.QueryContext(s.ctx(), query, s.Namespace, key)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite list versions failed: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []SecretVersion
+	for rows.Next() {
+		var (
+			v         SecretVersion
+			createdAt sql.NullString
+		)
+		if err := rows.Scan(&v.Version, &v.Value, &createdAt); err != nil {
+			return nil, fmt.Errorf("sqlite list versions scan failed: %w", err)
+		}
+		if v.CreatedAt, err = parseSQLiteTime(createdAt); err != nil {
+			return nil, fmt.Errorf("sqlite list versions failed: invalid created_at: %w", err)
+		}
+		versions = append(versions, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite list versions row iteration error: %w", err)
+	}
+
+	return versions, nil
+}
+
+// ReadVersion returns the value of the current or a previous version.
+func (s *SQLiteStore) ReadVersion(key string, version int64) ([]byte, error) {
+	md, err := s.ReadMetadata(key)
+	if err != nil {
+		return nil, err
+	}
+	if version == currentVersion(md) {
+		return s.Read(key)
+	}
+
+	query := fmt.Sprintf("SELECT value FROM %s WHERE namespace = ? AND key = ? AND version = ?", s.historyTable())
+	var encryptedValue []byte
+	err = s.db.QueryRowContext(s.ctx(), query, s.Namespace, key, version).Scan(&encryptedValue)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, versionNotFound(key, version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sqlite read version failed: %w", err)
+	}
+
+	return encryptedValue, nil
+}
+
+// Trash moves a secret with its metadata and history to the trash table.
+func (s *SQLiteStore) Trash(key string) error {
+	tx, err := s.db.BeginTx(s.ctx(), nil)
+	if err != nil {
+		return fmt.Errorf("sqlite trash failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	md, err := s.readMetadata(tx, key)
+	if err != nil {
+		return err
+	}
+	var encryptedValue []byte
+	query := fmt.Sprintf("SELECT value FROM %s WHERE namespace = ? AND key = ?", s.Table)
+	if err := tx.QueryRowContext(s.ctx(), query, s.Namespace, key).Scan(&encryptedValue); err != nil {
+		return fmt.Errorf("sqlite trash failed: %w", err)
+	}
+	history, err := s.readHistory(tx, key)
+	if err != nil {
+		return err
+	}
+
+	encodedMetadata, err := json.Marshal(md)
+	if err != nil {
+		return fmt.Errorf("sqlite trash failed: %w", err)
+	}
+	encodedHistory, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("sqlite trash failed: %w", err)
+	}
+
+	query = fmt.Sprintf("INSERT INTO %s (namespace, key, value, metadata, history, deleted_at) VALUES (?, ?, ?, ?, ?, ?)", s.trashTable())
+	_, err = tx.ExecContext(s.ctx(), query, s.Namespace, key, encryptedValue, string(encodedMetadata), string(encodedHistory), sqliteTime(time.Now()))
+	if isSQLiteConstraintViolation(err) {
+		return alreadyInTrash(key)
+	}
+	if err != nil {
+		return fmt.Errorf("sqlite trash failed: %w", err)
+	}
+	for _, table := range []string{s.Table, s.historyTable()} {
+		if _, err := tx.ExecContext(s.ctx(), fmt.Sprintf("DELETE FROM %s WHERE namespace = ? AND key = ?", table), s.Namespace, key); err != nil {
+			return fmt.Errorf("sqlite trash failed: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite trash failed: %w", err)
+	}
+	return nil
+}
+
+// ListTrash returns the secrets in the trash table.
+func (s *SQLiteStore) ListTrash() ([]TrashedSecret, error) {
+	query := fmt.Sprintf("SELECT key, deleted_at FROM %s WHERE namespace = ?", s.trashTable())
+	rows, err := s.db.QueryContext(s.ctx(), query, s.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite list trash failed: %w", err)
+	}
+	defer rows.Close()
+
+	var trashed []TrashedSecret
+	for rows.Next() {
+		var (
+			t         TrashedSecret
+			deletedAt sql.NullString
+		)
+		if err := rows.Scan(&t.Key, &deletedAt); err != nil {
+			return nil, fmt.Errorf("sqlite list trash scan failed: %w", err)
+		}
+		if t.DeletedAt, err = parseSQLiteTime(deletedAt); err != nil {
+			return nil, fmt.Errorf("sqlite list trash failed: invalid deleted_at: %w", err)
+		}
+		trashed = append(trashed, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite list trash row iteration error: %w", err)
+	}
+
+	return trashed, nil
+}
+
+// Restore moves a secret with its metadata and history out of the trash table.
+func (s *SQLiteStore) Restore(key string) error {
+	tx, err := s.db.BeginTx(s.ctx(), nil)
+	if err != nil {
+		return fmt.Errorf("sqlite restore failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		encryptedValue                  []byte
+		encodedMetadata, encodedHistory sql.NullString
+	)
+	query := fmt.Sprintf("SELECT value, metadata, history FROM %s WHERE namespace = ? AND key = ?", s.trashTable())
+	err = tx.QueryRowContext(s.ctx(), query, s.Namespace, key).Scan(&encryptedValue, &encodedMetadata, &encodedHistory)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notInTrash(key)
+	}
+	if err != nil {
+		return fmt.Errorf("sqlite restore failed: %w", err)
+	}
+
+	var (
+		md      Metadata
+		history []SecretVersion
+	)
+	if encodedMetadata.Valid {
+		if err := json.Unmarshal([]byte(encodedMetadata.String), &md); err != nil {
+			return fmt.Errorf("sqlite restore failed: invalid metadata: %w", err)
+		}
+	}
+	if encodedHistory.Valid {
+		if err := json.Unmarshal([]byte(encodedHistory.String), &history); err != nil {
+			return fmt.Errorf("sqlite restore failed: invalid history: %w", err)
+		}
+	}
+	tags, err := sqliteTags(md.Tags)
+	if err != nil {
+		return fmt.Errorf("sqlite restore failed: %w", err)
+	}
+
+	query = fmt.Sprintf(`INSERT INTO %s (namespace, key, value, created_at, updated_at, created_by, description, tags, version, expires_at, rotate_every)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, s.Table)
+	_, err = tx.ExecContext(s.ctx(), query, s.Namespace, key, encryptedValue, sqliteTime(md.CreatedAt), sqliteTime(md.UpdatedAt),
+		md.CreatedBy, md.Description, tags, sqliteVersion(md.Version), sqliteTime(md.ExpiresAt), md.RotateEvery)
+
+	if isSQLiteConstraintViolation(err) {
+		return fmt.Errorf("%w: secret with key '%s'", ErrSecretAlreadyExists, key)
+	}
+	if err != nil {
+		return fmt.Errorf("sqlite restore failed: %w", err)
+	}
+
+	query = fmt.Sprintf("INSERT OR REPLACE INTO %s (namespace, key, version, value, created_at) VALUES (?, ?, ?, ?, ?)", s.historyTable())
+	for _, v := range history {
+		if _, err := tx.ExecContext(s.ctx(), query, s.Namespace, key, v.Version, v.Value, sqliteTime(v.CreatedAt)); err != nil {
+			return fmt.Errorf("sqlite restore history failed: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(s.ctx(), fmt.Sprintf("DELETE FROM %s WHERE namespace = ? AND key = ?", s.trashTable()), s.Namespace, key); err != nil {
+		return fmt.Errorf("sqlite restore failed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite restore failed: %w", err)
+	}
+	return nil
+}
+
+// Purge permanently removes the secrets trashed before the given time.
+func (s *SQLiteStore) Purge(before time.Time) ([]string, error) {
+	tx, err := s.db.BeginTx(s.ctx(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite purge failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Timestamps don't sort as text, so compare them after parsing
+	query := fmt.Sprintf("SELECT key, deleted_at FROM %s WHERE namespace = ?", s.trashTable())
+	rows, err := tx.QueryContext(s.ctx(), query, s.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite purge failed: %w", err)
+	}
+	var purged []string
+	for rows.Next() {
+		var (
+			key       string
+			deletedAt sql.NullString
+		)
+		if err := rows.Scan(&key, &deletedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("sqlite purge scan failed: %w", err)
+		}
+		t, err := parseSQLiteTime(deletedAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("sqlite purge failed: invalid deleted_at: %w", err)
+		}
+		if t.Before(before) {
+			purged = append(purged, key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite purge row iteration error: %w", err)
+	}
+
+	query = fmt.Sprintf("DELETE FROM %s WHERE namespace = ? AND key = ?", s.trashTable())
+	for _, key := range purged {
+		if _, err := tx.ExecContext(s.ctx(), query, s.Namespace, key); err != nil {
+			return nil, fmt.Errorf("sqlite purge failed: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("sqlite purge failed: %w", err)
+	}
+	return purged, nil
+}
+
+// ListNamespaces returns the namespaces that contain secrets.
+func (s *SQLiteStore) ListNamespaces() ([]string, error) {
+	query := fmt.Sprintf("SELECT namespace FROM %s UNION SELECT namespace FROM %s", s.Table, s.trashTable())
+	rows, err := s.db.QueryContext(s.ctx(), query)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite list namespaces failed: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var ns string
+		if err := rows.Scan(&ns); err != nil {
+			return nil, fmt.Errorf("sqlite list namespaces scan failed: %w", err)
+		}
+		names = append(names, ns)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite list namespaces row iteration error: %w", err)
+	}
+
+	return namespaceList(names), nil
+}
@@ -0,0 +1,449 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sqliteFileHeader starts every plain SQLite database file.
+var sqliteFileHeader = []byte("SQLite format 3\x00")
+
+// fileStamp tells whether a file changed since it was last read or written.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// stampFile returns the stamp of the file at path, zero if it doesn't exist.
+func stampFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}
+}
+
+// SealedSQLiteStore keeps a SQLite database in memory and stores it at the
+// database path as one encrypted file holding an SQL dump of the database,
+// so that the file reveals neither the keys of the secrets nor their number
+// or the schema. Every change rewrites the whole file under a lock on
+// <path>.lock, and the database is reloaded whenever another process changed
+// the file.
+type SealedSQLiteStore struct {
+	Inner   *SQLiteStore
+	FileKey []byte // Derived from the encryption key
+	mu      sync.Mutex
+	loaded  fileStamp // The file as last read or written
+}
+
+// NewSealedSQLiteStore stores inner as a sealed file.
+func NewSealedSQLiteStore(inner *SQLiteStore, fileKey []byte) *SealedSQLiteStore {
+	inner.memory = true
+	return &SealedSQLiteStore{Inner: inner, FileKey: fileKey}
+}
+
+// Init creates the database in memory and loads the file into it. A plain
+// database file is sealed right away, as is a new one.
+func (s *SealedSQLiteStore) Init() error {
+	if err := checkFileKey(s.FileKey); err != nil {
+		return err
+	}
+	if err := s.Inner.Init(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fl, err := acquireFileLock(s.Inner.DBPath+".lock", s.Inner.BusyTimeout)
+	if err != nil {
+		s.Inner.Close()
+		return err
+	}
+	defer fl.Unlock()
+
+	sealed := isSealedFile(s.Inner.DBPath)
+	if err := s.reload(); err != nil {
+		s.Inner.Close()
+		return err
+	}
+	if !sealed {
+		if err := s.save(); err != nil {
+			s.Inner.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database, which only lives in the file from now on.
+func (s *SealedSQLiteStore) Close() error {
+	return s.Inner.Close()
+}
+
+// dumpSQLite returns an SQL script recreating the database: its schema
+// version, tables with their rows, and indexes.
+func dumpSQLite(db *sql.DB) ([]byte, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	var script bytes.Buffer
+	fmt.Fprintf(&script, "PRAGMA user_version = %d;\n", version)
+
+	// Tables first, so that indexes find them
+	type object struct{ kind, name, sql string }
+	var objects []object
+	rows, err := db.Query(`SELECT type, name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY type != 'table', rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name, &o.sql); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	for _, o := range objects {
+		script.WriteString(o.sql + ";\n")
+		if o.kind != "table" {
+			continue
+		}
+		if err := dumpSQLiteRows(db, o.name, &script); err != nil {
+			return nil, err
+		}
+	}
+	return script.Bytes(), nil
+}
+
+// dumpSQLiteRows appends an INSERT statement per row of table to script.
+func dumpSQLiteRows(db *sql.DB, table string, script *bytes.Buffer) error {
+	var columns []string
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		columns = append(columns, `quote("`+strings.ReplaceAll(name, `"`, `""`)+`")`)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	table = `"` + strings.ReplaceAll(table, `"`, `""`) + `"`
+
+	// quote() renders every value as an SQL literal
+	rows, err = db.Query("SELECT " + strings.Join(columns, " || ',' || ") + " FROM " + table)
+	if err != nil {
+		return fmt.Errorf("failed to dump %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var values string
+		if err := rows.Scan(&values); err != nil {
+			return fmt.Errorf("failed to dump %s: %w", table, err)
+		}
+		fmt.Fprintf(script, "INSERT INTO %s VALUES(%s);\n", table, values)
+	}
+	return rows.Err()
+}
+
+// loadSQLite replaces all tables of the database with those of script, as
+// returned by dumpSQLite.
+func loadSQLite(db *sql.DB, script []byte) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to load database: %w", err)
+	}
+	defer tx.Rollback()
+
+	var tables []string
+	rows, err := tx.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return fmt.Errorf("failed to load database: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to load database: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	for _, table := range tables {
+		if _, err := tx.Exec(`DROP TABLE "` + strings.ReplaceAll(table, `"`, `""`) + `"`); err != nil {
+			return fmt.Errorf("failed to load database: %w", err)
+		}
+	}
+	if _, err := tx.Exec(string(script)); err != nil {
+		return fmt.Errorf("failed to load database: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to load database: %w", err)
+	}
+	return nil
+}
+
+// dumpSQLiteFile returns the dump of the plain database at path. Its
+// write-ahead log is moved into the file and removed first, so that no part
+// of the database is left behind in plain text once the file is sealed.
+func dumpSQLiteFile(path string) ([]byte, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA journal_mode=DELETE"); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return dumpSQLite(db)
+}
+
+// reload loads the file into the in-memory database if it changed since it
+// was last read or written. The caller must hold s.mu.
+func (s *SealedSQLiteStore) reload() error {
+	stamp := stampFile(s.Inner.DBPath)
+	if stamp == s.loaded {
+		return nil
+	}
+	content, err := os.ReadFile(s.Inner.DBPath)
+	if os.IsNotExist(err) || (err == nil && len(content) == 0) {
+		s.loaded = stamp
+		return nil // Nothing stored yet
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read database: %w", err)
+	}
+
+	var script []byte
+	switch {
+	case isSealed(content):
+		script, err = unsealFile(sealedSQLite, content, s.FileKey)
+	case bytes.HasPrefix(content, sqliteFileHeader):
+		script, err = dumpSQLiteFile(s.Inner.DBPath)
+	default:
+		err = fmt.Errorf("%w: '%s' is neither a sealed nor a plain SQLite database", ErrInvalidConfiguration, s.Inner.DBPath)
+	}
+	if err != nil {
+		return err
+	}
+	if err := loadSQLite(s.Inner.db, script); err != nil {
+		return err
+	}
+	// Files written by older versions are brought up to date in memory
+	if err := s.Inner.migrate(); err != nil {
+		return err
+	}
+	s.loaded = stamp
+	return nil
+}
+
+// save writes the in-memory database to the file. The caller must hold s.mu
+// and the file lock.
+func (s *SealedSQLiteStore) save() error {
+	script, err := dumpSQLite(s.Inner.db)
+	if err != nil {
+		return fmt.Errorf("failed to save database: %w", err)
+	}
+	content, err := sealFile(sealedSQLite, script, s.FileKey)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.Inner.DBPath, content); err != nil {
+		return fmt.Errorf("failed to save database: %w", err)
+	}
+	s.loaded = stampFile(s.Inner.DBPath)
+	return nil
+}
+
+// sealedRead runs a read of the in-memory database, up to date with the file.
+func sealedRead[T any](s *SealedSQLiteStore, read func() (T, error)) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		var zero T
+		return zero, err
+	}
+	return read()
+}
+
+// sealedWrite runs a change of the in-memory database under the file lock
+// and saves the result.
+func sealedWrite[T any](s *SealedSQLiteStore, write func() (T, error)) (T, error) {
+	var zero T
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fl, err := acquireFileLock(s.Inner.DBPath+".lock", s.Inner.BusyTimeout)
+	if err != nil {
+		return zero, err
+	}
+	defer fl.Unlock()
+
+	if err := s.reload(); err != nil {
+		return zero, err
+	}
+	result, err := write()
+	if err != nil {
+		// Reload next time in case the change was applied in part
+		s.loaded = fileStamp{}
+		return result, err
+	}
+	return result, s.save()
+}
+
+// noResult adapts a change without a result for sealedWrite.
+func noResult(change func() error) func() (struct{}, error) {
+	return func() (struct{}, error) { return struct{}{}, change() }
+}
+
+// setHistoryRetention sets the number of previous versions kept per secret.
+func (s *SealedSQLiteStore) setHistoryRetention(n int) {
+	s.Inner.setHistoryRetention(n)
+}
+
+// setNamespace selects the namespace the store operates on.
+func (s *SealedSQLiteStore) setNamespace(ns string) {
+	s.Inner.setNamespace(ns)
+}
+
+// Create stores a new encrypted value.
+func (s *SealedSQLiteStore) Create(key string, encryptedValue []byte) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.Create(key, encryptedValue) }))
+	return err
+}
+
+// CreateWithMetadata stores a new encrypted value and applies edit to its
+// metadata.
+func (s *SealedSQLiteStore) CreateWithMetadata(key string, encryptedValue []byte, edit MetadataEdit) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.CreateWithMetadata(key, encryptedValue, edit) }))
+	return err
+}
+
+// Read retrieves the encrypted value of key.
+func (s *SealedSQLiteStore) Read(key string) ([]byte, error) {
+	return sealedRead(s, func() ([]byte, error) { return s.Inner.Read(key) })
+}
+
+// ReadRevision retrieves the encrypted value of key with its revision.
+func (s *SealedSQLiteStore) ReadRevision(key string) ([]byte, int64, error) {
+	var revision int64
+	value, err := sealedRead(s, func() (value []byte, err error) {
+		value, revision, err = s.Inner.ReadRevision(key)
+		return value, err
+	})
+	return value, revision, err
+}
+
+// Update replaces the encrypted value of key.
+func (s *SealedSQLiteStore) Update(key string, encryptedValue []byte) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.Update(key, encryptedValue) }))
+	return err
+}
+
+// CompareAndSwap replaces the encrypted value of key if its revision is
+// expectedRevision.
+func (s *SealedSQLiteStore) CompareAndSwap(key string, expectedRevision int64, encryptedValue []byte) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.CompareAndSwap(key, expectedRevision, encryptedValue) }))
+	return err
+}
+
+// UpdateWithMetadata replaces the encrypted value of key if its revision is
+// expectedRevision, unless that is 0, and applies edit to its metadata.
+func (s *SealedSQLiteStore) UpdateWithMetadata(key string, expectedRevision int64, encryptedValue []byte, edit MetadataEdit) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.UpdateWithMetadata(key, expectedRevision, encryptedValue, edit) }))
+	return err
+}
+
+// Delete removes key.
+func (s *SealedSQLiteStore) Delete(key string) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.Delete(key) }))
+	return err
+}
+
+// ApplyBatch applies ops atomically.
+func (s *SealedSQLiteStore) ApplyBatch(ops []BatchOp) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.ApplyBatch(ops) }))
+	return err
+}
+
+// ListKeys lists the keys of the namespace.
+func (s *SealedSQLiteStore) ListKeys() ([]string, error) {
+	return sealedRead(s, s.Inner.ListKeys)
+}
+
+// ListKeysWithPrefix lists the keys of the namespace starting with prefix.
+func (s *SealedSQLiteStore) ListKeysWithPrefix(prefix string) ([]string, error) {
+	return sealedRead(s, func() ([]string, error) { return s.Inner.ListKeysWithPrefix(prefix) })
+}
+
+// ReadMetadata returns the metadata of key.
+func (s *SealedSQLiteStore) ReadMetadata(key string) (Metadata, error) {
+	return sealedRead(s, func() (Metadata, error) { return s.Inner.ReadMetadata(key) })
+}
+
+// ListMetadata returns the metadata of every secret of the namespace.
+func (s *SealedSQLiteStore) ListMetadata() (map[string]Metadata, error) {
+	return sealedRead(s, s.Inner.ListMetadata)
+}
+
+// WriteMetadata replaces the metadata of key.
+func (s *SealedSQLiteStore) WriteMetadata(key string, md Metadata) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.WriteMetadata(key, md) }))
+	return err
+}
+
+// ListVersions lists the previous versions of key.
+func (s *SealedSQLiteStore) ListVersions(key string) ([]SecretVersion, error) {
+	return sealedRead(s, func() ([]SecretVersion, error) { return s.Inner.ListVersions(key) })
+}
+
+// ReadVersion retrieves the encrypted value of a version of key.
+func (s *SealedSQLiteStore) ReadVersion(key string, version int64) ([]byte, error) {
+	return sealedRead(s, func() ([]byte, error) { return s.Inner.ReadVersion(key, version) })
+}
+
+// Trash moves key to the trash.
+func (s *SealedSQLiteStore) Trash(key string) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.Trash(key) }))
+	return err
+}
+
+// ListTrash lists the secrets in the trash.
+func (s *SealedSQLiteStore) ListTrash() ([]TrashedSecret, error) {
+	return sealedRead(s, s.Inner.ListTrash)
+}
+
+// Restore moves key back from the trash.
+func (s *SealedSQLiteStore) Restore(key string) error {
+	_, err := sealedWrite(s, noResult(func() error { return s.Inner.Restore(key) }))
+	return err
+}
+
+// Purge removes the secrets deleted before before from the trash.
+func (s *SealedSQLiteStore) Purge(before time.Time) ([]string, error) {
+	return sealedWrite(s, func() ([]string, error) { return s.Inner.Purge(before) })
+}
+
+// ListNamespaces lists the namespaces holding secrets.
+func (s *SealedSQLiteStore) ListNamespaces() ([]string, error) {
+	return sealedRead(s, s.Inner.ListNamespaces)
+}
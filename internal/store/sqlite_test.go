@@ -0,0 +1,184 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStoreMigratesLegacyTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE secrets (key TEXT UNIQUE NOT NULL, value BLOB NOT NULL);
+        INSERT INTO secrets (key, value) VALUES ('db_password', x'00ff');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init of legacy database failed: %v", err)
+	}
+	defer s.Close()
+
+	value, err := s.Read("db_password")
+	if err != nil || string(value) != "\x00\xff" {
+		t.Fatalf("Read of legacy row = %q, %v", value, err)
+	}
+	md, err := s.ReadMetadata("db_password")
+	if err != nil || !md.CreatedAt.IsZero() {
+		t.Fatalf("ReadMetadata of legacy row = %+v, %v; want zero metadata", md, err)
+	}
+	if err := s.WriteMetadata("db_password", Metadata{Description: "migrated"}); err != nil {
+		t.Fatalf("WriteMetadata on migrated table failed: %v", err)
+	}
+
+	// Re-opening an already migrated database is a no-op
+	s.Close()
+	if err := s.Init(); err != nil {
+		t.Fatalf("second Init failed: %v", err)
+	}
+	if md, err := s.ReadMetadata("db_password"); err != nil || md.Description != "migrated" {
+		t.Fatalf("ReadMetadata after reopen = %+v, %v", md, err)
+	}
+}
+
+func TestSQLiteStoreMigratesToNamespaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE secrets (key TEXT UNIQUE NOT NULL, value BLOB NOT NULL, created_at TEXT,
+            updated_at TEXT, created_by TEXT, description TEXT, tags TEXT, version INTEGER, expires_at TEXT);
+        CREATE TABLE secrets_history (key TEXT NOT NULL, version INTEGER NOT NULL, value BLOB NOT NULL,
+            created_at TEXT, PRIMARY KEY (key, version));
+        CREATE TABLE secrets_trash (key TEXT PRIMARY KEY, value BLOB NOT NULL, metadata TEXT, history TEXT,
+            deleted_at TEXT NOT NULL);
+        INSERT INTO secrets (key, value, description, version) VALUES ('db_password', x'02', 'kept', 2);
+        INSERT INTO secrets_history (key, version, value) VALUES ('db_password', 1, x'01');
+        INSERT INTO secrets_trash (key, value, deleted_at) VALUES ('old_token', x'03', '2024-01-01T00:00:00Z');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init of database without namespaces failed: %v", err)
+	}
+	defer s.Close()
+
+	if md, err := s.ReadMetadata("db_password"); err != nil || md.Description != "kept" || md.Version != 2 {
+		t.Fatalf("ReadMetadata of migrated row = %+v, %v", md, err)
+	}
+	if versions, err := s.ListVersions("db_password"); err != nil || len(versions) != 1 || versions[0].Version != 1 {
+		t.Fatalf("ListVersions of migrated row = %+v, %v", versions, err)
+	}
+	if trashed, err := s.ListTrash(); err != nil || len(trashed) != 1 || trashed[0].Key != "old_token" {
+		t.Fatalf("ListTrash after migration = %+v, %v", trashed, err)
+	}
+
+	// The old unique constraint on key alone is gone
+	s.setNamespace("payments")
+	if err := s.Create("db_password", []byte("other")); err != nil {
+		t.Fatalf("Create of migrated key in another namespace failed: %v", err)
+	}
+}
+
+func TestSQLiteStoreSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.db")
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Table = "vault"
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer s.Close()
+	if err := s.Create("db_password", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+
+	var version int
+	var journalMode string
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != len(sqliteMigrations) {
+		t.Errorf("user_version = %d, %v; want %d", version, err, len(sqliteMigrations))
+	}
+	if err := s.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Errorf("journal_mode = %q, %v; want wal", journalMode, err)
+	}
+	for _, table := range []string{"vault", "vault_history", "vault_trash"} {
+		if columns, err := s.columns(s.db, table); err != nil || len(columns) == 0 {
+			t.Errorf("table %s has columns %v, %v", table, columns, err)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("database file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	// A database written by a newer version is refused
+	if _, err := s.db.Exec("PRAGMA user_version = 99"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if err := s.Init(); err == nil {
+		t.Fatal("Init of database with newer schema version succeeded")
+	}
+}
+
+func TestSQLiteStoreInvalidSettings(t *testing.T) {
+	for _, tweak := range []func(s *SQLiteStore){
+		func(s *SQLiteStore) { s.Table = "secrets; DROP TABLE secrets" },
+		func(s *SQLiteStore) { s.JournalMode = "off" },
+		func(s *SQLiteStore) { s.BusyTimeout = -1 },
+	} {
+		s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "secrets.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweak(s)
+		if err := s.Init(); !errors.Is(err, ErrInvalidConfiguration) {
+			s.Close()
+			t.Errorf("Init with %+v = %v, want ErrInvalidConfiguration", s, err)
+		}
+	}
+}
+
+func TestSQLiteStoreDeleteIsAtomic(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "secrets.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Create("db", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the second statement of the delete fail
+	if _, err := s.db.Exec("DROP TABLE " + s.historyTable()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("db"); err == nil {
+		t.Fatal("Delete without a history table succeeded")
+	}
+	if value, err := s.Read("db"); err != nil || string(value) != "v1" {
+		t.Fatalf("Read after a failed delete = %q, %v, want the secret kept", value, err)
+	}
+}
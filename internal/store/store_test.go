@@ -0,0 +1,277 @@
+package store_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"secrets-cli/internal/store"
+	"secrets-cli/internal/store/storetest"
+)
+
+// initStore initializes s and closes it when the test ends.
+func initStore(t *testing.T, s store.SecretStore) store.SecretStore {
+	t.Helper()
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	})
+	return s
+}
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		return initStore(t, store.NewMemoryStore())
+	})
+}
+
+func TestJSONFileStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		s, err := store.NewJSONFileStore(filepath.Join(t.TempDir(), "secrets.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return initStore(t, s)
+	})
+}
+
+func TestJSONFileJournalStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		s, err := store.NewJSONFileStore(filepath.Join(t.TempDir(), "secrets.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Format = store.JSONFormatJournal
+		s.JournalKey = []byte("journal-test-key")
+		s.CompactRecords = 3 // Compact now and then during the tests
+		return initStore(t, s)
+	})
+}
+
+func TestJSONFileSealedStore(t *testing.T) {
+	for _, format := range []string{store.JSONFormatDocument, store.JSONFormatJournal} {
+		t.Run(format, func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T) store.SecretStore {
+				s, err := store.NewJSONFileStore(filepath.Join(t.TempDir(), "secrets.json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.Format = format
+				s.JournalKey = []byte("journal-test-key")
+				s.Seal = true
+				s.FileKey = bytes.Repeat([]byte{1}, 32)
+				return initStore(t, s)
+			})
+		})
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		s, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "secrets.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return initStore(t, s)
+	})
+}
+
+func TestSealedSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		s, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "secrets.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return initStore(t, store.NewSealedSQLiteStore(s, bytes.Repeat([]byte{1}, 32)))
+	})
+}
+
+func TestBoltStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		s, err := store.NewBoltStore(filepath.Join(t.TempDir(), "secrets.bolt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return initStore(t, s)
+	})
+}
+
+func TestDirStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		s, err := store.NewDirStore(filepath.Join(t.TempDir(), "secrets"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return initStore(t, s)
+	})
+}
+
+func TestDirStoreConcurrentCompareAndSwap(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "secrets")
+	newStore := func() *store.DirStore {
+		s, err := store.NewDirStore(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		initStore(t, s)
+		return s
+	}
+	if err := newStore().Create("db", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// One store per writer, as if each ran in its own process
+	const writers = 8
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		s := newStore()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.CompareAndSwap("db", 1, []byte(fmt.Sprintf("writer %d", i)))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	swapped := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			swapped++
+		case !errors.Is(err, store.ErrRevisionMismatch):
+			t.Fatalf("CompareAndSwap = %v, want nil or ErrRevisionMismatch", err)
+		}
+	}
+	if swapped != 1 {
+		t.Fatalf("%d writers swapped revision 1, want exactly one", swapped)
+	}
+}
+
+func TestGitStore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		root := t.TempDir()
+		if output, err := exec.Command("git", "init", "--quiet", root).CombinedOutput(); err != nil {
+			t.Fatalf("git init failed: %v: %s", err, output)
+		}
+		inner, err := store.NewDirStore(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := store.NewGitStore(inner, root, []string{"."}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return initStore(t, s)
+	})
+}
+
+// newTestRemote returns a RemoteStore talking to a test server that serves
+// a memory store per namespace and requires token.
+func newTestRemote(t *testing.T, token string) *store.RemoteStore {
+	t.Helper()
+	server := store.NewRemoteServer(func(string) (store.SecretStore, error) {
+		s := store.NewMemoryStore()
+		return s, s.Init()
+	}, token)
+	ts := httptest.NewTLSServer(server.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		server.Close()
+	})
+
+	s, err := store.NewRemoteStore(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	s.TLS = &tls.Config{RootCAs: pool}
+	s.Token = token
+	return s
+}
+
+func TestRemoteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.SecretStore {
+		return initStore(t, newTestRemote(t, "test-token"))
+	})
+}
+
+// racingStore updates a secret while a previous version of it is read.
+type racingStore struct {
+	*store.MemoryStore
+}
+
+func (s racingStore) ReadVersion(key string, version int64) ([]byte, error) {
+	if err := s.Update(key, []byte("concurrent")); err != nil {
+		return nil, err
+	}
+	return s.MemoryStore.ReadVersion(key, version)
+}
+
+func TestRollbackConcurrentUpdate(t *testing.T) {
+	s := racingStore{store.NewMemoryStore()}
+	if err := s.Create("db", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update("db", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Rollback(s, "db", 1); !errors.Is(err, store.ErrRevisionMismatch) {
+		t.Fatalf("Rollback during an update = %v, want ErrRevisionMismatch", err)
+	}
+	if value, err := s.Read("db"); err != nil || string(value) != "concurrent" {
+		t.Fatalf("Read after a failed rollback = %q, %v, want the concurrent update", value, err)
+	}
+}
+
+func TestSameStore(t *testing.T) {
+	previous := []string{store.BackendType, store.SqliteDBPath, store.Overlay}
+	t.Cleanup(func() {
+		store.BackendType, store.SqliteDBPath, store.Overlay = previous[0], previous[1], previous[2]
+	})
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.BackendType, store.SqliteDBPath, store.Overlay = "sqlite", "secrets.db", ""
+
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"", "sqlite:secrets.db", true},
+		{"", "sqlite:" + filepath.Join(wd, "secrets.db"), true},
+		{"sqlite:./data/../secrets.db", "", true},
+		{"", "sqlite:other.db", false},
+		{"", "jsonfile:secrets.db", false},
+		{"remote:https://vault/", "remote:https://vault", true},
+		{"bolt:a.bolt", "bolt:b.bolt", false},
+	}
+	for _, tt := range tests {
+		same, err := store.SameStore(tt.a, tt.b)
+		if err != nil || same != tt.want {
+			t.Errorf("SameStore(%q, %q) = %v, %v, want %v", tt.a, tt.b, same, err, tt.want)
+		}
+	}
+	if _, err := store.SameStore("sqlite", ""); !errors.Is(err, store.ErrInvalidConfiguration) {
+		t.Errorf("SameStore of a spec without location = %v, want ErrInvalidConfiguration", err)
+	}
+}
@@ -0,0 +1,1057 @@
+// Package storetest provides a conformance suite that every store.SecretStore
+// implementation is expected to pass.
+//
+// A backend test only needs to supply a factory returning a fresh, initialized
+// store:
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.SecretStore {
+//			s, err := NewMyStore(t.TempDir())
+//			...
+//			return s
+//		})
+//	}
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"secrets-cli/internal/store"
+)
+
+// Factory returns a new, empty and initialized store. The factory is
+// responsible for registering any cleanup (closing, removing files) with t.
+type Factory func(t *testing.T) store.SecretStore
+
+// concurrency is the number of goroutines used by the concurrency tests.
+const concurrency = 16
+
+// Run executes the full conformance suite against stores created by newStore.
+// Every subtest gets its own store.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.SecretStore)
+	}{
+		{"CreateRead", testCreateRead},
+		{"CreateDuplicate", testCreateDuplicate},
+		{"CreateEmptyKey", testCreateEmptyKey},
+		{"ReadMissing", testReadMissing},
+		{"Update", testUpdate},
+		{"UpdateMissing", testUpdateMissing},
+		{"Delete", testDelete},
+		{"DeleteMissing", testDeleteMissing},
+		{"ListKeys", testListKeys},
+		{"ListKeysEmpty", testListKeysEmpty},
+		{"ListKeysWithPrefix", testListKeysWithPrefix},
+		{"ReturnedValueIsCopy", testReturnedValueIsCopy},
+		{"UnicodeKeys", testUnicodeKeys},
+		{"LongKey", testLongKey},
+		{"LargeValue", testLargeValue},
+		{"BinaryValue", testBinaryValue},
+		{"ConcurrentCreate", testConcurrentCreate},
+		{"ConcurrentCreateSameKey", testConcurrentCreateSameKey},
+		{"ConcurrentUpdate", testConcurrentUpdate},
+		{"MetadataTimestamps", testMetadataTimestamps},
+		{"MetadataRoundTrip", testMetadataRoundTrip},
+		{"MetadataKeepsRevision", testMetadataKeepsRevision},
+		{"MetadataMissing", testMetadataMissing},
+		{"MetadataDeletedWithSecret", testMetadataDeletedWithSecret},
+		{"MetadataEdit", testMetadataEdit},
+		{"ListMetadata", testListMetadata},
+		{"HistoryVersions", testHistoryVersions},
+		{"HistoryRetention", testHistoryRetention},
+		{"HistoryMissing", testHistoryMissing},
+		{"HistoryDeletedWithSecret", testHistoryDeletedWithSecret},
+		{"Rollback", testRollback},
+		{"TrashRestore", testTrashRestore},
+		{"TrashMissing", testTrashMissing},
+		{"TrashKeepsOlderCopy", testTrashKeepsOlderCopy},
+		{"RestoreMissing", testRestoreMissing},
+		{"RestoreExisting", testRestoreExisting},
+		{"Purge", testPurge},
+		{"CompareAndSwap", testCompareAndSwap},
+		{"CompareAndSwapStale", testCompareAndSwapStale},
+		{"CompareAndSwapMissing", testCompareAndSwapMissing},
+		{"Batch", testBatch},
+		{"BatchRollback", testBatchRollback},
+		{"BatchMetadata", testBatchMetadata},
+		{"ContextExistsUpsert", testContextExistsUpsert},
+		{"ContextBatchGet", testContextBatchGet},
+		{"ContextListPages", testContextListPages},
+		{"ContextCanceled", testContextCanceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// mustCreate creates a secret and fails the test on error.
+func mustCreate(t *testing.T, s store.SecretStore, key string, value []byte) {
+	t.Helper()
+	if err := s.Create(key, value); err != nil {
+		t.Fatalf("Create(%q) failed: %v", key, err)
+	}
+}
+
+// assertValue reads a secret and compares it with want.
+func assertValue(t *testing.T, s store.SecretStore, key string, want []byte) {
+	t.Helper()
+	got, err := s.Read(key)
+	if err != nil {
+		t.Fatalf("Read(%q) failed: %v", key, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Read(%q) = %q, want %q", key, got, want)
+	}
+}
+
+// assertKeys compares the listed keys with want, ignoring order.
+func assertKeys(t *testing.T, s store.SecretStore, want ...string) {
+	t.Helper()
+	got, err := s.ListKeys()
+	if err != nil {
+		t.Fatalf("ListKeys failed: %v", err)
+	}
+	got = slices.Clone(got)
+	want = slices.Clone(want)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("ListKeys = %q, want %q", got, want)
+	}
+}
+
+// metadataStore returns s as a MetadataStore or skips the test.
+func metadataStore(t *testing.T, s store.SecretStore) store.MetadataStore {
+	t.Helper()
+	ms, ok := s.(store.MetadataStore)
+	if !ok {
+		t.Skip("backend does not implement store.MetadataStore")
+	}
+	return ms
+}
+
+// versionedStore returns s as a VersionedStore or skips the test.
+func versionedStore(t *testing.T, s store.SecretStore) store.VersionedStore {
+	t.Helper()
+	vs, ok := s.(store.VersionedStore)
+	if !ok {
+		t.Skip("backend does not implement store.VersionedStore")
+	}
+	return vs
+}
+
+// mustUpdate updates key or fails the test.
+func mustUpdate(t *testing.T, s store.SecretStore, key string, value []byte) {
+	t.Helper()
+	if err := s.Update(key, value); err != nil {
+		t.Fatalf("Update(%q) failed: %v", key, err)
+	}
+}
+
+// assertVersions checks the version numbers returned by ListVersions.
+func assertVersions(t *testing.T, vs store.VersionedStore, key string, want ...int64) {
+	t.Helper()
+	versions, err := vs.ListVersions(key)
+	if err != nil {
+		t.Fatalf("ListVersions(%q) failed: %v", key, err)
+	}
+	got := make([]int64, 0, len(versions))
+	for _, v := range versions {
+		got = append(got, v.Version)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("ListVersions(%q) = versions %v, want %v", key, got, want)
+	}
+}
+
+// trashStore returns s as a TrashStore or skips the test.
+func trashStore(t *testing.T, s store.SecretStore) store.TrashStore {
+	t.Helper()
+	ts, ok := s.(store.TrashStore)
+	if !ok {
+		t.Skip("backend does not implement store.TrashStore")
+	}
+	return ts
+}
+
+// revisionStore returns s as a RevisionStore or skips the test.
+func revisionStore(t *testing.T, s store.SecretStore) store.RevisionStore {
+	t.Helper()
+	rs, ok := s.(store.RevisionStore)
+	if !ok {
+		t.Skip("backend does not implement store.RevisionStore")
+	}
+	return rs
+}
+
+// batchStore returns s as a BatchStore or skips the test.
+func batchStore(t *testing.T, s store.SecretStore) store.BatchStore {
+	t.Helper()
+	bs, ok := s.(store.BatchStore)
+	if !ok {
+		t.Skip("backend does not implement store.BatchStore")
+	}
+	return bs
+}
+
+// applyBatch applies ops and skips the test if a wrapping store finds that
+// the backend it wraps can't apply batches.
+func applyBatch(t *testing.T, bs store.BatchStore, ops []store.BatchOp) error {
+	t.Helper()
+	err := bs.ApplyBatch(ops)
+	if errors.Is(err, store.ErrNotSupported) {
+		t.Skipf("ApplyBatch: %v", err)
+	}
+	return err
+}
+
+// assertRevision checks the value and revision returned by ReadRevision.
+func assertRevision(t *testing.T, rs store.RevisionStore, key string, want []byte, wantRevision int64) {
+	t.Helper()
+	got, revision, err := rs.ReadRevision(key)
+	if err != nil {
+		t.Fatalf("ReadRevision(%q) failed: %v", key, err)
+	}
+	if !bytes.Equal(got, want) || revision != wantRevision {
+		t.Fatalf("ReadRevision(%q) = %q at revision %d, want %q at revision %d", key, got, revision, want, wantRevision)
+	}
+}
+
+// assertTrash checks the keys returned by ListTrash.
+func assertTrash(t *testing.T, ts store.TrashStore, want ...string) {
+	t.Helper()
+	trashed, err := ts.ListTrash()
+	if err != nil {
+		t.Fatalf("ListTrash failed: %v", err)
+	}
+	got := make([]string, 0, len(trashed))
+	for _, tr := range trashed {
+		if tr.DeletedAt.IsZero() {
+			t.Errorf("ListTrash returned %q without a deletion time", tr.Key)
+		}
+		got = append(got, tr.Key)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("ListTrash = %q, want %q", got, want)
+	}
+}
+
+// assertErrorIs fails the test unless err wraps target.
+func assertErrorIs(t *testing.T, op string, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("%s: got error %v, want one wrapping %q", op, err, target)
+	}
+}
+
+func testCreateRead(t *testing.T, s store.SecretStore) {
+	mustCreate(t, s, "db_password", []byte("ciphertext"))
+	assertValue(t, s, "db_password", []byte("ciphertext"))
+}
+
+func testCreateDuplicate(t *testing.T, s store.SecretStore) {
+	mustCreate(t, s, "dup", []byte("first"))
+	err := s.Create("dup", []byte("second"))
+	assertErrorIs(t, "Create of existing key", err, store.ErrSecretAlreadyExists)
+	assertValue(t, s, "dup", []byte("first"))
+}
+
+func testCreateEmptyKey(t *testing.T, s store.SecretStore) {
+	err := s.Create("", []byte("value"))
+	assertErrorIs(t, "Create with empty key", err, store.ErrInvalidKey)
+	assertKeys(t, s)
+}
+
+func testReadMissing(t *testing.T, s store.SecretStore) {
+	_, err := s.Read("missing")
+	assertErrorIs(t, "Read of missing key", err, store.ErrSecretNotFound)
+}
+
+func testUpdate(t *testing.T, s store.SecretStore) {
+	mustCreate(t, s, "rotated", []byte("old"))
+	if err := s.Update("rotated", []byte("new")); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	assertValue(t, s, "rotated", []byte("new"))
+	assertKeys(t, s, "rotated")
+}
+
+func testUpdateMissing(t *testing.T, s store.SecretStore) {
+	err := s.Update("missing", []byte("value"))
+	assertErrorIs(t, "Update of missing key", err, store.ErrSecretNotFound)
+	assertKeys(t, s)
+}
+
+func testDelete(t *testing.T, s store.SecretStore) {
+	mustCreate(t, s, "gone", []byte("value"))
+	mustCreate(t, s, "kept", []byte("value"))
+	if err := s.Delete("gone"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	_, err := s.Read("gone")
+	assertErrorIs(t, "Read after Delete", err, store.ErrSecretNotFound)
+	assertKeys(t, s, "kept")
+
+	// A deleted key can be created again
+	mustCreate(t, s, "gone", []byte("again"))
+	assertValue(t, s, "gone", []byte("again"))
+}
+
+func testDeleteMissing(t *testing.T, s store.SecretStore) {
+	err := s.Delete("missing")
+	assertErrorIs(t, "Delete of missing key", err, store.ErrSecretNotFound)
+}
+
+func testListKeys(t *testing.T, s store.SecretStore) {
+	keys := []string{"b", "a", "c/d", "c/e"}
+	for _, key := range keys {
+		mustCreate(t, s, key, []byte("value-"+key))
+	}
+	assertKeys(t, s, keys...)
+}
+
+func testListKeysWithPrefix(t *testing.T, s store.SecretStore) {
+	for _, key := range []string{"prod/db/password", "prod/db/user", "prod/api", "production", "prod_x", "staging/db/password"} {
+		mustCreate(t, s, key, []byte("value-"+key))
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"prod/", []string{"prod/api", "prod/db/password", "prod/db/user"}},
+		{"prod/db/", []string{"prod/db/password", "prod/db/user"}},
+		{"prod", []string{"prod/api", "prod/db/password", "prod/db/user", "prod_x", "production"}},
+		{"prod_", []string{"prod_x"}},
+		{"Prod/", nil},
+		{"prod/*", nil},
+		{"missing/", nil},
+		{"../", nil},
+	}
+	for _, tt := range tests {
+		got, err := store.ListKeysWithPrefix(s, tt.prefix)
+		if err != nil {
+			t.Fatalf("ListKeysWithPrefix(%q) failed: %v", tt.prefix, err)
+		}
+		got = slices.Clone(got)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ListKeysWithPrefix(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func testListKeysEmpty(t *testing.T, s store.SecretStore) {
+	assertKeys(t, s)
+}
+
+func testReturnedValueIsCopy(t *testing.T, s store.SecretStore) {
+	value := []byte("original")
+	mustCreate(t, s, "copy", value)
+	value[0] = 'X'
+
+	got, err := s.Read("copy")
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	got[0] = 'Y'
+	assertValue(t, s, "copy", []byte("original"))
+}
+
+func testUnicodeKeys(t *testing.T, s store.SecretStore) {
+	keys := []string{"пароль", "秘密/鍵", "emoji-🔑", "with space", "quote'and\"double"}
+	for _, key := range keys {
+		mustCreate(t, s, key, []byte(key))
+	}
+	for _, key := range keys {
+		assertValue(t, s, key, []byte(key))
+	}
+	assertKeys(t, s, keys...)
+}
+
+func testLongKey(t *testing.T, s store.SecretStore) {
+	// 200 bytes stays below the common 255 byte file name limit
+	key := strings.Repeat("k", 200)
+	mustCreate(t, s, key, []byte("value"))
+	assertValue(t, s, key, []byte("value"))
+	assertKeys(t, s, key)
+}
+
+func testLargeValue(t *testing.T, s store.SecretStore) {
+	value := bytes.Repeat([]byte("0123456789abcdef"), 64*1024) // 1 MiB
+	mustCreate(t, s, "large", value)
+	assertValue(t, s, "large", value)
+}
+
+func testBinaryValue(t *testing.T, s store.SecretStore) {
+	value := make([]byte, 256)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	mustCreate(t, s, "binary", value)
+	assertValue(t, s, "binary", value)
+}
+
+func testConcurrentCreate(t *testing.T, s store.SecretStore) {
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrency)
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("concurrent-%d", i)
+			if err := s.Create(key, []byte(key)); err != nil {
+				errs <- fmt.Errorf("Create(%q): %w", key, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	want := make([]string, 0, concurrency)
+	for i := range concurrency {
+		key := fmt.Sprintf("concurrent-%d", i)
+		want = append(want, key)
+		assertValue(t, s, key, []byte(key))
+	}
+	assertKeys(t, s, want...)
+}
+
+func testConcurrentCreateSameKey(t *testing.T, s store.SecretStore) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Create("contended", []byte(fmt.Sprintf("writer-%d", i)))
+			switch {
+			case err == nil:
+				mu.Lock()
+				created++
+				mu.Unlock()
+			case !errors.Is(err, store.ErrSecretAlreadyExists):
+				t.Errorf("Create: unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Fatalf("%d concurrent Create calls succeeded, want exactly 1", created)
+	}
+	assertKeys(t, s, "contended")
+}
+
+func testConcurrentUpdate(t *testing.T, s store.SecretStore) {
+	mustCreate(t, s, "shared", []byte("initial"))
+
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Update("shared", []byte(fmt.Sprintf("writer-%d", i))); err != nil {
+				t.Errorf("Update: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := s.Read("shared")
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !bytes.HasPrefix(got, []byte("writer-")) {
+		t.Fatalf("Read after concurrent updates = %q, want one of the written values", got)
+	}
+}
+
+func testMetadataTimestamps(t *testing.T, s store.SecretStore) {
+	ms := metadataStore(t, s)
+
+	before := time.Now().Add(-time.Second)
+	mustCreate(t, ms, "stamped", []byte("v1"))
+	created, err := ms.ReadMetadata("stamped")
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if created.CreatedAt.Before(before) || created.CreatedAt.After(time.Now()) {
+		t.Fatalf("CreatedAt = %v, want the time of Create", created.CreatedAt)
+	}
+	if !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("UpdatedAt = %v after Create, want CreatedAt %v", created.UpdatedAt, created.CreatedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := ms.Update("stamped", []byte("v2")); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	updated, err := ms.ReadMetadata("stamped")
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("CreatedAt changed by Update: %v -> %v", created.CreatedAt, updated.CreatedAt)
+	}
+	if !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Fatalf("UpdatedAt not advanced by Update: %v -> %v", created.UpdatedAt, updated.UpdatedAt)
+	}
+}
+
+func testMetadataRoundTrip(t *testing.T, s store.SecretStore) {
+	ms := metadataStore(t, s)
+	mustCreate(t, ms, "described", []byte("value"))
+
+	md, err := ms.ReadMetadata("described")
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	md.CreatedBy = "alice"
+	md.Description = "Primary database password ✓"
+	md.Tags = map[string]string{"env": "prod", "team": "payments"}
+	md.ExpiresAt = md.CreatedAt.Add(90 * 24 * time.Hour)
+	md.RotateEvery = "90d"
+	if err := ms.WriteMetadata("described", md); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+
+	got, err := ms.ReadMetadata("described")
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if got.CreatedBy != md.CreatedBy || got.Description != md.Description || got.RotateEvery != md.RotateEvery ||
+		!got.CreatedAt.Equal(md.CreatedAt) || !got.UpdatedAt.Equal(md.UpdatedAt) || !got.ExpiresAt.Equal(md.ExpiresAt) {
+		t.Fatalf("ReadMetadata = %+v, want %+v", got, md)
+	}
+	if len(got.Tags) != len(md.Tags) || got.Tags["env"] != "prod" || got.Tags["team"] != "payments" {
+		t.Fatalf("ReadMetadata tags = %v, want %v", got.Tags, md.Tags)
+	}
+	assertValue(t, ms, "described", []byte("value"))
+}
+
+func testMetadataKeepsRevision(t *testing.T, s store.SecretStore) {
+	ms := metadataStore(t, s)
+	mustCreate(t, ms, "revised", []byte("v1"))
+	mustUpdate(t, ms, "revised", []byte("v2"))
+
+	if err := ms.WriteMetadata("revised", store.Metadata{Description: "reset", Version: 7}); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+	assertDescription(t, ms, "revised", "reset", 2)
+	if err := ms.WriteMetadata("revised", store.Metadata{Description: "cleared"}); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+	assertDescription(t, ms, "revised", "cleared", 2)
+}
+
+func testMetadataMissing(t *testing.T, s store.SecretStore) {
+	ms := metadataStore(t, s)
+	_, err := ms.ReadMetadata("missing")
+	assertErrorIs(t, "ReadMetadata of missing key", err, store.ErrSecretNotFound)
+	err = ms.WriteMetadata("missing", store.Metadata{Description: "x"})
+	assertErrorIs(t, "WriteMetadata of missing key", err, store.ErrSecretNotFound)
+}
+
+func testMetadataDeletedWithSecret(t *testing.T, s store.SecretStore) {
+	ms := metadataStore(t, s)
+	mustCreate(t, ms, "recreated", []byte("value"))
+	if err := ms.WriteMetadata("recreated", store.Metadata{Description: "old description"}); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+	if err := ms.Delete("recreated"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	mustCreate(t, ms, "recreated", []byte("value"))
+
+	md, err := ms.ReadMetadata("recreated")
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if md.Description != "" || md.CreatedAt.IsZero() {
+		t.Fatalf("metadata after delete and create = %+v, want a fresh record", md)
+	}
+}
+
+func testListMetadata(t *testing.T, s store.SecretStore) {
+	ms := metadataStore(t, s)
+	mustCreate(t, ms, "described", []byte("value"))
+	mustCreate(t, ms, "plain", []byte("value"))
+	if err := ms.WriteMetadata("described", store.Metadata{Description: "database", RotateEvery: "30d"}); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+
+	all, err := store.ListMetadata(ms)
+	if err != nil {
+		t.Fatalf("ListMetadata failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("ListMetadata returned %d secrets, want 2: %+v", len(all), all)
+	}
+	if md := all["described"]; md.Description != "database" || md.RotateEvery != "30d" {
+		t.Fatalf("ListMetadata()[described] = %+v, want the written metadata", md)
+	}
+	if md, ok := all["plain"]; !ok || md.CreatedAt.IsZero() {
+		t.Fatalf("ListMetadata()[plain] = %+v, %v, want its creation time", md, ok)
+	}
+}
+
+// describe returns a MetadataEdit setting the description, which also tries
+// to change the revision.
+func describe(description string) store.MetadataEdit {
+	return func(md *store.Metadata) {
+		md.Description = description
+		md.Version = 99
+	}
+}
+
+// assertDescription checks the description and revision of a secret.
+func assertDescription(t *testing.T, ms store.MetadataStore, key, want string, wantVersion int64) {
+	t.Helper()
+	md, err := ms.ReadMetadata(key)
+	if err != nil {
+		t.Fatalf("ReadMetadata(%q) failed: %v", key, err)
+	}
+	if md.Description != want || md.Version != wantVersion {
+		t.Fatalf("ReadMetadata(%q) = description %q at version %d, want %q at version %d", key, md.Description, md.Version, want, wantVersion)
+	}
+}
+
+func testMetadataEdit(t *testing.T, s store.SecretStore) {
+	ms := metadataStore(t, s)
+	if err := store.CreateWithMetadata(ms, "k", []byte("v1"), describe("first")); err != nil {
+		t.Fatalf("CreateWithMetadata failed: %v", err)
+	}
+	assertValue(t, ms, "k", []byte("v1"))
+	assertDescription(t, ms, "k", "first", 1)
+
+	if err := store.UpdateWithMetadata(ms, "k", 0, []byte("v2"), describe("second")); err != nil {
+		t.Fatalf("UpdateWithMetadata failed: %v", err)
+	}
+	assertValue(t, ms, "k", []byte("v2"))
+	assertDescription(t, ms, "k", "second", 2)
+
+	if err := store.UpdateWithMetadata(ms, "k", 0, []byte("v3"), nil); err != nil {
+		t.Fatalf("UpdateWithMetadata without an edit failed: %v", err)
+	}
+	assertDescription(t, ms, "k", "second", 3)
+
+	err := store.CreateWithMetadata(ms, "k", []byte("v"), describe("duplicate"))
+	assertErrorIs(t, "CreateWithMetadata of existing key", err, store.ErrSecretAlreadyExists)
+	assertDescription(t, ms, "k", "second", 3)
+
+	if _, ok := s.(store.RevisionStore); ok {
+		err = store.UpdateWithMetadata(ms, "k", 1, []byte("stale"), describe("stale"))
+		assertErrorIs(t, "UpdateWithMetadata at stale revision", err, store.ErrRevisionMismatch)
+		assertValue(t, ms, "k", []byte("v3"))
+		assertDescription(t, ms, "k", "second", 3)
+	}
+}
+
+func testHistoryVersions(t *testing.T, s store.SecretStore) {
+	vs := versionedStore(t, s)
+	mustCreate(t, vs, "rotated", []byte("v1"))
+	assertVersions(t, vs, "rotated")
+
+	mustUpdate(t, vs, "rotated", []byte("v2"))
+	mustUpdate(t, vs, "rotated", []byte("v3"))
+	assertVersions(t, vs, "rotated", 2, 1)
+
+	md, err := vs.ReadMetadata("rotated")
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if md.Version != 3 {
+		t.Fatalf("Version after two updates = %d, want 3", md.Version)
+	}
+	for version, want := range map[int64]string{1: "v1", 2: "v2", 3: "v3"} {
+		got, err := vs.ReadVersion("rotated", version)
+		if err != nil {
+			t.Fatalf("ReadVersion(%d) failed: %v", version, err)
+		}
+		if string(got) != want {
+			t.Fatalf("ReadVersion(%d) = %q, want %q", version, got, want)
+		}
+	}
+	_, err = vs.ReadVersion("rotated", 4)
+	assertErrorIs(t, "ReadVersion of a future version", err, store.ErrVersionNotFound)
+}
+
+func testHistoryRetention(t *testing.T, s store.SecretStore) {
+	vs := versionedStore(t, s)
+	mustCreate(t, vs, "rotated", []byte("v1"))
+	for i := 2; i <= store.DefaultHistoryRetention+3; i++ {
+		mustUpdate(t, vs, "rotated", []byte(fmt.Sprintf("v%d", i)))
+	}
+
+	versions, err := vs.ListVersions("rotated")
+	if err != nil {
+		t.Fatalf("ListVersions failed: %v", err)
+	}
+	if len(versions) != store.DefaultHistoryRetention {
+		t.Fatalf("ListVersions returned %d versions, want %d", len(versions), store.DefaultHistoryRetention)
+	}
+	if versions[0].Version != int64(store.DefaultHistoryRetention+2) {
+		t.Fatalf("newest previous version = %d, want %d", versions[0].Version, store.DefaultHistoryRetention+2)
+	}
+	_, err = vs.ReadVersion("rotated", 1)
+	assertErrorIs(t, "ReadVersion of a pruned version", err, store.ErrVersionNotFound)
+}
+
+func testHistoryMissing(t *testing.T, s store.SecretStore) {
+	vs := versionedStore(t, s)
+	_, err := vs.ListVersions("missing")
+	assertErrorIs(t, "ListVersions of a missing key", err, store.ErrSecretNotFound)
+	_, err = vs.ReadVersion("missing", 1)
+	assertErrorIs(t, "ReadVersion of a missing key", err, store.ErrSecretNotFound)
+}
+
+func testHistoryDeletedWithSecret(t *testing.T, s store.SecretStore) {
+	vs := versionedStore(t, s)
+	mustCreate(t, vs, "recreated", []byte("v1"))
+	mustUpdate(t, vs, "recreated", []byte("v2"))
+	if err := vs.Delete("recreated"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	mustCreate(t, vs, "recreated", []byte("fresh"))
+
+	assertVersions(t, vs, "recreated")
+	_, err := vs.ReadVersion("recreated", 2)
+	assertErrorIs(t, "ReadVersion after delete and create", err, store.ErrVersionNotFound)
+}
+
+func testRollback(t *testing.T, s store.SecretStore) {
+	vs := versionedStore(t, s)
+	mustCreate(t, vs, "rotated", []byte("good"))
+	mustUpdate(t, vs, "rotated", []byte("botched"))
+
+	if err := store.Rollback(vs, "rotated", 1); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	assertValue(t, vs, "rotated", []byte("good"))
+	// The rolled back value stays available
+	assertVersions(t, vs, "rotated", 2, 1)
+	got, err := vs.ReadVersion("rotated", 2)
+	if err != nil || string(got) != "botched" {
+		t.Fatalf("ReadVersion(2) = %q, %v, want %q", got, err, "botched")
+	}
+}
+
+func testTrashRestore(t *testing.T, s store.SecretStore) {
+	ts := trashStore(t, s)
+	mustCreate(t, ts, "prod/db", []byte("v1"))
+	mustUpdate(t, ts, "prod/db", []byte("v2"))
+	if ms, ok := ts.(store.MetadataStore); ok {
+		md, err := ms.ReadMetadata("prod/db")
+		if err != nil {
+			t.Fatalf("ReadMetadata failed: %v", err)
+		}
+		md.Description = "primary database"
+		if err := ms.WriteMetadata("prod/db", md); err != nil {
+			t.Fatalf("WriteMetadata failed: %v", err)
+		}
+	}
+
+	if err := ts.Trash("prod/db"); err != nil {
+		t.Fatalf("Trash failed: %v", err)
+	}
+	_, err := ts.Read("prod/db")
+	assertErrorIs(t, "Read of a trashed key", err, store.ErrSecretNotFound)
+	assertKeys(t, ts)
+	assertTrash(t, ts, "prod/db")
+
+	if err := ts.Restore("prod/db"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	assertValue(t, ts, "prod/db", []byte("v2"))
+	assertKeys(t, ts, "prod/db")
+	assertTrash(t, ts)
+
+	if ms, ok := ts.(store.MetadataStore); ok {
+		md, err := ms.ReadMetadata("prod/db")
+		if err != nil {
+			t.Fatalf("ReadMetadata after restore failed: %v", err)
+		}
+		if md.Description != "primary database" {
+			t.Fatalf("description after restore = %q, want %q", md.Description, "primary database")
+		}
+	}
+	if vs, ok := ts.(store.VersionedStore); ok {
+		assertVersions(t, vs, "prod/db", 1)
+	}
+}
+
+func testTrashMissing(t *testing.T, s store.SecretStore) {
+	ts := trashStore(t, s)
+	err := ts.Trash("missing")
+	assertErrorIs(t, "Trash of a missing key", err, store.ErrSecretNotFound)
+	assertTrash(t, ts)
+}
+
+func testTrashKeepsOlderCopy(t *testing.T, s store.SecretStore) {
+	ts := trashStore(t, s)
+	mustCreate(t, ts, "recycled", []byte("first"))
+	if err := ts.Trash("recycled"); err != nil {
+		t.Fatalf("Trash failed: %v", err)
+	}
+	mustCreate(t, ts, "recycled", []byte("second"))
+	err := ts.Trash("recycled")
+	assertErrorIs(t, "Trash of a key already in the trash", err, store.ErrSecretAlreadyExists)
+	assertValue(t, ts, "recycled", []byte("second"))
+	assertTrash(t, ts, "recycled")
+
+	if err := ts.Delete("recycled"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := ts.Restore("recycled"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	assertValue(t, ts, "recycled", []byte("first"))
+}
+
+func testRestoreMissing(t *testing.T, s store.SecretStore) {
+	ts := trashStore(t, s)
+	mustCreate(t, ts, "live", []byte("value"))
+	err := ts.Restore("live")
+	assertErrorIs(t, "Restore of a key not in the trash", err, store.ErrSecretNotFound)
+}
+
+func testRestoreExisting(t *testing.T, s store.SecretStore) {
+	ts := trashStore(t, s)
+	mustCreate(t, ts, "reused", []byte("old"))
+	if err := ts.Trash("reused"); err != nil {
+		t.Fatalf("Trash failed: %v", err)
+	}
+	mustCreate(t, ts, "reused", []byte("new"))
+
+	err := ts.Restore("reused")
+	assertErrorIs(t, "Restore over a live key", err, store.ErrSecretAlreadyExists)
+	assertValue(t, ts, "reused", []byte("new"))
+	assertTrash(t, ts, "reused")
+}
+
+func testPurge(t *testing.T, s store.SecretStore) {
+	ts := trashStore(t, s)
+	for _, key := range []string{"old", "new"} {
+		mustCreate(t, ts, key, []byte("value"))
+	}
+	if err := ts.Trash("old"); err != nil {
+		t.Fatalf("Trash failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	if err := ts.Trash("new"); err != nil {
+		t.Fatalf("Trash failed: %v", err)
+	}
+
+	purged, err := ts.Purge(cutoff)
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if !slices.Equal(purged, []string{"old"}) {
+		t.Fatalf("Purge returned %q, want [old]", purged)
+	}
+	assertTrash(t, ts, "new")
+	err = ts.Restore("old")
+	assertErrorIs(t, "Restore of a purged key", err, store.ErrSecretNotFound)
+
+	if _, err := ts.Purge(time.Now()); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	assertTrash(t, ts)
+}
+
+func testContextExistsUpsert(t *testing.T, s store.SecretStore) {
+	ctx := context.Background()
+	cs := store.NewContextStore(s)
+
+	if exists, err := cs.Exists(ctx, "k"); err != nil || exists {
+		t.Fatalf("Exists before create = %v, %v; want false", exists, err)
+	}
+	if created, err := cs.Upsert(ctx, "k", []byte("v1")); err != nil || !created {
+		t.Fatalf("Upsert of new key = %v, %v; want created", created, err)
+	}
+	if created, err := cs.Upsert(ctx, "k", []byte("v2")); err != nil || created {
+		t.Fatalf("Upsert of existing key = %v, %v; want updated", created, err)
+	}
+	if exists, err := cs.Exists(ctx, "k"); err != nil || !exists {
+		t.Fatalf("Exists after upsert = %v, %v; want true", exists, err)
+	}
+	assertValue(t, s, "k", []byte("v2"))
+}
+
+func testContextBatchGet(t *testing.T, s store.SecretStore) {
+	mustCreate(t, s, "a", []byte("1"))
+	mustCreate(t, s, "b", []byte("2"))
+
+	values, err := store.NewContextStore(s).BatchGet(context.Background(), []string{"a", "missing", "b"})
+	if err != nil {
+		t.Fatalf("BatchGet failed: %v", err)
+	}
+	if len(values) != 2 || string(values["a"]) != "1" || string(values["b"]) != "2" {
+		t.Fatalf("BatchGet = %q, want a and b only", values)
+	}
+}
+
+func testContextListPages(t *testing.T, s store.SecretStore) {
+	for _, key := range []string{"p/e", "p/b", "p/d", "p/a", "p/c", "q/a"} {
+		mustCreate(t, s, key, []byte("value"))
+	}
+	cs := store.NewContextStore(s)
+
+	var pages [][]string
+	opts := store.ListOptions{Prefix: "p/", Limit: 2}
+	for {
+		var page []string
+		for key, err := range cs.List(context.Background(), opts) {
+			if err != nil {
+				t.Fatalf("List(%+v) failed: %v", opts, err)
+			}
+			page = append(page, key)
+		}
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, page)
+		opts.After = page[len(page)-1]
+	}
+
+	want := [][]string{{"p/a", "p/b"}, {"p/c", "p/d"}, {"p/e"}}
+	if !slices.EqualFunc(pages, want, slices.Equal) {
+		t.Fatalf("List pages = %q, want %q", pages, want)
+	}
+}
+
+func testContextCanceled(t *testing.T, s store.SecretStore) {
+	mustCreate(t, s, "k", []byte("v"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cs := store.NewContextStore(s)
+
+	if _, err := cs.Read(ctx, "k"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Read with canceled context = %v, want context.Canceled", err)
+	}
+	if err := cs.Create(ctx, "other", []byte("v")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Create with canceled context = %v, want context.Canceled", err)
+	}
+	for _, err := range cs.List(ctx, store.ListOptions{}) {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("List with canceled context yielded %v, want context.Canceled", err)
+		}
+	}
+	assertKeys(t, s, "k")
+}
+
+func testCompareAndSwap(t *testing.T, s store.SecretStore) {
+	rs := revisionStore(t, s)
+	mustCreate(t, s, "k", []byte("v1"))
+	assertRevision(t, rs, "k", []byte("v1"), 1)
+
+	if err := rs.CompareAndSwap("k", 1, []byte("v2")); err != nil {
+		t.Fatalf("CompareAndSwap at current revision failed: %v", err)
+	}
+	assertRevision(t, rs, "k", []byte("v2"), 2)
+
+	mustUpdate(t, s, "k", []byte("v3"))
+	assertRevision(t, rs, "k", []byte("v3"), 3)
+}
+
+func testCompareAndSwapStale(t *testing.T, s store.SecretStore) {
+	rs := revisionStore(t, s)
+	mustCreate(t, s, "k", []byte("v1"))
+	mustUpdate(t, s, "k", []byte("manual change"))
+
+	err := rs.CompareAndSwap("k", 1, []byte("rotated"))
+	assertErrorIs(t, "CompareAndSwap at stale revision", err, store.ErrRevisionMismatch)
+	assertRevision(t, rs, "k", []byte("manual change"), 2)
+}
+
+func testCompareAndSwapMissing(t *testing.T, s store.SecretStore) {
+	rs := revisionStore(t, s)
+	err := rs.CompareAndSwap("missing", 1, []byte("v"))
+	assertErrorIs(t, "CompareAndSwap of missing key", err, store.ErrSecretNotFound)
+	_, _, err = rs.ReadRevision("missing")
+	assertErrorIs(t, "ReadRevision of missing key", err, store.ErrSecretNotFound)
+}
+
+func testBatch(t *testing.T, s store.SecretStore) {
+	bs := batchStore(t, s)
+	mustCreate(t, s, "old", []byte("v"))
+	mustCreate(t, s, "rotated", []byte("v1"))
+
+	err := applyBatch(t, bs, []store.BatchOp{
+		{Kind: store.BatchCreate, Key: "svc/user", Value: []byte("admin")},
+		{Kind: store.BatchCreate, Key: "svc/password", Value: []byte("p1")},
+		{Kind: store.BatchUpdate, Key: "svc/password", Value: []byte("p2")},
+		{Kind: store.BatchUpdate, Key: "rotated", Value: []byte("v2")},
+		{Kind: store.BatchDelete, Key: "old"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+	assertKeys(t, s, "rotated", "svc/password", "svc/user")
+	assertValue(t, s, "svc/user", []byte("admin"))
+	assertValue(t, s, "svc/password", []byte("p2"))
+	assertValue(t, s, "rotated", []byte("v2"))
+	if vs, ok := s.(store.VersionedStore); ok {
+		assertVersions(t, vs, "rotated", 1)
+	}
+}
+
+func testBatchMetadata(t *testing.T, s store.SecretStore) {
+	bs := batchStore(t, s)
+	ms := metadataStore(t, s)
+	mustCreate(t, s, "existing", []byte("v1"))
+
+	err := applyBatch(t, bs, []store.BatchOp{
+		{Kind: store.BatchCreate, Key: "new", Value: []byte("v"), Metadata: describe("created")},
+		{Kind: store.BatchUpdate, Key: "existing", Value: []byte("v2"), Metadata: describe("updated")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+	assertDescription(t, ms, "new", "created", 1)
+	assertDescription(t, ms, "existing", "updated", 2)
+}
+
+func testBatchRollback(t *testing.T, s store.SecretStore) {
+	bs := batchStore(t, s)
+	mustCreate(t, s, "existing", []byte("v1"))
+
+	err := applyBatch(t, bs, []store.BatchOp{
+		{Kind: store.BatchCreate, Key: "new", Value: []byte("v")},
+		{Kind: store.BatchUpdate, Key: "existing", Value: []byte("v2")},
+		{Kind: store.BatchDelete, Key: "missing"},
+	})
+	assertErrorIs(t, "ApplyBatch deleting a missing key", err, store.ErrSecretNotFound)
+	if !strings.Contains(err.Error(), "batch operation 3") {
+		t.Errorf("ApplyBatch error %q does not name the failing operation", err)
+	}
+	assertKeys(t, s, "existing")
+	assertValue(t, s, "existing", []byte("v1"))
+
+	err = applyBatch(t, bs, []store.BatchOp{{Kind: "rename", Key: "existing"}})
+	if err == nil {
+		t.Fatal("ApplyBatch with an unknown operation succeeded")
+	}
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// TrashedSecret describes a secret in the trash.
+type TrashedSecret struct {
+	Key       string    `json:"key"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// TrashStore is implemented by backends that can soft-delete secrets. A
+// trashed secret keeps its value, metadata and history until it is restored
+// or purged. A key can be in the trash only once, so that trashing a secret
+// never destroys an earlier trashed copy.
+type TrashStore interface {
+	SecretStore
+
+	// Trash moves a secret to the trash. Returns an error wrapping
+	// ErrSecretNotFound if the key doesn't exist and one wrapping
+	// ErrSecretAlreadyExists if the key is already in the trash.
+	Trash(key string) error
+	// ListTrash returns the secrets in the trash.
+	ListTrash() ([]TrashedSecret, error)
+	// Restore moves a secret out of the trash. Returns an error wrapping
+	// ErrSecretNotFound if the key isn't in the trash and one wrapping
+	// ErrSecretAlreadyExists if a secret with the same key was created since.
+	Restore(key string) error
+	// Purge permanently removes the secrets trashed before the given time and
+	// returns their keys.
+	Purge(before time.Time) ([]string, error)
+}
+
+// AsTrashStore returns s as a TrashStore, or an error wrapping
+// ErrNotSupported if the backend can't soft-delete.
+func AsTrashStore(s SecretStore) (TrashStore, error) {
+	ts, ok := s.(TrashStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s does not support the trash", ErrNotSupported, describeStore(s))
+	}
+	return ts, nil
+}
+
+// trashRecord is a trashed secret as stored by backends that keep it as a
+// single JSON document.
+type trashRecord struct {
+	Value     []byte          `json:"value"`
+	Metadata  Metadata        `json:"metadata"`
+	History   []SecretVersion `json:"history,omitempty"`
+	DeletedAt time.Time       `json:"deleted_at"`
+}
+
+// alreadyInTrash returns the error for trashing a key that is already in the
+// trash.
+func alreadyInTrash(key string) error {
+	return fmt.Errorf("%w: secret with key '%s' in trash; restore or purge it first", ErrSecretAlreadyExists, key)
+}
+
+// notInTrash returns the error for a key that isn't in the trash.
+func notInTrash(key string) error {
+	return fmt.Errorf("%w: secret with key '%s' in trash", ErrSecretNotFound, key)
+}
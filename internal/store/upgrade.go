@@ -0,0 +1,65 @@
+package store
+
+import "fmt"
+
+// FormatUpgrade describes the format version of a store file before and
+// after an upgrade.
+type FormatUpgrade struct {
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+	StoreID string `json:"store_id,omitempty"`
+}
+
+// UpgradableStore is implemented by backends whose storage format is only
+// upgraded on request, so that older binaries keep reading it until then.
+type UpgradableStore interface {
+	SecretStore
+
+	// Upgrade rewrites the storage in the newest format.
+	Upgrade() (FormatUpgrade, error)
+}
+
+// AsUpgradableStore returns s as an UpgradableStore, or an error wrapping
+// ErrNotSupported if the backend has no format to upgrade.
+func AsUpgradableStore(s SecretStore) (UpgradableStore, error) {
+	us, ok := s.(UpgradableStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no file format to upgrade", ErrNotSupported, describeStore(s))
+	}
+	return us, nil
+}
+
+// Upgrade rewrites the JSON file as format version JSONFileVersion, keeping
+// its store ID if it has one. A file already at that version is left alone.
+func (s *JSONFileStore) Upgrade() (FormatUpgrade, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return FormatUpgrade{}, err
+	}
+	defer unlock()
+
+	doc, err := s.loadData()
+	if err != nil {
+		return FormatUpgrade{}, err
+	}
+	result := FormatUpgrade{From: doc.version(), To: doc.version(), StoreID: doc.StoreID}
+	if err := doc.checkWritable(); err != nil || doc.version() == JSONFileVersion {
+		return result, err
+	}
+
+	header, err := newJSONHeader()
+	if err != nil {
+		return result, err
+	}
+	if doc.StoreID != "" {
+		header.StoreID = doc.StoreID
+	}
+	doc.jsonHeader = header
+	// The header is only written by a journal snapshot
+	s.journal.convert = true
+	if err := s.saveData(doc); err != nil {
+		return result, fmt.Errorf("failed to upgrade JSON file: %w", err)
+	}
+	result.To, result.StoreID = header.Version, header.StoreID
+	return result, nil
+}
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"log" // Keep log for general logging, return error for cobra
 	"os"
+	"path"
+	"regexp"
 	"sort"
+	"strings"
+	"text/tabwriter"
 
 	"secrets-cli/internal/key"   // Adjust import path
 	"secrets-cli/internal/store" // Adjust import path
@@ -12,20 +16,74 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	listLong       bool
+	listRecursive  bool
+	listDepth      int
+	listGlob       string
+	listRegex      string
+	listTree       bool
+	listShowSource bool
+)
+
 var ListCmd = &cobra.Command{
-	Use:     "list",
+	Use:     "list [prefix]",
 	Short:   "List all secret keys",
 	Aliases: []string{"ls"},
-	Long:    `Retrieves and lists the keys of all available secrets in the store.`,
-	Args:    cobra.NoArgs, // No arguments expected
+	Long:    `Retrieves and lists the keys of all available secrets in the store.
+With --long, also shows when each secret was last updated, who created it,
+its description and tags.
+
+Keys are paths separated by '/'. Given a prefix such as prod/db, only the keys
+below it are listed. --depth limits how many levels below the prefix are shown
+(deeper keys are collapsed into their directory, shown with a trailing '/');
+--recursive=false is the same as --depth 1. --glob and --regex filter the full
+keys, and --tree prints the result as a tree.
+
+With an overlay selected, --show-source shows the layer each secret is read
+from.`,
+	Args:    cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		var prefix string
+		if len(args) == 1 {
+			prefix = strings.Trim(args[0], "/")
+		}
+		depth := listDepth
+		if depth < 0 {
+			return fmt.Errorf("invalid depth %d (expected 0 for unlimited or more)", depth)
+		}
+		if !listRecursive && depth == 0 {
+			depth = 1
+		}
+		if listTree && listLong {
+			return fmt.Errorf("--tree and --long cannot be combined")
+		}
+		if listTree && listShowSource {
+			return fmt.Errorf("--tree and --show-source cannot be combined")
+		}
+		if listShowSource && store.Overlay == "" {
+			return fmt.Errorf("--show-source requires an overlay")
+		}
+		if listGlob != "" {
+			if _, err := path.Match(listGlob, ""); err != nil {
+				return fmt.Errorf("invalid glob '%s': %w", listGlob, err)
+			}
+		}
+		var pattern *regexp.Regexp
+		if listRegex != "" {
+			var err error
+			if pattern, err = regexp.Compile(listRegex); err != nil {
+				return fmt.Errorf("invalid regex '%s': %w", listRegex, err)
+			}
+		}
+
 		_, err := key.LoadKeyFromEnv()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to load encryption key: %v\n", err)
 			os.Exit(1)
 		}
 
-		s, err := store.GetSecretStore()
+		s, err := store.OpenStore(cmd.Context())
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to get store: %v\n", err)
 			os.Exit(1)
@@ -36,16 +94,45 @@ var ListCmd = &cobra.Command{
 			}
 		}()
 
-		keys, err := s.ListKeys()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to list secrets from store: %v\n", err)
-			os.Exit(1)
+		var keys []string
+		for key, err := range store.NewContextStore(s).List(cmd.Context(), store.ListOptions{Prefix: prefix}) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to list secrets from store: %v\n", err)
+				os.Exit(1)
+			}
+			keys = append(keys, key)
 		}
+		keys = filterKeys(keys, prefix, listGlob, pattern)
 
 		if len(keys) == 0 {
-			fmt.Printf("No secrets found in backend '%s'.\n", store.BackendType)
+			if prefix != "" {
+				fmt.Printf("No secrets found below '%s' in backend '%s'.\n", prefix, store.BackendType)
+			} else {
+				fmt.Printf("No secrets found in backend '%s'.\n", store.BackendType)
+			}
 		} else {
-			sort.Strings(keys)
+			keys = collapseKeys(keys, prefix, depth)
+			if listTree {
+				printTree(prefix, keys)
+				return nil
+			}
+			var sources map[string]string
+			if listShowSource {
+				if sources, err = keySources(s, keys); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to resolve layers: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if listLong {
+				return printLongList(s, keys, sources)
+			}
+			if sources != nil {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				for _, key := range keys {
+					fmt.Fprintf(w, "%s\t%s\n", key, sources[key])
+				}
+				return w.Flush()
+			}
 			for _, key := range keys {
 				fmt.Printf("%s\n", key)
 			}
@@ -55,6 +142,171 @@ var ListCmd = &cobra.Command{
 	},
 }
 
+// filterKeys keeps the keys that are prefix itself or below it and match the
+// optional glob and regex.
+func filterKeys(keys []string, prefix, glob string, pattern *regexp.Regexp) []string {
+	var matching []string
+	for _, key := range keys {
+		if prefix != "" && key != prefix && !strings.HasPrefix(key, prefix+"/") {
+			continue // prod_x when listing prod
+		}
+		if glob != "" {
+			if ok, _ := path.Match(glob, key); !ok {
+				continue
+			}
+		}
+		if pattern != nil && !pattern.MatchString(key) {
+			continue
+		}
+		matching = append(matching, key)
+	}
+	return matching
+}
+
+// collapseKeys sorts keys and replaces those more than depth levels below
+// prefix with their directory at that depth, ending in '/'. A depth of 0
+// keeps every key.
+func collapseKeys(keys []string, prefix string, depth int) []string {
+	base := ""
+	if prefix != "" {
+		base = prefix + "/"
+	}
+	seen := make(map[string]bool)
+	var collapsed []string
+	for _, key := range keys {
+		if depth > 0 {
+			parts := strings.Split(strings.TrimPrefix(key, base), "/")
+			if len(parts) > depth {
+				key = base + strings.Join(parts[:depth], "/") + "/"
+			}
+		}
+		if !seen[key] {
+			seen[key] = true
+			collapsed = append(collapsed, key)
+		}
+	}
+	sort.Strings(collapsed)
+	return collapsed
+}
+
+// keyTree is a node of the tree printed by --tree.
+type keyTree struct {
+	children map[string]*keyTree
+}
+
+// printTree prints keys below prefix as an indented tree.
+func printTree(prefix string, keys []string) {
+	root := &keyTree{children: make(map[string]*keyTree)}
+	base := ""
+	if prefix != "" {
+		base = prefix + "/"
+	}
+	for _, key := range keys {
+		if key == prefix {
+			continue // The prefix is the root line
+		}
+		node := root
+		parts := strings.Split(strings.TrimPrefix(key, base), "/")
+		for i, part := range parts {
+			if part == "" {
+				continue // Trailing '/' of a collapsed directory
+			}
+			if i < len(parts)-1 && parts[i+1] == "" {
+				part += "/"
+			}
+			child, exists := node.children[part]
+			if !exists {
+				child = &keyTree{children: make(map[string]*keyTree)}
+				node.children[part] = child
+			}
+			node = child
+		}
+	}
+
+	if prefix == "" {
+		fmt.Println(".")
+	} else {
+		fmt.Println(prefix)
+	}
+	root.print("")
+}
+
+// print prints the children of t, each line starting with indent.
+func (t *keyTree) print(indent string) {
+	names := make([]string, 0, len(t.children))
+	for name := range t.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		branch, next := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Printf("%s%s%s\n", indent, branch, name)
+		t.children[name].print(indent + next)
+	}
+}
+
+// printLongList prints keys with their metadata as a table, and with their
+// layer if sources isn't nil.
+func printLongList(s store.SecretStore, keys []string, sources map[string]string) error {
+	ms, err := store.AsMetadataStore(s)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "KEY\tUPDATED\tEXPIRES\tCREATED BY\tDESCRIPTION\tTAGS"
+	if sources != nil {
+		header += "\tLAYER"
+	}
+	fmt.Fprintln(w, header)
+	for _, key := range keys {
+		layer := ""
+		if sources != nil {
+			layer = "\t" + sources[key]
+		}
+		if strings.HasSuffix(key, "/") {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-%s\n", key, layer) // Collapsed directory
+			continue
+		}
+		md, err := ms.ReadMetadata(key)
+		if err != nil {
+			return fmt.Errorf("failed to read metadata of '%s': %w", key, err)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s%s\n", key, formatTime(md.UpdatedAt), formatTime(md.ExpiresAt),
+			orDash(md.CreatedBy), orDash(md.Description), orDash(formatTags(md.Tags)), layer)
+	}
+	return w.Flush()
+}
+
+// keySources returns the overlay layer each key is read from; collapsed
+// directories get "-".
+func keySources(s store.SecretStore, keys []string) (map[string]string, error) {
+	ovl, err := store.AsOverlayStore(s)
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			sources[key] = "-"
+			continue
+		}
+		if sources[key], err = ovl.Source(key); err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
 func init() {
-	// No flags or arguments for the list command
+	ListCmd.Flags().BoolVarP(&listLong, "long", "l", false, "Show metadata for each secret")
+	ListCmd.Flags().BoolVarP(&listRecursive, "recursive", "r", true, "List all levels below the prefix (false lists one level)")
+	ListCmd.Flags().IntVar(&listDepth, "depth", 0, "Number of levels below the prefix to list, 0 for all")
+	ListCmd.Flags().StringVar(&listGlob, "glob", "", "Only list keys matching a glob, where * doesn't match '/'")
+	ListCmd.Flags().StringVar(&listRegex, "regex", "", "Only list keys matching a regular expression")
+	ListCmd.Flags().BoolVar(&listTree, "tree", false, "Print the keys as a tree")
+	ListCmd.Flags().BoolVar(&listShowSource, "show-source", false, "Show the overlay layer each secret is read from")
 }
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"secrets-cli/internal/key"   // Adjust import path
 	"secrets-cli/internal/store" // Adjust import path
@@ -12,24 +15,41 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// configErr is the error loading the config file. doctor reports it, every
+// other command fails with it.
+var configErr error
+
 func main() {
 	// Load config file to initialize backend parameters before flags are parsed
-	err := store.LoadConfig()
-	if err != nil {
-		fmt.Println("error loading config", err)
-		panic(err)
-	}
+	configErr = store.LoadConfig()
+
+	// Commands are canceled on Ctrl-C or SIGTERM; a second signal kills the
+	// process as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	cancelTimeout := func() {}
 
 	var rootCmd = &cobra.Command{
 		Use:   "secrets-cli",
 		Short: "Secure Secrets Storage CLI with multiple backends",
 		Long: `A command-line tool to manage encrypted key-value secrets
-using different storage backends (sqlite, jsonfile, mongodb-placeholder).
+using different storage backends (sqlite, jsonfile, bolt, dir, remote, mongodb-placeholder).
+Any other backend NAME is served by a secrets-cli-backend-NAME plugin on PATH.
 `,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// doctor diagnoses a broken config file and a missing key
+			// itself
+			if configErr != nil && cmd != DoctorCmd {
+				return fmt.Errorf("error loading config: %w", configErr)
+			}
 			// Check if encryption key is available before most commands
-			// (Skip for generate-key command)
-			if cmd.Name() != "generate-key" {
+			// (Skip for generate-key command, and for serve, which only
+			// handles ciphertext)
+			if cmd.Name() != "generate-key" && cmd != DoctorCmd && cmd != ServeCmd {
 				_, err := key.LoadKeyFromEnv()
 				if err != nil {
 					// Log the error but let the command's RunE handle the exit
@@ -37,14 +57,51 @@ using different storage backends (sqlite, jsonfile, mongodb-placeholder).
 					return err // Cobra will print the error and exit
 				}
 			}
+			if store.Timeout < 0 {
+				return fmt.Errorf("invalid timeout %s", store.Timeout)
+			}
+			// serve runs until it is stopped, by a signal only
+			if store.Timeout > 0 && cmd != ServeCmd {
+				var timeoutCtx context.Context
+				timeoutCtx, cancelTimeout = context.WithTimeout(cmd.Context(), store.Timeout)
+				cmd.SetContext(timeoutCtx)
+			}
 			return nil
 		},
 	}
 
 	// Add persistent flags for backend selection and configuration
-	rootCmd.PersistentFlags().StringVar(&store.BackendType, "backend", store.BackendType, "Storage backend type (sqlite, jsonfile, mongodb-placeholder)")
+	rootCmd.PersistentFlags().StringVar(&store.BackendType, "backend", store.BackendType, "Storage backend type (sqlite, jsonfile, bolt, dir, remote, mongodb-placeholder, or a plugin)")
+	rootCmd.PersistentFlags().StringVar(&store.BackendLocation, "backend-location", store.BackendLocation, "Location passed to a plugin backend, such as a URL")
+	rootCmd.PersistentFlags().StringVar(&store.Namespace, "namespace", store.Namespace, "Namespace of the secrets (default \"default\")")
 	rootCmd.PersistentFlags().StringVar(&store.SqliteDBPath, "sqlite-db", store.SqliteDBPath, "SQLite database file path")
+	rootCmd.PersistentFlags().StringVar(&store.SqliteTable, "sqlite-table", store.SqliteTable, "SQLite table of the secrets, also the prefix of its history and trash tables (default \"secrets\")")
+	rootCmd.PersistentFlags().DurationVar(&store.SqliteBusyTimeout, "sqlite-busy-timeout", store.SqliteBusyTimeout, "How long to wait for another process's lock on the SQLite database (default 5s)")
+	rootCmd.PersistentFlags().StringVar(&store.SqliteJournalMode, "sqlite-journal-mode", store.SqliteJournalMode, "SQLite journal mode: wal, delete, truncate or persist (default \"wal\")")
 	rootCmd.PersistentFlags().StringVar(&store.JsonFilePath, "json-file", store.JsonFilePath, "JSON file path")
+	rootCmd.PersistentFlags().DurationVar(&store.LockTimeout, "lock-timeout", store.LockTimeout, "How long to wait for another process's lock on the JSON file or store directory (default 10s)")
+	rootCmd.PersistentFlags().BoolVar(&store.FileEncryption, "encrypt-file", store.FileEncryption, "Encrypt the whole file of the jsonfile and sqlite backends, hiding key names and their number")
+	rootCmd.PersistentFlags().StringVar(&store.JsonFormat, "json-format", store.JsonFormat, "JSON file format: document or journal (default \"document\")")
+	rootCmd.PersistentFlags().StringVar(&store.BoltDBPath, "bolt-db", store.BoltDBPath, "Bolt database file path")
+	rootCmd.PersistentFlags().StringVar(&store.DirRoot, "dir-root", store.DirRoot, "Root directory for the dir backend")
+	rootCmd.PersistentFlags().BoolVar(&store.GitEnabled, "git", store.GitEnabled, "Commit every change of a file backend to a git repository")
+	rootCmd.PersistentFlags().StringVar(&store.GitRemote, "git-remote", store.GitRemote, "Git remote used by the sync command (default origin)")
+	rootCmd.PersistentFlags().IntVar(&store.HistoryRetention, "history-retention", store.HistoryRetention, "Number of previous versions kept per secret")
+	rootCmd.PersistentFlags().BoolVar(&store.SoftDelete, "soft-delete", store.SoftDelete, "Move deleted secrets to the trash instead of removing them")
+	rootCmd.PersistentFlags().StringVar(&store.ExpiryPolicy, "expiry-policy", store.ExpiryPolicy, "How read treats expired secrets: warn or refuse (default warn)")
+	rootCmd.PersistentFlags().DurationVar(&store.Timeout, "timeout", store.Timeout, "Give up on a command that takes longer, such as 30s (default no limit)")
+	rootCmd.PersistentFlags().DurationVar(&store.CacheTTL, "cache-ttl", store.CacheTTL, "Cache reads of the backend for this long, such as 10m (default per backend from the config file)")
+	rootCmd.PersistentFlags().BoolVar(&store.NoCache, "no-cache", store.NoCache, "Bypass the cache and always ask the backend")
+	rootCmd.PersistentFlags().StringVar(&store.CacheDir, "cache-dir", store.CacheDir, "Directory of the cache files (default secrets-cli in the user cache directory)")
+	rootCmd.PersistentFlags().StringSliceVar(&store.Replicas, "replica", store.Replicas, "Mirror every change to this store, as <backend>:<path> (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&store.Overlay, "overlay", store.Overlay, "Resolve secrets through the layers of this overlay from the config file")
+	rootCmd.PersistentFlags().StringVar(&store.OverlayLayerName, "layer", store.OverlayLayerName, "Overlay layer that changes go to (default the last layer)")
+	rootCmd.PersistentFlags().StringVar(&store.RemoteURL, "remote-url", store.RemoteURL, "URL of the secrets-cli serve instance of the remote backend, such as https://secrets:8443")
+	rootCmd.PersistentFlags().StringVar(&store.RemoteTokenEnv, "remote-token-env", store.RemoteTokenEnv, "Environment variable holding the bearer token of the remote backend (default SECRETS_REMOTE_TOKEN)")
+	rootCmd.PersistentFlags().StringVar(&store.RemoteCA, "remote-ca", store.RemoteCA, "PEM file of the CA the remote server's certificate is signed by (default the system roots)")
+	rootCmd.PersistentFlags().StringVar(&store.RemoteCert, "remote-cert", store.RemoteCert, "PEM file of the client certificate for the remote backend")
+	rootCmd.PersistentFlags().StringVar(&store.RemoteKey, "remote-key", store.RemoteKey, "PEM file of the client certificate's private key for the remote backend")
+	rootCmd.PersistentFlags().IntVar(&store.RemoteRetries, "remote-retries", store.RemoteRetries, "How often the remote backend retries a failed request")
 	rootCmd.PersistentFlags().StringVar(&store.MongoURI, "mongo-uri", store.MongoURI, "MongoDB connection URI")
 	rootCmd.PersistentFlags().StringVar(&store.MongoDatabase, "mongo-db", store.MongoDatabase, "MongoDB database name")
 	rootCmd.PersistentFlags().StringVar(&store.MongoCollection, "mongo-collection", store.MongoCollection, "MongoDB collection name")
@@ -55,9 +112,29 @@ using different storage backends (sqlite, jsonfile, mongodb-placeholder).
 	rootCmd.AddCommand(ReadCmd)
 	rootCmd.AddCommand(DeleteCmd)
 	rootCmd.AddCommand(ListCmd)
+	rootCmd.AddCommand(InfoCmd)
+	rootCmd.AddCommand(HistoryCmd)
+	rootCmd.AddCommand(RollbackCmd)
+	rootCmd.AddCommand(TrashCmd)
+	rootCmd.AddCommand(RestoreCmd)
+	rootCmd.AddCommand(PurgeCmd)
+	rootCmd.AddCommand(DueCmd)
+	rootCmd.AddCommand(NamespacesCmd)
 	rootCmd.AddCommand(GenerateCmd)
+	rootCmd.AddCommand(BatchCmd)
+	rootCmd.AddCommand(MigrateCmd)
+	rootCmd.AddCommand(ImportPassCmd)
+	rootCmd.AddCommand(SyncCmd)
+	rootCmd.AddCommand(CacheCmd)
+	rootCmd.AddCommand(ReplicaCmd)
+	rootCmd.AddCommand(CompactCmd)
+	rootCmd.AddCommand(UpgradeCmd)
+	rootCmd.AddCommand(DoctorCmd)
+	rootCmd.AddCommand(ServeCmd)
 
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.ExecuteContext(ctx)
+	cancelTimeout()
+	if err != nil {
 		// Error handling is now mostly within RunE functions,
 		// so simply exiting after cobra prints the error is fine.
 		os.Exit(1)
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"secrets-cli/internal/crypto"
+	"secrets-cli/internal/key"
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateFrom       string
+	migrateTo         string
+	migrateOnConflict string
+	migrateKeyEnv     string
+)
+
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate --from <backend>:<path> --to <backend>:<path>",
+	Short: "Copy all secrets from one store to another",
+	Long: `Copies every secret of the current namespace from one store to another, such
+as from a JSON file to a SQLite database. A store is given as <backend>:<path>,
+e.g. jsonfile:/home/me/secrets.json; an omitted --from or --to is the store
+selected by --backend and the config file.
+
+The encrypted values are copied as they are, together with their metadata.
+With --reencrypt-key-env NAME every value is decrypted with
+SECRETS_ENCRYPTION_KEY and encrypted with the base64 key in $NAME instead.
+
+Secrets that already exist in the destination with the same value are left
+alone, so an interrupted migration is resumed by running it again. Secrets
+that exist with another value are conflicts, handled by --on-conflict:
+fail (the default) stops before anything is written, skip keeps the
+destination's value and overwrite replaces it.
+
+At the end every copied secret is read back from both stores and compared.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if migrateFrom == "" && migrateTo == "" {
+			return fmt.Errorf("--from or --to is required")
+		}
+		same, err := store.SameStore(migrateFrom, migrateTo)
+		if err != nil {
+			return err
+		}
+		if same {
+			return fmt.Errorf("source and destination are the same store")
+		}
+		if migrateOnConflict != "fail" && migrateOnConflict != "skip" && migrateOnConflict != "overwrite" {
+			return fmt.Errorf("invalid conflict policy '%s' (expected fail, skip or overwrite)", migrateOnConflict)
+		}
+
+		var opts migrateOptions
+		opts.onConflict = migrateOnConflict
+		if migrateKeyEnv != "" {
+			var err error
+			if opts.sourceKey, err = key.LoadKeyFromEnv(); err != nil {
+				return fmt.Errorf("failed to load encryption key: %w", err)
+			}
+			if opts.targetKey, err = key.LoadKeyFromEnvVar(migrateKeyEnv); err != nil {
+				return fmt.Errorf("failed to load new encryption key: %w", err)
+			}
+		}
+
+		src, err := openMigrateStore(cmd.Context(), migrateFrom)
+		if err != nil {
+			return fmt.Errorf("failed to open source store: %w", err)
+		}
+		defer func() {
+			if closeErr := src.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+		dst, err := openMigrateStore(cmd.Context(), migrateTo)
+		if err != nil {
+			return fmt.Errorf("failed to open destination store: %w", err)
+		}
+		defer func() {
+			if closeErr := dst.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		result, err := migrateSecrets(cmd.Context(), src, dst, opts)
+		var conflicts conflictError
+		if errors.As(err, &conflicts) {
+			fmt.Fprintf(os.Stderr, "%v:\n", err)
+			for _, k := range conflicts {
+				fmt.Fprintf(os.Stderr, "  %s\n", k)
+			}
+			fmt.Fprintln(os.Stderr, "nothing was copied; use --on-conflict skip or overwrite")
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migration failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Copied %d secrets, %d already present, %d overwritten, %d skipped.\n",
+			result.copied, result.unchanged, result.overwritten, result.skipped)
+		fmt.Printf("Verified %d secrets (checksum %s).\n", result.verified, result.checksum)
+		return nil
+	},
+}
+
+// openMigrateStore opens the store given by spec, or the configured store if
+// spec is empty.
+func openMigrateStore(ctx context.Context, spec string) (store.SecretStore, error) {
+	if spec == "" {
+		return store.OpenStore(ctx)
+	}
+	return store.OpenStoreSpec(ctx, spec)
+}
+
+// migrateOptions control migrateSecrets.
+type migrateOptions struct {
+	onConflict string // fail, skip or overwrite
+	sourceKey  []byte // With targetKey, re-encrypt from sourceKey to targetKey
+	targetKey  []byte
+}
+
+// migrateResult counts what migrateSecrets did.
+type migrateResult struct {
+	copied, unchanged, overwritten, skipped int
+	verified                                int
+	checksum                                string // Over the keys and values of the verified secrets
+}
+
+// conflictError lists the keys that exist in the destination with another
+// value.
+type conflictError []string
+
+func (e conflictError) Error() string {
+	return fmt.Sprintf("%d secrets already exist in the destination with another value", len(e))
+}
+
+// migrateSecrets copies the secrets of src to dst one at a time and verifies
+// the copies. A first pass compares both stores, so that conflicts are found
+// before anything is written.
+func migrateSecrets(ctx context.Context, src, dst store.SecretStore, opts migrateOptions) (migrateResult, error) {
+	var result migrateResult
+	srcCS, dstCS := store.NewContextStore(src), store.NewContextStore(dst)
+
+	keys, err := src.ListKeys()
+	if err != nil {
+		return result, fmt.Errorf("failed to list source secrets: %w", err)
+	}
+	slices.Sort(keys)
+
+	// exists and equal record the state of every key in the destination
+	exists := make(map[string]bool, len(keys))
+	equal := make(map[string]bool, len(keys))
+	var conflicts conflictError
+	for _, k := range keys {
+		dstValue, err := dstCS.Read(ctx, k)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read destination secret '%s': %w", k, err)
+		}
+		srcValue, err := srcCS.Read(ctx, k)
+		if err != nil {
+			return result, fmt.Errorf("failed to read source secret '%s': %w", k, err)
+		}
+		exists[k] = true
+		equal[k], err = sameSecret(srcValue, dstValue, opts)
+		if err != nil {
+			return result, fmt.Errorf("failed to compare secret '%s': %w", k, err)
+		}
+		if !equal[k] {
+			conflicts = append(conflicts, k)
+		}
+	}
+	if len(conflicts) > 0 && opts.onConflict == "fail" {
+		return result, conflicts
+	}
+
+	var verify []string
+	for _, k := range keys {
+		switch {
+		case equal[k]:
+			result.unchanged++
+			verify = append(verify, k)
+			continue
+		case exists[k] && opts.onConflict == "skip":
+			result.skipped++
+			continue
+		}
+
+		value, err := srcCS.Read(ctx, k)
+		if err != nil {
+			return result, fmt.Errorf("failed to read source secret '%s': %w", k, err)
+		}
+		if opts.targetKey != nil {
+			if value, err = reencrypt(value, opts.sourceKey, opts.targetKey); err != nil {
+				return result, fmt.Errorf("failed to re-encrypt secret '%s': %w", k, err)
+			}
+		}
+		if exists[k] {
+			err = dstCS.Update(ctx, k, value)
+			result.overwritten++
+		} else {
+			err = dstCS.Create(ctx, k, value)
+			result.copied++
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to write secret '%s': %w", k, err)
+		}
+		if err := copyMetadata(src, dst, k); err != nil {
+			return result, fmt.Errorf("failed to copy metadata of secret '%s': %w", k, err)
+		}
+		verify = append(verify, k)
+	}
+
+	sum := sha256.New()
+	var mismatched []string
+	for _, k := range verify {
+		srcValue, err := srcCS.Read(ctx, k)
+		if err != nil {
+			return result, fmt.Errorf("failed to verify secret '%s': %w", k, err)
+		}
+		dstValue, err := dstCS.Read(ctx, k)
+		if err != nil {
+			return result, fmt.Errorf("failed to verify secret '%s': %w", k, err)
+		}
+		same, err := sameSecret(srcValue, dstValue, opts)
+		if err != nil || !same {
+			mismatched = append(mismatched, k)
+			continue
+		}
+		valueSum := sha256.Sum256(srcValue)
+		fmt.Fprintf(sum, "%s\x00%x\n", k, valueSum)
+		result.verified++
+	}
+	if len(mismatched) > 0 {
+		return result, fmt.Errorf("verification failed for %d secrets: %s", len(mismatched), strings.Join(mismatched, ", "))
+	}
+	result.checksum = hex.EncodeToString(sum.Sum(nil))[:16]
+	return result, nil
+}
+
+// sameSecret reports whether a source and a destination value hold the same
+// secret: the same bytes, or the same plaintext when re-encrypting.
+func sameSecret(srcValue, dstValue []byte, opts migrateOptions) (bool, error) {
+	if opts.targetKey == nil {
+		return bytes.Equal(srcValue, dstValue), nil
+	}
+	plaintext, err := crypto.Decrypt(srcValue, opts.sourceKey)
+	if err != nil {
+		return false, err
+	}
+	dstPlaintext, err := crypto.Decrypt(dstValue, opts.targetKey)
+	if err != nil {
+		return false, nil // Encrypted with another key
+	}
+	return bytes.Equal(plaintext, dstPlaintext), nil
+}
+
+// reencrypt decrypts value with oldKey and encrypts it with newKey.
+func reencrypt(value, oldKey, newKey []byte) ([]byte, error) {
+	plaintext, err := crypto.Decrypt(value, oldKey)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Encrypt(plaintext, newKey)
+}
+
+// copyMetadata copies the description, tags, creator, expiry date and
+// timestamps of a secret if both stores keep metadata. The destination's
+// version number is kept, since the history isn't copied.
+func copyMetadata(src, dst store.SecretStore, k string) error {
+	srcMS, ok := src.(store.MetadataStore)
+	if !ok {
+		return nil
+	}
+	dstMS, ok := dst.(store.MetadataStore)
+	if !ok {
+		return nil
+	}
+	md, err := srcMS.ReadMetadata(k)
+	if err != nil {
+		return err
+	}
+	current, err := dstMS.ReadMetadata(k)
+	if err != nil {
+		return err
+	}
+	md.Version = current.Version
+	return dstMS.WriteMetadata(k, md)
+}
+
+func init() {
+	MigrateCmd.Flags().StringVar(&migrateFrom, "from", "", "Source store as <backend>:<path> (default the configured store)")
+	MigrateCmd.Flags().StringVar(&migrateTo, "to", "", "Destination store as <backend>:<path> (default the configured store)")
+	MigrateCmd.Flags().StringVar(&migrateOnConflict, "on-conflict", "fail", "What to do with secrets that exist in the destination with another value (fail, skip, overwrite)")
+	MigrateCmd.Flags().StringVar(&migrateKeyEnv, "reencrypt-key-env", "", "Re-encrypt the secrets with the base64 key in this environment variable")
+}
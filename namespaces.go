@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var namespacesOutput string
+
+var NamespacesCmd = &cobra.Command{
+	Use:   "namespaces",
+	Short: "List the namespaces of the store",
+	Long: `Lists the namespaces that contain secrets. The namespace selected with
+--namespace is marked with '*'; the default namespace is always listed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if namespacesOutput != "text" && namespacesOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", namespacesOutput)
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		ns, err := store.AsNamespacedStore(s)
+		if err != nil {
+			return err
+		}
+
+		namespaces, err := ns.ListNamespaces()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list namespaces: %v\n", err)
+			os.Exit(1)
+		}
+
+		if namespacesOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(namespaces)
+		}
+
+		current := store.Namespace
+		if current == "" {
+			current = store.DefaultNamespace
+		}
+		for _, name := range namespaces {
+			marker := " "
+			if name == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+		return nil
+	},
+}
+
+func init() {
+	NamespacesCmd.Flags().StringVarP(&namespacesOutput, "output", "o", "text", "Output format (text, json)")
+}
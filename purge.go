@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var purgeOlderThan string
+
+var PurgeCmd = &cobra.Command{
+	Use:   "purge [--older-than age]",
+	Short: "Permanently remove secrets from the trash",
+	Long: `Permanently removes soft-deleted secrets from the trash. With --older-than
+only secrets deleted longer ago than the given age are removed, e.g. 30d or 12h.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		before := time.Now()
+		if purgeOlderThan != "" {
+			age, err := parseAge(purgeOlderThan)
+			if err != nil {
+				return err
+			}
+			before = before.Add(-age)
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		ts, err := store.AsTrashStore(s)
+		if err != nil {
+			return err
+		}
+
+		purged, err := ts.Purge(before)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to purge trash: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Purged %d secrets from the trash.\n", len(purged))
+		return nil
+	},
+}
+
+// parseAge parses a duration such as 12h, additionally accepting a whole
+// number of days such as 30d.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age '%s'", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age '%s'", s)
+	}
+	return age, nil
+}
+
+func init() {
+	PurgeCmd.Flags().StringVar(&purgeOlderThan, "older-than", "", "Only purge secrets deleted longer ago than this (e.g. 30d, 12h)")
+}
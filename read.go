@@ -1,10 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log" // Keep log for general logging, return error for cobra
 	"os"
+	"time"
 
 	"secrets-cli/internal/crypto" // Adjust import path
 	"secrets-cli/internal/key"    // Adjust import path
@@ -13,24 +15,45 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	readVersion int64
+	readOutput  string
+)
+
 var ReadCmd = &cobra.Command{
-	Use:     "read [key]",
+	Use:     "read [key] [--version N]",
 	Short:   "Read a secret by its key",
 	Aliases: []string{"get"},
-	Long:    `Retrieves and decrypts a secret value based on its key.`,
+	Long: `Retrieves and decrypts a secret value based on its key.
+Use --version to read a previous version listed by the history command.
+With --output json the key and revision are printed along with the value; pass
+the revision to 'create --update --if-revision' to update the secret only if
+nobody changed it in between. The revision is left out when reading a previous
+version or from a backend without revisions.`,
 	Args:    cobra.ExactArgs(1), // Require exactly one argument
 	RunE: func(cmd *cobra.Command, args []string) error {
 		readKey := args[0]
 		if readKey == "" {
 			return fmt.Errorf("key argument is required")
 		}
+		if readOutput != "text" && readOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", readOutput)
+		}
+
+		policy := store.ExpiryPolicy
+		if policy == "" {
+			policy = store.ExpiryPolicyWarn
+		}
+		if policy != store.ExpiryPolicyWarn && policy != store.ExpiryPolicyRefuse {
+			return fmt.Errorf("invalid expiry policy '%s' (expected warn or refuse)", policy)
+		}
 
 		encryptionKey, err := key.LoadKeyFromEnv()
 		if err != nil {
 			return fmt.Errorf("failed to load encryption key: %w", err)
 		}
 
-		s, err := store.GetSecretStore()
+		s, err := store.OpenStore(cmd.Context())
 		if err != nil {
 			return fmt.Errorf("failed to get store: %w", err)
 		}
@@ -40,27 +63,78 @@ var ReadCmd = &cobra.Command{
 			}
 		}()
 
-		encryptedValue, err := s.Read(readKey)
+		var encryptedValue []byte
+		var revision int64
+		if cmd.Flags().Changed("version") {
+			vs, vsErr := store.AsVersionedStore(s)
+			if vsErr != nil {
+				return vsErr
+			}
+			encryptedValue, err = vs.ReadVersion(readKey, readVersion)
+		} else if rs, ok := s.(store.RevisionStore); ok && readOutput == "json" {
+			// Read value and revision together so they match
+			err = store.RunContext(cmd.Context(), s, func() (err error) {
+				encryptedValue, revision, err = rs.ReadRevision(readKey)
+				return err
+			})
+		} else {
+			encryptedValue, err = store.NewContextStore(s).Read(cmd.Context(), readKey)
+		}
 		if errors.Is(err, store.ErrSecretNotFound) {
 			fmt.Fprintf(os.Stderr, "secret with key '%s' not found\n", readKey)
 			os.Exit(1)
 		}
+		if errors.Is(err, store.ErrVersionNotFound) {
+			fmt.Fprintf(os.Stderr, "version %d of secret '%s' not found\n", readVersion, readKey)
+			os.Exit(1)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to read secret from store: %v\n", err)
 			os.Exit(1)
 		}
 
+		if ms, ok := s.(store.MetadataStore); ok {
+			// Wrappers such as the cache pass ErrNotSupported on from
+			// backends without metadata
+			md, err := ms.ReadMetadata(readKey)
+			if err != nil && !errors.Is(err, store.ErrNotSupported) {
+				fmt.Fprintf(os.Stderr, "failed to read metadata from store: %v\n", err)
+				os.Exit(1)
+			}
+			if md.Expired(time.Now()) {
+				if policy == store.ExpiryPolicyRefuse {
+					fmt.Fprintf(os.Stderr, "secret '%s' expired on %s; rotate it or read it with --expiry-policy warn\n",
+						readKey, formatTime(md.ExpiresAt))
+					os.Exit(1)
+				}
+				fmt.Fprintf(os.Stderr, "warning: secret '%s' expired on %s\n", readKey, formatTime(md.ExpiresAt))
+			}
+		}
+
 		secretValue, err := crypto.Decrypt(encryptedValue, encryptionKey)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to decrypt value for key '%s': %v\n", readKey, err)
 			os.Exit(1)
 		}
 
+		if readOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(readResult{Key: readKey, Value: string(secretValue), Revision: revision})
+		}
 		fmt.Printf("%s\n", string(secretValue))
 		return nil
 	},
 }
 
+// readResult is a secret printed by read --output json.
+type readResult struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Revision int64  `json:"revision,omitempty"` // Current revision; 0 if unknown
+}
+
 func init() {
-	// No flag needed for key anymore
+	ReadCmd.Flags().Int64Var(&readVersion, "version", 0, "Read this version instead of the current one")
+	ReadCmd.Flags().StringVarP(&readOutput, "output", "o", "text", "Output format (text, json)")
 }
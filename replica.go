@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var replicaOutput string
+
+var ReplicaCmd = &cobra.Command{
+	Use:   "replica",
+	Short: "Check and repair the replicas of the store",
+	Long: `With replicas configured by --replica or replicas in the config file, every
+change is written to the selected store, the primary, and to each replica, and
+reads fall back to the replicas when the primary can't be reached. A replica
+that misses a change, for example because it was unreachable, diverges until
+it is repaired.`,
+}
+
+var ReplicaStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Compare every replica with the primary",
+	Long: `Lists the secrets each replica is missing, has in addition or holds with
+another value than the primary. Exits with status 2 if any replica diverges.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if replicaOutput != "text" && replicaOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", replicaOutput)
+		}
+
+		statuses, err := runReplicas(cmd.Context(), (*store.MirrorStore).Status)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compare replicas: %v\n", err)
+			os.Exit(1)
+		}
+
+		if replicaOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(statuses); err != nil {
+				return err
+			}
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REPLICA\tSTATUS")
+			for _, st := range statuses {
+				fmt.Fprintf(w, "%s\t%s\n", st.Name, describeReplica(st))
+			}
+			w.Flush()
+		}
+
+		for _, st := range statuses {
+			if !st.InSync() {
+				os.Exit(2)
+			}
+		}
+		return nil
+	},
+}
+
+var ReplicaRepairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Bring every replica back in sync with the primary",
+	Long: `Creates the secrets a replica is missing, overwrites those it holds with
+another value and deletes those the primary doesn't have, so that every
+reachable replica holds the same secrets as the primary again.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		statuses, err := runReplicas(cmd.Context(), (*store.MirrorStore).Repair)
+		for _, st := range statuses {
+			switch {
+			case st.Error != "":
+				fmt.Printf("%s: not repaired, unavailable: %s\n", st.Name, st.Error)
+			case st.InSync():
+				fmt.Printf("%s: already in sync\n", st.Name)
+			default:
+				fmt.Printf("%s: created %d, updated %d, deleted %d secrets\n",
+					st.Name, len(st.Missing), len(st.Different), len(st.Extra))
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to repair replicas: %v\n", err)
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+// runReplicas opens the store, bypassing the cache, and runs fn on its
+// mirror.
+func runReplicas(ctx context.Context, fn func(*store.MirrorStore) ([]store.ReplicaStatus, error)) ([]store.ReplicaStatus, error) {
+	store.NoCache = true // Compare the backends themselves
+	s, err := store.OpenStore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get store: %w", err)
+	}
+	defer func() {
+		if closeErr := s.Close(); closeErr != nil {
+			log.Printf("Error closing store connection: %v", closeErr)
+		}
+	}()
+
+	ms, err := store.AsMirrorStore(s)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []store.ReplicaStatus
+	err = store.RunContext(ctx, s, func() (err error) {
+		statuses, err = fn(ms)
+		return err
+	})
+	return statuses, err
+}
+
+// describeReplica summarizes a replica status for text output.
+func describeReplica(st store.ReplicaStatus) string {
+	if st.Error != "" {
+		return "unavailable: " + st.Error
+	}
+	if st.InSync() {
+		return "in sync"
+	}
+	return fmt.Sprintf("%d missing, %d different, %d extra", len(st.Missing), len(st.Different), len(st.Extra))
+}
+
+func init() {
+	ReplicaStatusCmd.Flags().StringVarP(&replicaOutput, "output", "o", "text", "Output format (text, json)")
+	ReplicaCmd.AddCommand(ReplicaStatusCmd)
+	ReplicaCmd.AddCommand(ReplicaRepairCmd)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var RestoreCmd = &cobra.Command{
+	Use:   "restore [key]",
+	Short: "Restore a secret from the trash",
+	Long: `Moves a soft-deleted secret out of the trash, together with its metadata
+and history. Fails if a secret with the same key has been created since.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		restoreKey := args[0]
+		if restoreKey == "" {
+			return fmt.Errorf("key argument is required")
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		ts, err := store.AsTrashStore(s)
+		if err != nil {
+			return err
+		}
+
+		err = ts.Restore(restoreKey)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			fmt.Fprintf(os.Stderr, "secret with key '%s' not found in trash\n", restoreKey)
+			os.Exit(1)
+		}
+		if errors.Is(err, store.ErrSecretAlreadyExists) {
+			fmt.Fprintf(os.Stderr, "secret with key '%s' already exists; delete it before restoring\n", restoreKey)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to restore secret: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Secret '%s' restored from trash.\n", restoreKey)
+		return nil
+	},
+}
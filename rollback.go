@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var rollbackTo int64
+
+var RollbackCmd = &cobra.Command{
+	Use:   "rollback [key] [--to N]",
+	Short: "Restore a previous version of a secret",
+	Long: `Makes a previous version of a secret current again. Without --to the most
+recent previous version is restored. The value being replaced is kept in the
+history, so a rollback can itself be rolled back. If the secret changes while
+the rollback runs, it is left alone and rollback exits with status 2.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rollbackKey := args[0]
+		if rollbackKey == "" {
+			return fmt.Errorf("key argument is required")
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		vs, err := store.AsVersionedStore(s)
+		if err != nil {
+			return err
+		}
+
+		version := rollbackTo
+		if !cmd.Flags().Changed("to") {
+			previous, err := vs.ListVersions(rollbackKey)
+			if errors.Is(err, store.ErrSecretNotFound) {
+				fmt.Fprintf(os.Stderr, "secret with key '%s' not found\n", rollbackKey)
+				os.Exit(1)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read history from store: %v\n", err)
+				os.Exit(1)
+			}
+			if len(previous) == 0 {
+				fmt.Fprintf(os.Stderr, "secret '%s' has no previous versions\n", rollbackKey)
+				os.Exit(1)
+			}
+			version = previous[0].Version
+		}
+
+		err = store.Rollback(vs, rollbackKey, version)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			fmt.Fprintf(os.Stderr, "secret with key '%s' not found\n", rollbackKey)
+			os.Exit(1)
+		}
+		if errors.Is(err, store.ErrVersionNotFound) {
+			fmt.Fprintf(os.Stderr, "version %d of secret '%s' not found\n", version, rollbackKey)
+			os.Exit(1)
+		}
+		if errors.Is(err, store.ErrRevisionMismatch) {
+			fmt.Fprintf(os.Stderr, "secret not rolled back, it changed meanwhile: %v\n", err)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to roll back secret: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Secret '%s' rolled back to version %d.\n", rollbackKey, version)
+		return nil
+	},
+}
+
+func init() {
+	RollbackCmd.Flags().Int64Var(&rollbackTo, "to", 0, "Version to restore (default: the most recent previous version)")
+}
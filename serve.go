@@ -0,0 +1,89 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveListen   string
+	serveCert     string
+	serveKey      string
+	serveClientCA string
+	serveTokenEnv string
+)
+
+var ServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the store to remote backends over HTTPS",
+	Long: `Serves the store selected by the flags and the config file over HTTPS, for
+clients using the remote backend. Clients encrypt and decrypt secrets
+themselves: the server only stores ciphertext and doesn't need the encryption
+key. Every namespace of the store is served.
+
+Clients must present a certificate signed by --client-ca, a bearer token
+from the --token-env variable, or both; serve refuses to start without
+either.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serveCert == "" || serveKey == "" {
+			return fmt.Errorf("--tls-cert and --tls-key are required")
+		}
+		tokenEnv := cmp.Or(serveTokenEnv, store.DefaultRemoteTokenEnv)
+		token := os.Getenv(tokenEnv)
+		if serveClientCA == "" && token == "" {
+			return fmt.Errorf("no client authentication: set --client-ca or the %s variable", tokenEnv)
+		}
+		tlsConfig, err := store.RemoteServerTLSConfig(serveCert, serveKey, serveClientCA)
+		if err != nil {
+			return err
+		}
+		// Every client has a cache of its own
+		store.NoCache = true
+
+		server := store.NewRemoteServer(store.OpenNamespaceStore, token)
+		defer func() {
+			if closeErr := server.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+		httpServer := &http.Server{
+			Addr:              serveListen,
+			Handler:           server.Handler(),
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		// Stop on Ctrl-C or SIGTERM, letting running requests finish
+		go func() {
+			<-cmd.Context().Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			httpServer.Shutdown(shutdownCtx)
+		}()
+		fmt.Fprintf(os.Stderr, "Serving the %s store on https://%s\n", store.BackendType, serveListen)
+		if err := httpServer.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "failed to serve store: %v\n", err)
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+func init() {
+	ServeCmd.Flags().StringVar(&serveListen, "listen", ":8443", "Address to listen on")
+	ServeCmd.Flags().StringVar(&serveCert, "tls-cert", "", "PEM file of the server certificate")
+	ServeCmd.Flags().StringVar(&serveKey, "tls-key", "", "PEM file of the server certificate's private key")
+	ServeCmd.Flags().StringVar(&serveClientCA, "client-ca", "", "PEM file of the CA that client certificates must be signed by")
+	ServeCmd.Flags().StringVar(&serveTokenEnv, "token-env", store.DefaultRemoteTokenEnv, "Environment variable holding the bearer token clients must send")
+}
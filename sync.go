@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var SyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Pull and push store changes against the git remote",
+	Long: `Rebases the local store commits onto the configured git remote and pushes
+the result. Requires the git integration (--git or "git": true in the config).
+If local and remote changes conflict, nothing is changed and the conflicting
+files are reported.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !store.GitEnabled {
+			return fmt.Errorf("sync requires the git integration, enable it with --git")
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		gitStore, ok := s.(*store.GitStore)
+		if !ok {
+			return fmt.Errorf("backend '%s' is not tracked in git", store.BackendType)
+		}
+
+		err = gitStore.Sync()
+		if errors.Is(err, store.ErrSyncConflict) {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to sync store: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Store synced with remote '%s'.\n", gitStore.Remote)
+		return nil
+	},
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var trashOutput string
+
+var TrashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Inspect soft-deleted secrets",
+	Long: `Secrets deleted with --soft-delete are kept in the trash until they are
+restored with 'restore' or removed for good with 'purge'.`,
+}
+
+var TrashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the secrets in the trash",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if trashOutput != "text" && trashOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", trashOutput)
+		}
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		ts, err := store.AsTrashStore(s)
+		if err != nil {
+			return err
+		}
+
+		trashed, err := ts.ListTrash()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list trash: %v\n", err)
+			os.Exit(1)
+		}
+		sort.Slice(trashed, func(i, j int) bool { return trashed[i].Key < trashed[j].Key })
+
+		if trashOutput == "json" {
+			if trashed == nil {
+				trashed = []store.TrashedSecret{} // Encode as [] rather than null
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(trashed)
+		}
+
+		if len(trashed) == 0 {
+			fmt.Printf("The trash of backend '%s' is empty.\n", store.BackendType)
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tDELETED")
+		for _, t := range trashed {
+			fmt.Fprintf(w, "%s\t%s\n", t.Key, formatTime(t.DeletedAt))
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	TrashListCmd.Flags().StringVarP(&trashOutput, "output", "o", "text", "Output format (text, json)")
+	TrashCmd.AddCommand(TrashListCmd)
+}
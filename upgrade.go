@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"secrets-cli/internal/store"
+
+	"github.com/spf13/cobra"
+)
+
+var upgradeOutput string
+
+var UpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade the JSON file to the newest format version",
+	Long: fmt.Sprintf(`Rewrites the file of the jsonfile backend as format version %d, which records
+a store ID and how values are encrypted. Older files are read as they are and
+keep their version when changed, so that older secrets-cli binaries can still
+use them; run upgrade once every binary sharing the file is up to date.`, store.JSONFileVersion),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if upgradeOutput != "text" && upgradeOutput != "json" {
+			return fmt.Errorf("invalid output format '%s' (expected text or json)", upgradeOutput)
+		}
+		// Upgrade the file itself rather than the cache in front of it
+		store.NoCache = true
+
+		s, err := store.OpenStore(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get store: %w", err)
+		}
+		defer func() {
+			if closeErr := s.Close(); closeErr != nil {
+				log.Printf("Error closing store connection: %v", closeErr)
+			}
+		}()
+
+		us, err := store.AsUpgradableStore(s)
+		if err != nil {
+			return err
+		}
+		result, err := us.Upgrade()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to upgrade store: %v\n", err)
+			os.Exit(1)
+		}
+
+		if upgradeOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(result)
+		}
+		if result.From == result.To {
+			fmt.Printf("Store is already at format version %d.\n", result.To)
+			return nil
+		}
+		fmt.Printf("Upgraded store from format version %d to %d (store ID %s).\n", result.From, result.To, result.StoreID)
+		return nil
+	},
+}
+
+func init() {
+	UpgradeCmd.Flags().StringVarP(&upgradeOutput, "output", "o", "text", "Output format (text, json)")
+}